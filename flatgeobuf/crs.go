@@ -0,0 +1,227 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// epsgProjStrings maps common EPSG codes to their PROJ definitions.
+var epsgProjStrings = map[int32]string{
+	4267: "+proj=longlat +datum=NAD27 +no_defs",
+	4258: "+proj=longlat +ellps=GRS80 +towgs84=0,0,0,0,0,0,0 +no_defs",
+	4269: "+proj=longlat +datum=NAD83 +no_defs",
+	4326: "+proj=longlat +datum=WGS84 +no_defs",
+	3857: "+proj=merc +a=6378137 +b=6378137 +lat_ts=0 +lon_0=0 +x_0=0 +y_0=0 +k=1 +units=m +nadgrids=@null +wktext +no_defs",
+}
+
+// HeaderProjString returns a PROJ string describing the coordinate
+// reference system (CRS) of a header, for use with reprojection
+// libraries which accept PROJ strings. The second return value is
+// false if the header has no CRS, or its CRS can't be identified.
+//
+// Only CRSs defined by the EPSG authority are supported. The EPSG code
+// is taken from the header's CRS table, where an absent organization
+// means EPSG, as per the FlatGeobuf specification. If the table doesn't
+// give an EPSG code, the code is taken from the outermost AUTHORITY
+// (WKT1) or ID (WKT2) element of the CRS table's WKT, if any.
+//
+// Common geographic CRSs (WGS 84, NAD83, NAD27, and ETRS89), Web
+// Mercator, and the WGS 84 UTM zones are mapped to full PROJ
+// definitions. Any other EPSG code is returned as "+init=EPSG:<code>",
+// which depends on the PROJ installation having an EPSG init file,
+// something that modern PROJ versions lack.
+//
+// HeaderProjString does not translate WKT into PROJ parameters, so a
+// CRS described only by WKT without an EPSG authority isn't identified.
+// Nor does it check that the WKT agrees with the code in the CRS table.
+func HeaderProjString(h *flat.Header) (s string, ok bool) {
+	_ = safeFlatBuffersInteraction(func() error {
+		var crs flat.Crs
+		if h.Crs(&crs) == nil {
+			return nil
+		}
+		var code int32
+		if code, ok = crsEPSGCode(&crs); !ok {
+			return nil
+		}
+		if s, ok = epsgProjStrings[code]; ok {
+			return nil
+		}
+		switch {
+		case 32601 <= code && code <= 32660:
+			s = fmt.Sprintf("+proj=utm +zone=%d +datum=WGS84 +units=m +no_defs", code-32600)
+		case 32701 <= code && code <= 32760:
+			s = fmt.Sprintf("+proj=utm +zone=%d +south +datum=WGS84 +units=m +no_defs", code-32700)
+		default:
+			s = fmt.Sprintf("+init=EPSG:%d", code)
+		}
+		ok = true
+		return nil
+	})
+	return
+}
+
+// crsEPSGCode returns the EPSG code of a CRS table, falling back to the
+// authority given in its WKT.
+func crsEPSGCode(crs *flat.Crs) (int32, bool) {
+	if org := crs.Org(); org == nil || bytes.EqualFold(org, []byte("EPSG")) {
+		if code := crs.Code(); code > 0 {
+			return code, true
+		} else if n, err := strconv.ParseInt(string(crs.CodeString()), 10, 32); err == nil && n > 0 {
+			return int32(n), true
+		}
+	}
+	if org, code, ok := wktAuthority(crs.Wkt()); ok && bytes.EqualFold(org, []byte("EPSG")) {
+		if n, err := strconv.ParseInt(string(code), 10, 32); err == nil && n > 0 {
+			return int32(n), true
+		}
+	}
+	return 0, false
+}
+
+// wktAuthority returns the organization and code of the last AUTHORITY
+// or ID element nested directly in the root element of a WKT string.
+func wktAuthority(wkt []byte) (org, code []byte, ok bool) {
+	var depth, start int
+	var keyword []byte
+	var capturing bool
+	for i := 0; i < len(wkt); i++ {
+		c := wkt[i]
+		switch {
+		case c == '"':
+			// Skip quoted text. Quotes within text are doubled, which
+			// is handled by treating it as adjacent quoted texts.
+			j := bytes.IndexByte(wkt[i+1:], '"')
+			if j < 0 {
+				return nil, nil, false
+			}
+			i += j + 1
+			keyword = nil
+		case c == '[' || c == '(':
+			if depth == 1 && (bytes.EqualFold(keyword, []byte("AUTHORITY")) || bytes.EqualFold(keyword, []byte("ID"))) {
+				start, capturing = i+1, true
+			}
+			depth++
+			keyword = nil
+		case c == ']' || c == ')':
+			depth--
+			if depth == 1 && capturing {
+				if o, k, found := wktAuthorityArgs(wkt[start:i]); found {
+					org, code, ok = o, k, true
+				}
+				capturing = false
+			}
+			keyword = nil
+		case 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || c == '_' || '0' <= c && c <= '9' && keyword != nil:
+			if keyword == nil {
+				keyword = wkt[i : i+1]
+			} else {
+				keyword = wkt[i-len(keyword) : i+1]
+			}
+		default:
+			keyword = nil
+		}
+	}
+	return
+}
+
+// wktAuthorityArgs returns the first two arguments of a WKT AUTHORITY
+// or ID element, without surrounding whitespace and quotes.
+func wktAuthorityArgs(args []byte) (org, code []byte, ok bool) {
+	parts := bytes.SplitN(args, []byte(","), 3)
+	if len(parts) < 2 {
+		return nil, nil, false
+	}
+	unquote := func(b []byte) []byte {
+		return bytes.Trim(bytes.TrimSpace(b), `"`)
+	}
+	return unquote(parts[0]), unquote(parts[1]), true
+}
+
+// RewriteCRS copies the FlatGeobuf file read from rs to w, replacing the
+// coordinate reference system (CRS) recorded in its header, and copying
+// everything else verbatim. It is intended for correcting a mislabeled
+// CRS: the geometries are not reprojected.
+//
+// The new CRS table records the organization org, which may be empty to
+// mean EPSG, the numeric code, and the WKT definition wkt, which may be
+// empty if not known. Any other fields of the old CRS table, such as its
+// name, are dropped since they describe the old CRS. If org and wkt are
+// both empty and code is zero, the header's CRS is removed.
+//
+// Apart from the CRS, the header is copied field by field, so the new
+// header may differ in size from the old one. The index and data
+// sections are copied byte for byte, which is valid because the feature
+// offsets stored in the index are relative to the start of the data
+// section.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+func RewriteCRS(rs io.ReadSeeker, w io.Writer, org string, code int32, wkt string) error {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query start offset", err)
+	}
+
+	// Read the header and build its replacement.
+	r := NewFileReader(rs)
+	hdr, err := r.Header()
+	if err != nil {
+		return err
+	}
+	headerEnd, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query header end offset", err)
+	}
+	var crs func(b *flatbuffers.Builder) flatbuffers.UOffsetT
+	if org != "" || code != 0 || wkt != "" {
+		crs = func(b *flatbuffers.Builder) flatbuffers.UOffsetT {
+			orgStr := createString(b, org)
+			wktStr := createString(b, wkt)
+			flat.CrsStart(b)
+			if orgStr != 0 {
+				flat.CrsAddOrg(b, orgStr)
+			}
+			flat.CrsAddCode(b, code)
+			if wktStr != 0 {
+				flat.CrsAddWkt(b, wktStr)
+			}
+			return flat.CrsEnd(b)
+		}
+	} else {
+		crs = func(*flatbuffers.Builder) flatbuffers.UOffsetT { return 0 }
+	}
+	newHdr, err := cloneHeader(hdr, hdr.IndexNodeSize(), nil, crs)
+	if err != nil {
+		return wrapErr("failed to rewrite header", err)
+	}
+
+	// Copy the original magic number, so the file's version is
+	// preserved, followed by the new header.
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return wrapErr("failed to seek to start offset", err)
+	}
+	if _, err = io.CopyN(w, rs, magicLen); err != nil {
+		return wrapErr("failed to copy magic number", err)
+	}
+	if _, err = writeSizePrefixedTable(w, newHdr.Table()); err != nil {
+		return wrapErr("failed to write header", err)
+	}
+
+	// Copy the index and data sections.
+	if _, err = rs.Seek(headerEnd, io.SeekStart); err != nil {
+		return wrapErr("failed to seek to header end offset", err)
+	}
+	if _, err = io.Copy(w, rs); err != nil {
+		return wrapErr("failed to copy index and data sections", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderProjString(t *testing.T) {
+	t.Run("EPSG:4326", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		s, ok := HeaderProjString(hdr)
+
+		assert.True(t, ok)
+		assert.Equal(t, "+proj=longlat +datum=WGS84 +no_defs", s)
+	})
+
+	t.Run("EPSG:4269", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		s, ok := HeaderProjString(hdr)
+
+		assert.True(t, ok)
+		assert.Equal(t, "+proj=longlat +datum=NAD83 +no_defs", s)
+	})
+
+	const wkt1 = `PROJCS["NAD83 / UTM zone 10N",GEOGCS["NAD83",DATUM["North_American_Datum_1983",SPHEROID["GRS 1980",6378137,298.257222101,AUTHORITY["EPSG","7019"]],AUTHORITY["EPSG","6269"]],AUTHORITY["EPSG","4269"]],PROJECTION["Transverse_Mercator"],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AUTHORITY["EPSG","26910"]]`
+	const wkt2 = `PROJCRS["WGS 84 / UTM zone 33N",BASEGEOGCRS["WGS 84",ID["EPSG",4326]],CONVERSION["UTM zone 33N",METHOD["Transverse Mercator",ID["EPSG",9807]]],CS[Cartesian,2],ID["EPSG",32633]]`
+
+	testCases := []struct {
+		name     string
+		crs      *crsSpec
+		expected string
+		ok       bool
+	}{
+		{"NoCRS", nil, "", false},
+		{"DefaultOrg", &crsSpec{code: 3857}, "+proj=merc +a=6378137 +b=6378137 +lat_ts=0 +lon_0=0 +x_0=0 +y_0=0 +k=1 +units=m +nadgrids=@null +wktext +no_defs", true},
+		{"LowerCaseOrg", &crsSpec{org: "epsg", code: 4326}, "+proj=longlat +datum=WGS84 +no_defs", true},
+		{"UTMNorth", &crsSpec{org: "EPSG", code: 32618}, "+proj=utm +zone=18 +datum=WGS84 +units=m +no_defs", true},
+		{"UTMSouth", &crsSpec{org: "EPSG", code: 32760}, "+proj=utm +zone=60 +south +datum=WGS84 +units=m +no_defs", true},
+		{"Init", &crsSpec{org: "EPSG", code: 2193}, "+init=EPSG:2193", true},
+		{"CodeString", &crsSpec{org: "EPSG", codeString: "27700"}, "+init=EPSG:27700", true},
+		{"OtherOrg", &crsSpec{org: "ESRI", code: 102003}, "", false},
+		{"UnknownCode", &crsSpec{org: "EPSG"}, "", false},
+		{"WKT1", &crsSpec{wkt: wkt1}, "+init=EPSG:26910", true},
+		{"WKT2", &crsSpec{org: "ESRI", code: 102003, wkt: wkt2}, "+proj=utm +zone=33 +datum=WGS84 +units=m +no_defs", true},
+		{"WKTNoAuthority", &crsSpec{wkt: `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]]]]`}, "", false},
+		{"WKTOtherOrg", &crsSpec{wkt: `PROJCS["USA_Contiguous_Albers_Equal_Area_Conic",AUTHORITY["ESRI","102003"]]`}, "", false},
+		{"WKTMalformed", &crsSpec{wkt: `GEOGCS["WGS 84,AUTHORITY["EPSG","4326"]`}, "", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			hdr := headerSpec{crs: testCase.crs}.build()
+
+			s, ok := HeaderProjString(hdr)
+
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.expected, s)
+		})
+	}
+}
+
+func TestRewriteCRS(t *testing.T) {
+	file := readTestFile(t, "countries.fgb")
+	headerEnd := func(b []byte) int {
+		return magicLen + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(b[magicLen:]))
+	}
+	readHeader := func(t *testing.T, b []byte) (*FileReader, *flat.Header) {
+		r := NewFileReader(bytes.NewReader(b))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		return r, hdr
+	}
+	_, origHdr := readHeader(t, file)
+	origCols, err := SchemaColumns(origHdr)
+	require.NoError(t, err)
+
+	t.Run("Replace", func(t *testing.T) {
+		const wkt = `PROJCS["WGS 84 / Pseudo-Mercator",AUTHORITY["EPSG","3857"]]`
+		var buf bytes.Buffer
+
+		err := RewriteCRS(bytes.NewReader(file), &buf, "EPSG", 3857, wkt)
+
+		require.NoError(t, err)
+		out := buf.Bytes()
+		assert.Equal(t, file[:magicLen], out[:magicLen])
+		assert.Equal(t, file[headerEnd(file):], out[headerEnd(out):], "index and data must be byte-identical")
+		r, hdr := readHeader(t, out)
+		var crs flat.Crs
+		require.NotNil(t, hdr.Crs(&crs))
+		assert.Equal(t, "EPSG", string(crs.Org()))
+		assert.Equal(t, int32(3857), crs.Code())
+		assert.Equal(t, wkt, string(crs.Wkt()))
+		assert.Nil(t, crs.Name())
+		assert.Equal(t, origHdr.Name(), hdr.Name())
+		assert.Equal(t, origHdr.GeometryType(), hdr.GeometryType())
+		assert.Equal(t, origHdr.FeaturesCount(), hdr.FeaturesCount())
+		assert.Equal(t, origHdr.IndexNodeSize(), hdr.IndexNodeSize())
+		cols, err := SchemaColumns(hdr)
+		require.NoError(t, err)
+		assert.Equal(t, origCols, cols)
+		require.NoError(t, r.VerifyIndexConsistency())
+		s, ok := HeaderProjString(hdr)
+		assert.True(t, ok)
+		assert.Contains(t, s, "+proj=merc")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := RewriteCRS(bytes.NewReader(file), &buf, "", 0, "")
+
+		require.NoError(t, err)
+		out := buf.Bytes()
+		assert.Equal(t, file[headerEnd(file):], out[headerEnd(out):])
+		_, hdr := readHeader(t, out)
+		assert.Nil(t, hdr.Crs(nil))
+	})
+
+	t.Run("NotAtStart", func(t *testing.T) {
+		rs := bytes.NewReader(append([]byte("junk"), file...))
+		_, err := rs.Seek(4, io.SeekStart)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+
+		err = RewriteCRS(rs, &buf, "", 4326, "")
+
+		require.NoError(t, err)
+		_, hdr := readHeader(t, buf.Bytes())
+		s, ok := HeaderProjString(hdr)
+		assert.True(t, ok)
+		assert.Equal(t, "+proj=longlat +datum=WGS84 +no_defs", s)
+	})
+
+	t.Run("NotFlatGeobuf", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := RewriteCRS(bytes.NewReader([]byte("not a flatgeobuf file")), &buf, "EPSG", 4326, "")
+
+		assert.Error(t, err)
+		assert.Equal(t, 0, buf.Len())
+	})
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// DensifyGeometry builds a copy of a geometry into a FlatBuffers builder,
+// inserting intermediate vertices so that no segment of the copy is
+// longer than maxSegLen. It returns the offset of the new geometry table
+// within the builder, which the caller can then add to a feature table
+// or finish as a root table.
+//
+// Any segment longer than maxSegLen is split into the smallest number
+// of equal-length sub-segments that are no longer than maxSegLen.
+// Segment lengths are measured in the XY plane, and Z, M, T, and TM
+// values of the inserted vertices are linearly interpolated. Segments
+// are only formed between consecutive vertices within the same part or
+// ring, as delimited by the geometry's Ends array, and the Ends array
+// and nested parts of the copy are adjusted to preserve the structure
+// of the original. Point and MultiPoint geometries have no segments and
+// are copied unchanged. All other geometry types are treated as
+// sequences of connected vertices.
+//
+// A geometry whose type is Unknown can't be densified, since its
+// vertices may be separate points rather than connected ones. Since a
+// FlatGeobuf file whose features all have the same type records the
+// type only in the header, the feature geometries of such a file have
+// the Unknown type; use DensifyGeometryWithType to densify them.
+//
+// Densification is useful before reprojecting geometries, since a long
+// straight segment in one coordinate reference system is generally not
+// straight in another.
+//
+// An error is returned if maxSegLen is not a positive finite number, if
+// the geometry or one of its parts has the Unknown type, if a segment
+// has a non-finite length, for example because a coordinate
+// is NaN, if the densified copy of the geometry or of one of its parts
+// would have more than MaxDensifiedVertices vertices, or if the
+// geometry's FlatBuffers data is malformed. If an error occurs after
+// building has started, the builder is left in an undefined state and
+// should be reset before reuse.
+func DensifyGeometry(g *flat.Geometry, builder *flatbuffers.Builder, maxSegLen float64) (flatbuffers.UOffsetT, error) {
+	return DensifyGeometryWithType(g, flat.GeometryTypeUnknown, builder, maxSegLen)
+}
+
+// DensifyGeometryWithType is like DensifyGeometry, but densifies the
+// geometry as if it had type typ if its own type is Unknown. Parameter
+// typ should normally be the header geometry type, as returned by
+// flat.Header.GeometryType. If the geometry's own type is not Unknown,
+// typ is ignored. The parts of a MultiLineString whose type is Unknown
+// are densified as line strings, those of a MultiPolygon or
+// PolyhedralSurface as polygons, and those of a TIN as triangles. The
+// type of the copy, and of each of its parts, is the same as that of
+// the original, so the copy remains consistent with the header.
+func DensifyGeometryWithType(g *flat.Geometry, typ flat.GeometryType, builder *flatbuffers.Builder, maxSegLen float64) (offset flatbuffers.UOffsetT, err error) {
+	if g == nil {
+		textPanic("nil geometry")
+	} else if builder == nil {
+		textPanic("nil builder")
+	} else if !(maxSegLen > 0) || math.IsInf(maxSegLen, 1) {
+		return 0, fmtErr("max segment length %g not allowed (must be positive and finite)", maxSegLen)
+	}
+	err = safeFlatBuffersInteraction(func() (err error) {
+		offset, err = densifyGeometry(g, typ, builder, maxSegLen)
+		return
+	})
+	if err != nil {
+		return 0, wrapErr("failed to densify geometry", err)
+	}
+	return
+}
+
+// densifyGeometry is the recursive implementation of
+// DensifyGeometryWithType.
+func densifyGeometry(g *flat.Geometry, typ flat.GeometryType, b *flatbuffers.Builder, maxSegLen float64) (flatbuffers.UOffsetT, error) {
+	if t := g.Type(); t != flat.GeometryTypeUnknown {
+		typ = t
+	} else if typ == flat.GeometryTypeUnknown {
+		return 0, fmt.Errorf("unknown geometry type")
+	}
+
+	// Build the parts first, since nested tables can't be built while
+	// the geometry table is under construction.
+	var parts flatbuffers.UOffsetT
+	if n := g.PartsLength(); n > 0 {
+		offsets := make([]flatbuffers.UOffsetT, 0, n)
+		for i := 0; i < n; i++ {
+			var part flat.Geometry
+			if g.Parts(&part, i) {
+				offset, err := densifyGeometry(&part, partType(typ), b, maxSegLen)
+				if err != nil {
+					return 0, fmt.Errorf("part %d: %w", i, err)
+				}
+				offsets = append(offsets, offset)
+			}
+		}
+		flat.GeometryStartPartsVector(b, len(offsets))
+		for i := len(offsets) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(offsets[i])
+		}
+		parts = b.EndVector(len(offsets))
+	}
+
+	// Densify the vertices.
+	var v vertices
+	if err := v.densify(g, typ, maxSegLen); err != nil {
+		return 0, err
+	}
+
+	// Build the vectors.
+	var ends, xy, z, m, t, tm flatbuffers.UOffsetT
+	if len(v.ends) > 0 {
+		flat.GeometryStartEndsVector(b, len(v.ends))
+		for i := len(v.ends) - 1; i >= 0; i-- {
+			b.PrependUint32(v.ends[i])
+		}
+		ends = b.EndVector(len(v.ends))
+	}
+	xy = buildFloat64Vector(b, flat.GeometryStartXyVector, v.xy)
+	z = buildFloat64Vector(b, flat.GeometryStartZVector, v.z)
+	m = buildFloat64Vector(b, flat.GeometryStartMVector, v.m)
+	t = buildFloat64Vector(b, flat.GeometryStartTVector, v.t)
+	if len(v.tm) > 0 {
+		flat.GeometryStartTmVector(b, len(v.tm))
+		for i := len(v.tm) - 1; i >= 0; i-- {
+			b.PrependUint64(v.tm[i])
+		}
+		tm = b.EndVector(len(v.tm))
+	}
+
+	// Build the geometry table.
+	flat.GeometryStart(b)
+	if ends != 0 {
+		flat.GeometryAddEnds(b, ends)
+	}
+	if xy != 0 {
+		flat.GeometryAddXy(b, xy)
+	}
+	if z != 0 {
+		flat.GeometryAddZ(b, z)
+	}
+	if m != 0 {
+		flat.GeometryAddM(b, m)
+	}
+	if t != 0 {
+		flat.GeometryAddT(b, t)
+	}
+	if tm != 0 {
+		flat.GeometryAddTm(b, tm)
+	}
+	flat.GeometryAddType(b, g.Type())
+	if parts != 0 {
+		flat.GeometryAddParts(b, parts)
+	}
+	return flat.GeometryEnd(b), nil
+}
+
+// buildFloat64Vector builds a vector of float64 values, returning its
+// offset, or zero if the vector is empty.
+func buildFloat64Vector(b *flatbuffers.Builder, start func(*flatbuffers.Builder, int) flatbuffers.UOffsetT, v []float64) flatbuffers.UOffsetT {
+	if len(v) == 0 {
+		return 0
+	}
+	start(b, len(v))
+	for i := len(v) - 1; i >= 0; i-- {
+		b.PrependFloat64(v[i])
+	}
+	return b.EndVector(len(v))
+}
+
+// MaxDensifiedVertices is the maximum number of vertices DensifyGeometry
+// allows in the densified copy of a geometry or of any of its parts,
+// not counting the vertices of nested parts. It is the largest vertex
+// count whose XY vector fits in a FlatBuffers buffer, which is limited
+// to 2 GiB.
+const MaxDensifiedVertices = math.MaxInt32 / (2 * flatbuffers.SizeFloat64)
+
+// vertices accumulates the vertex data of a densified geometry.
+type vertices struct {
+	ends                    []uint32
+	xy, z, m, t             []float64
+	tm                      []uint64
+	hasZ, hasM, hasT, hasTM bool
+}
+
+// densify appends the densified vertices of a geometry of type typ,
+// excluding its parts. It returns an error if a segment length is not finite or the
+// number of vertices would exceed MaxDensifiedVertices.
+func (v *vertices) densify(g *flat.Geometry, typ flat.GeometryType, maxSegLen float64) error {
+	n := g.XyLength() / 2
+	v.hasZ, v.hasM, v.hasT, v.hasTM = g.ZLength() > 0, g.MLength() > 0, g.TLength() > 0, g.TmLength() > 0
+
+	// Points have no segments, so are copied as is.
+	if typ == flat.GeometryTypePoint || typ == flat.GeometryTypeMultiPoint {
+		for i := 0; i < n; i++ {
+			v.add(g, i, i, 0)
+		}
+		for i := 0; i < g.EndsLength(); i++ {
+			v.ends = append(v.ends, g.Ends(i))
+		}
+		return nil
+	}
+
+	// Densify each ring or part separately. If there is no Ends array,
+	// all the vertices form a single ring or part.
+	numEnds := g.EndsLength()
+	numRings := numEnds
+	if numRings == 0 {
+		numRings = 1
+	}
+	start := 0
+	for k := 0; k < numRings; k++ {
+		end := n
+		if numEnds > 0 {
+			end = int(g.Ends(k))
+		}
+		for i := start; i < end; i++ {
+			// Each vertex adds itself plus the vertices inserted into the
+			// segment leading to it.
+			segs := 1.0
+			if i > start {
+				dx, dy := g.Xy(2*i)-g.Xy(2*i-2), g.Xy(2*i+1)-g.Xy(2*i-1)
+				segs = math.Ceil(math.Hypot(dx, dy) / maxSegLen)
+				if math.IsNaN(segs) || math.IsInf(segs, 0) {
+					return fmt.Errorf("segment from vertex %d to %d has non-finite length", i-1, i)
+				}
+			}
+			if segs > float64(MaxDensifiedVertices-len(v.xy)/2) {
+				return fmt.Errorf("densified vertex count exceeds limit of %d at vertex %d", MaxDensifiedVertices, i)
+			}
+			for j := 1; j < int(segs); j++ {
+				v.add(g, i-1, i, float64(j)/segs)
+			}
+			v.add(g, i, i, 0)
+		}
+		if numEnds > 0 {
+			v.ends = append(v.ends, uint32(len(v.xy)/2))
+		}
+		start = end
+	}
+	return nil
+}
+
+// add appends a vertex interpolated at fraction f of the way between
+// the vertices at indices i and j of a geometry.
+func (v *vertices) add(g *flat.Geometry, i, j int, f float64) {
+	v.xy = append(v.xy, lerp(g.Xy(2*i), g.Xy(2*j), f), lerp(g.Xy(2*i+1), g.Xy(2*j+1), f))
+	if v.hasZ {
+		v.z = append(v.z, lerp(g.Z(i), g.Z(j), f))
+	}
+	if v.hasM {
+		v.m = append(v.m, lerp(g.M(i), g.M(j), f))
+	}
+	if v.hasT {
+		v.t = append(v.t, lerp(g.T(i), g.T(j), f))
+	}
+	if v.hasTM {
+		a, b := g.Tm(i), g.Tm(j)
+		if b >= a {
+			v.tm = append(v.tm, a+uint64(float64(b-a)*f))
+		} else {
+			v.tm = append(v.tm, a-uint64(float64(a-b)*f))
+		}
+	}
+}
+
+// lerp linearly interpolates between a and b.
+func lerp(a, b, f float64) float64 {
+	if f == 0 {
+		return a
+	}
+	return a + (b-a)*f
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDensifyGeometry(t *testing.T) {
+	densify := func(t *testing.T, gs geometrySpec, maxSegLen float64) *flat.Geometry {
+		b := flatbuffers.NewBuilder(0)
+		offset, err := DensifyGeometry(testGeometry(gs), b, maxSegLen)
+		require.NoError(t, err)
+		b.Finish(offset)
+		return flat.GetRootAsGeometry(b.FinishedBytes(), 0)
+	}
+	xyOf := func(g *flat.Geometry) []float64 {
+		xy := make([]float64, g.XyLength())
+		for i := range xy {
+			xy[i] = g.Xy(i)
+		}
+		return xy
+	}
+	endsOf := func(g *flat.Geometry) []uint32 {
+		var ends []uint32
+		for i := 0; i < g.EndsLength(); i++ {
+			ends = append(ends, g.Ends(i))
+		}
+		return ends
+	}
+
+	t.Run("LongSegment", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 10, 0, 10, 1}}
+
+		g := densify(t, gs, 3)
+
+		assert.Equal(t, flat.GeometryTypeLineString, g.Type())
+		assert.Equal(t, []float64{0, 0, 2.5, 0, 5, 0, 7.5, 0, 10, 0, 10, 1}, xyOf(g))
+		assert.Nil(t, endsOf(g))
+	})
+
+	t.Run("ExactLength", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 3, 4}}
+
+		g := densify(t, gs, 5)
+
+		assert.Equal(t, []float64{0, 0, 3, 4}, xyOf(g))
+	})
+
+	t.Run("Diagonal", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 3, 4}}
+
+		g := densify(t, gs, 2)
+
+		assert.Equal(t, 8, g.XyLength())
+		assert.InDeltaSlice(t, []float64{0, 0, 1, 4.0 / 3, 2, 8.0 / 3, 3, 4}, xyOf(g), 1e-12)
+	})
+
+	t.Run("Rings", func(t *testing.T) {
+		gs := geometrySpec{
+			typ: flat.GeometryTypePolygon,
+			xy: []float64{
+				0, 0, 4, 0, 4, 4, 0, 4, 0, 0, // Exterior ring, segments of length 4.
+				1, 1, 2, 1, 2, 2, 1, 1, // Interior ring, short segments.
+			},
+			ends: []uint32{5, 9},
+		}
+
+		g := densify(t, gs, 2)
+
+		assert.Equal(t, []uint32{9, 13}, endsOf(g))
+		assert.Equal(t, []float64{
+			0, 0, 2, 0, 4, 0, 4, 2, 4, 4, 2, 4, 0, 4, 0, 2, 0, 0,
+			1, 1, 2, 1, 2, 2, 1, 1,
+		}, xyOf(g))
+	})
+
+	t.Run("Parts", func(t *testing.T) {
+		gs := geometrySpec{
+			typ: flat.GeometryTypeMultiLineString,
+			parts: []geometrySpec{
+				{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 0, 3}},
+				{typ: flat.GeometryTypeLineString, xy: []float64{5, 5, 6, 5}},
+			},
+		}
+
+		g := densify(t, gs, 1)
+
+		assert.Equal(t, flat.GeometryTypeMultiLineString, g.Type())
+		require.Equal(t, 2, g.PartsLength())
+		var part flat.Geometry
+		require.True(t, g.Parts(&part, 0))
+		assert.Equal(t, []float64{0, 0, 0, 1, 0, 2, 0, 3}, xyOf(&part))
+		require.True(t, g.Parts(&part, 1))
+		assert.Equal(t, []float64{5, 5, 6, 5}, xyOf(&part))
+	})
+
+	t.Run("MultiPoint", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeMultiPoint, xy: []float64{0, 0, 100, 100}}
+
+		g := densify(t, gs, 1)
+
+		assert.Equal(t, []float64{0, 0, 100, 100}, xyOf(g))
+	})
+
+	t.Run("WithType", func(t *testing.T) {
+		densifyWithType := func(t *testing.T, gs geometrySpec, typ flat.GeometryType, maxSegLen float64) *flat.Geometry {
+			b := flatbuffers.NewBuilder(0)
+			offset, err := DensifyGeometryWithType(testGeometry(gs), typ, b, maxSegLen)
+			require.NoError(t, err)
+			b.Finish(offset)
+			return flat.GetRootAsGeometry(b.FinishedBytes(), 0)
+		}
+
+		t.Run("MultiPoint", func(t *testing.T) {
+			gs := geometrySpec{xy: []float64{0, 0, 10, 0}}
+
+			g := densifyWithType(t, gs, flat.GeometryTypeMultiPoint, 1)
+
+			assert.Equal(t, flat.GeometryTypeUnknown, g.Type())
+			assert.Equal(t, []float64{0, 0, 10, 0}, xyOf(g))
+		})
+
+		t.Run("LineString", func(t *testing.T) {
+			gs := geometrySpec{xy: []float64{0, 0, 3, 0}}
+
+			g := densifyWithType(t, gs, flat.GeometryTypeLineString, 1)
+
+			assert.Equal(t, flat.GeometryTypeUnknown, g.Type())
+			assert.Equal(t, []float64{0, 0, 1, 0, 2, 0, 3, 0}, xyOf(g))
+		})
+
+		t.Run("UnknownParts", func(t *testing.T) {
+			gs := geometrySpec{parts: []geometrySpec{{xy: []float64{0, 0, 0, 2}}}}
+
+			g := densifyWithType(t, gs, flat.GeometryTypeMultiLineString, 1)
+
+			require.Equal(t, 1, g.PartsLength())
+			var part flat.Geometry
+			require.True(t, g.Parts(&part, 0))
+			assert.Equal(t, flat.GeometryTypeUnknown, part.Type())
+			assert.Equal(t, []float64{0, 0, 0, 1, 0, 2}, xyOf(&part))
+		})
+
+		t.Run("OwnTypeWins", func(t *testing.T) {
+			gs := geometrySpec{typ: flat.GeometryTypeMultiPoint, xy: []float64{0, 0, 10, 0}}
+
+			g := densifyWithType(t, gs, flat.GeometryTypeLineString, 1)
+
+			assert.Equal(t, []float64{0, 0, 10, 0}, xyOf(g))
+		})
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		gs := geometrySpec{xy: []float64{0, 0, 10, 0}}
+
+		_, err := DensifyGeometry(testGeometry(gs), flatbuffers.NewBuilder(0), 1)
+
+		assert.EqualError(t, err, "flatgeobuf: failed to densify geometry: unknown geometry type")
+	})
+
+	t.Run("UnknownCollectionPart", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeGeometryCollection, parts: []geometrySpec{
+			{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1, 0}},
+			{xy: []float64{0, 0, 10, 0}},
+		}}
+
+		_, err := DensifyGeometry(testGeometry(gs), flatbuffers.NewBuilder(0), 1)
+
+		assert.EqualError(t, err, "flatgeobuf: failed to densify geometry: part 1: unknown geometry type")
+	})
+
+	t.Run("InterpolateZ", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 4, 0}, z: []float64{10, 30}}
+
+		g := densify(t, gs, 1)
+
+		require.Equal(t, 5, g.ZLength())
+		z := make([]float64, g.ZLength())
+		for i := range z {
+			z[i] = g.Z(i)
+		}
+		assert.Equal(t, []float64{10, 15, 20, 25, 30}, z)
+	})
+
+	t.Run("InvalidMaxSegLen", func(t *testing.T) {
+		for _, maxSegLen := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+			_, err := DensifyGeometry(testGeometry(geometrySpec{}), flatbuffers.NewBuilder(0), maxSegLen)
+
+			assert.ErrorContains(t, err, "flatgeobuf: max segment length ")
+		}
+	})
+
+	t.Run("NonFiniteSegment", func(t *testing.T) {
+		for _, x := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+			gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, x, 0}}
+
+			_, err := DensifyGeometry(testGeometry(gs), flatbuffers.NewBuilder(0), 1)
+
+			assert.EqualError(t, err, "flatgeobuf: failed to densify geometry: segment from vertex 0 to 1 has non-finite length")
+		}
+	})
+
+	t.Run("TooManyVertices", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1, 0, math.MaxFloat64, 0}}
+
+		_, err := DensifyGeometry(testGeometry(gs), flatbuffers.NewBuilder(0), 1)
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to densify geometry: densified vertex count exceeds limit of %d at vertex 2", MaxDensifiedVertices))
+	})
+
+	t.Run("TooManyVerticesInPart", func(t *testing.T) {
+		gs := geometrySpec{typ: flat.GeometryTypeMultiLineString, parts: []geometrySpec{
+			{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1, 0}},
+			{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1e300, 0}},
+		}}
+
+		_, err := DensifyGeometry(testGeometry(gs), flatbuffers.NewBuilder(0), 1)
+
+		assert.ErrorContains(t, err, "flatgeobuf: failed to densify geometry: part 1: densified vertex count exceeds limit")
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		g := flat.GetRootAsGeometry([]byte{0xff, 0xff, 0xff, 0x7f}, 0)
+
+		_, err := DensifyGeometry(g, flatbuffers.NewBuilder(0), 1)
+
+		assert.ErrorContains(t, err, "flatgeobuf: failed to densify geometry: ")
+	})
+}
@@ -16,6 +16,13 @@ var (
 	// ErrClosed is returned when attempting to perform an operation on
 	// a FileReader or FileWriter which has been closed.
 	ErrClosed = textErr("closed")
+	// ErrFeatureCountOverflow is returned, wrapped in an error giving
+	// the count and the limit, when a FlatGeobuf header records more
+	// features than fit in an int on the current platform. This can
+	// only happen on 32-bit platforms, where the limit is 2,147,483,647
+	// features, so the file may still be readable on a 64-bit platform.
+	// Use errors.Is to detect it.
+	ErrFeatureCountOverflow = textErr("feature count overflow")
 
 	errEndOfData       = textErr("end of data section")
 	errUnexpectedState = textErr("unexpected state")
@@ -51,3 +58,7 @@ func textPanic(text string) {
 func fmtPanic(format string, a ...interface{}) {
 	panic(fmt.Sprintf(packageName+format, a...))
 }
+
+func featureCountOverflowErr(numFeatures uint64) error {
+	return fmt.Errorf("%w: %d features exceeds platform limit of %d", ErrFeatureCountOverflow, numFeatures, maxFeatureCount)
+}
@@ -5,9 +5,16 @@
 package flatgeobuf
 
 import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"math"
 	"sort"
+	"sync/atomic"
 
 	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
 
@@ -17,9 +24,55 @@ import (
 
 // FileReader reads an underlying stream as a FlatGeobuf file.
 //
+// A FileReader is not safe for concurrent use, since every read moves
+// its position in the underlying stream. As a safeguard, methods which
+// access the reader's state panic if they are called while another
+// such call is in progress on a different goroutine. The check is not
+// a substitute for synchronization: it catches overlapping calls, but
+// not unsynchronized calls which happen not to overlap.
+//
 // TODO: Write docs.
 type FileReader struct {
 	stateful
+	// MaxVertices, if positive, limits the number of XY vertices a
+	// feature's geometry may contain, counting all of its parts. When a
+	// feature exceeding the limit is read, the read fails with an error
+	// and the feature is not returned, but the reader remains usable and
+	// is positioned at the next feature.
+	//
+	// Since the vertex count is determined from the vector lengths
+	// recorded in the geometry tables, without iterating over the
+	// coordinates, the limit protects helpers which walk feature
+	// geometries, such as FeatureBounds, from malicious files that
+	// declare enormous geometries. The zero value means no limit.
+	MaxVertices int
+	// MaxHeaderLen, if positive, limits the length in bytes of the
+	// FlatGeobuf header the reader will accept. The FlatGeobuf
+	// specification imposes no limit, but reading a header requires
+	// allocating a buffer of the declared length, so a limit protects
+	// against corrupted or malicious files. The zero value means the
+	// default limit of 32 MiB.
+	MaxHeaderLen int
+	// DeferEOF, if true, stops Data and DataBatch from returning io.EOF
+	// together with the last features of a file whose header records
+	// the feature count. Instead, the last features are returned with a
+	// nil error and the reader remains in the data section, so the
+	// caller decides when to finish reading: the next call returns no
+	// features and io.EOF. This matches the behaviour for files whose
+	// feature count is unknown, where the end of the data section is
+	// only detected by reading past it.
+	DeferEOF bool
+	// VerifyTables, if true, makes the reader check the FlatBuffers
+	// table of each feature as it is read, returning an error for a
+	// malformed feature instead of returning a feature whose accessors
+	// panic later on. The check verifies that the root table and its
+	// vtable lie within the feature's bytes, then decodes every field as
+	// DataBestEffort does. Like a vertex limit error, a verification
+	// error does not prevent the reader from reading the next feature.
+	//
+	// Verification costs a pass over each feature's fields, so it is
+	// off by default and is mainly useful for untrusted input.
+	VerifyTables bool
 	// r is the stream to read from. It may also implement io.Seeker,
 	// enabling a wider range of behaviours, but is not required to.
 	r io.Reader
@@ -48,6 +101,22 @@ type FileReader struct {
 	// featureOffset is the offset into the data section of the next
 	// feature to read, a non-negative integer.
 	featureOffset int64
+	// externalIndex indicates that the spatial index was loaded from a
+	// separate stream by NewFileReaderWithIndex, and is not present in
+	// the stream r.
+	externalIndex bool
+	// countedFeatures caches the number of features counted by
+	// CountFeatures for a file whose header does not record the feature
+	// count. Zero means the features have not been counted; since an
+	// empty data section is cheap to count, the zero count is not
+	// cached.
+	countedFeatures int
+	// inUse is set while a method which accesses the reader's state is
+	// executing, to detect concurrent use. See acquire.
+	inUse atomic.Bool
+	// lenBuf is scratch space for reading feature length prefixes
+	// without allocating.
+	lenBuf [flatbuffers.SizeUint32]byte
 }
 
 // NewFileReader creates a new FlatGeobuf reader based on an underlying
@@ -59,8 +128,45 @@ func NewFileReader(r io.Reader) *FileReader {
 	return &FileReader{r: r}
 }
 
+// NewFileReaderWithIndex creates a new FlatGeobuf reader which reads
+// the header and features from one stream, data, and the spatial index
+// from a separate stream, index. This supports workflows which store a
+// FlatGeobuf file without an index alongside a sidecar file containing
+// the packed Hilbert R-Tree, for example as written by
+// packedrtree.PackedRTree.Marshal.
+//
+// The index is read immediately, using the given feature count and
+// node size, and an error is returned if it can't be read. The data
+// stream must contain a complete FlatGeobuf file with no index section,
+// i.e. its header must have an index node size of zero. If the header
+// records a feature count, it must agree with numFeatures.
+//
+// Apart from where the index comes from, the returned reader behaves
+// like one created by NewFileReader. In particular, Index returns the
+// external index, and IndexSearch uses it to locate features in the
+// data stream.
+func NewFileReaderWithIndex(data io.Reader, index io.Reader, numFeatures int, nodeSize uint16) (*FileReader, error) {
+	if data == nil {
+		textPanic("nil data reader")
+	} else if index == nil {
+		textPanic("nil index reader")
+	} else if numFeatures < 1 {
+		return nil, fmtErr("external index feature count %d not allowed (must be at least 1)", numFeatures)
+	} else if nodeSize < 2 {
+		return nil, fmtErr("external index node size %d not allowed (must be at least 2)", nodeSize)
+	}
+	prt, err := packedrtree.Unmarshal(index, numFeatures, nodeSize)
+	if err != nil {
+		return nil, wrapErr("failed to read external index", err)
+	}
+	return &FileReader{r: data, cachedIndex: prt, externalIndex: true}, nil
+}
+
 // TODO: Write docs.
 func (r *FileReader) Header() (*flat.Header, error) {
+	r.acquire()
+	defer r.release()
+
 	// Transition into state for reading magic number.
 	if err := r.toState(uninitialized, beforeMagic); err == errUnexpectedState {
 		return nil, textErr(errHeaderAlreadyCalled)
@@ -91,8 +197,8 @@ func (r *FileReader) Header() (*flat.Header, error) {
 	headerLen := flatbuffers.GetUint32(b)
 	if headerLen < flatbuffers.SizeUOffsetT {
 		return nil, r.toErr(fmtErr("header length %d not big enough for FlatBuffer uoffset_t", headerLen))
-	} else if headerLen > headerMaxLen {
-		return nil, r.toErr(fmtErr("header length %d exceeds limit of %d bytes", headerLen, headerMaxLen))
+	} else if maxLen := r.maxHeaderLen(); int64(headerLen) > int64(maxLen) {
+		return nil, r.toErr(fmtErr("header length %d exceeds limit of %d bytes", headerLen, maxLen))
 	}
 
 	// Read the header bytes.
@@ -120,8 +226,8 @@ func (r *FileReader) Header() (*flat.Header, error) {
 	// as a signed integer with platform-specific bit size. If there's
 	// an error here, we still return the header in case caller still
 	// wants to interact with it.
-	if numFeatures > math.MaxInt {
-		return hdr, r.toErr(fmtErr("header feature count %d overflows limit of %d features", numFeatures, math.MaxInt))
+	if numFeatures > maxFeatureCount {
+		return hdr, r.toErr(featureCountOverflowErr(numFeatures))
 	}
 
 	// Check for an invalid index node size. If there's an error here,
@@ -131,6 +237,26 @@ func (r *FileReader) Header() (*flat.Header, error) {
 		return hdr, r.toErr(textErr("header index node size 1 not allowed"))
 	}
 
+	// If the index comes from a separate stream, ensure the data stream
+	// doesn't have its own index, and take the feature count and node
+	// size from the external index. Since the data stream has no index
+	// section, the data section begins immediately after the header.
+	if r.externalIndex {
+		if nodeSize != 0 {
+			return hdr, r.toErr(fmtErr("header index node size %d not allowed with external index (must be 0)", nodeSize))
+		} else if numFeatures != 0 && int(numFeatures) != r.cachedIndex.NumRefs() {
+			return hdr, r.toErr(fmtErr("feature count mismatch (header=%d, external index=%d)", numFeatures, r.cachedIndex.NumRefs()))
+		}
+		numFeatures = uint64(r.cachedIndex.NumRefs())
+		nodeSize = r.cachedIndex.NodeSize()
+		if err = r.saveIndexOffset(nil); err != nil {
+			return nil, err
+		}
+		if err = r.saveDataOffset(nil); err != nil {
+			return nil, err
+		}
+	}
+
 	// Store feature count and node size.
 	r.numFeatures = int(numFeatures)
 	r.nodeSize = nodeSize
@@ -144,8 +270,24 @@ func (r *FileReader) Header() (*flat.Header, error) {
 	return hdr, nil
 }
 
+// maxHeaderLen returns the header length limit in effect, which is
+// MaxHeaderLen if positive and the package default otherwise.
+func (r *FileReader) maxHeaderLen() int {
+	if r.MaxHeaderLen > 0 {
+		return r.MaxHeaderLen
+	}
+	return headerMaxLen
+}
+
 // TODO: Write docs.
 func (r *FileReader) Index() (*packedrtree.PackedRTree, error) {
+	r.acquire()
+	defer r.release()
+	return r.index()
+}
+
+// index implements Index without acquiring the reader.
+func (r *FileReader) index() (*packedrtree.PackedRTree, error) {
 	// Transition into state for reading index.
 	if err := r.toState(afterHeader, beforeIndex); err == errUnexpectedState {
 		return nil, r.indexStateErr(r.state)
@@ -167,10 +309,15 @@ func (r *FileReader) Index() (*packedrtree.PackedRTree, error) {
 	// call read and cached the index. In this case, we can seek the
 	// read cursor forward to the data section and return the cached
 	// index.
+	//
+	// If the index is external, it is always cached, and the read
+	// cursor only needs to be moved if the reader was rewound.
 	if r.cachedIndex != nil {
-		s = r.r.(io.Seeker)
-		if _, err := s.Seek(r.dataOffset, io.SeekStart); err != nil {
-			return nil, r.toErr(wrapErr("failed to seek past cached index", err))
+		if r.dataOffset > 0 {
+			s = r.r.(io.Seeker)
+			if _, err := s.Seek(r.dataOffset, io.SeekStart); err != nil {
+				return nil, r.toErr(wrapErr("failed to seek past cached index", err))
+			}
 		}
 		if err := r.toState(beforeIndex, afterIndex); err != nil {
 			return nil, err
@@ -202,8 +349,12 @@ func (r *FileReader) Index() (*packedrtree.PackedRTree, error) {
 		return nil, r.toErr(wrapErr("failed to read index", err))
 	}
 
-	// Cache the index for use after future Rewind().
+	// Cache the index for use after future Rewind(), and save the
+	// data section offset so the cached index can be skipped.
 	r.cachedIndex = prt
+	if err = r.saveDataOffset(s); err != nil {
+		return nil, err
+	}
 
 	// Transition into state for reading feature data.
 	if err = r.toState(beforeIndex, afterIndex); err != nil {
@@ -216,6 +367,9 @@ func (r *FileReader) Index() (*packedrtree.PackedRTree, error) {
 
 // TODO: Write docs.
 func (r *FileReader) IndexSearch(b packedrtree.Box) ([]flat.Feature, error) {
+	r.acquire()
+	defer r.release()
+
 	// Searches are only allowed if the reader is positioned immediately
 	// after the header, either as a result of a Rewind(), or because of
 	// a successful call to Header() immediately before.
@@ -258,10 +412,17 @@ func (r *FileReader) IndexSearch(b packedrtree.Box) ([]flat.Feature, error) {
 			}
 		}
 	} else if r.cachedIndex == nil {
-		// Force caching the index.
-		if _, err := r.Index(); err != nil {
-			return nil, err
+		// Without the ability to seek, the whole index must be read
+		// into memory to search it. Cache it, as Index() would.
+		prt, err := packedrtree.Unmarshal(r.r, r.numFeatures, r.nodeSize)
+		if err != nil {
+			return nil, r.toErr(wrapErr("failed to read index", err))
 		}
+		r.cachedIndex = prt
+		sr = prt.Search(b)
+	} else if r.externalIndex {
+		// The index is external, so the reader is already positioned
+		// at the start of the data section.
 		sr = r.cachedIndex.Search(b)
 	} else {
 		textPanic("logic error: index should not be cached")
@@ -332,33 +493,17 @@ func (r *FileReader) IndexSearch(b packedrtree.Box) ([]flat.Feature, error) {
 
 // TODO: Write docs.
 func (r *FileReader) Data(p []flat.Feature) (int, error) {
-	if r.err != nil {
-		return 0, r.err
-	}
-
-	if r.state == afterHeader {
-		if err := r.skipIndex(); err != nil {
-			return 0, err
-		}
-	}
-
-	if r.state == afterIndex {
-		if err := r.saveDataOffset(nil); err != nil {
-			return 0, err
-		}
-		r.state = inData
-	}
-
-	if r.state == eof {
-		return 0, io.EOF
-	}
+	r.acquire()
+	defer r.release()
+	return r.data(p)
+}
 
-	if r.state == uninitialized {
-		return 0, textErr(errHeaderNotCalled)
+// data implements Data without acquiring the reader.
+func (r *FileReader) data(p []flat.Feature) (int, error) {
+	if err := r.enterData(); err != nil {
+		return 0, err
 	}
 
-	r.sanityCheckState()
-
 	n := len(p)
 	var rem int
 	if r.numFeatures > 0 {
@@ -376,7 +521,7 @@ func (r *FileReader) Data(p []flat.Feature) (int, error) {
 			return i, err
 		}
 	}
-	if n == rem {
+	if n == rem && (n == 0 || !r.DeferEOF) {
 		if err := r.toState(inData, eof); err != nil {
 			return n, err
 		}
@@ -387,10 +532,17 @@ func (r *FileReader) Data(p []flat.Feature) (int, error) {
 
 // TODO: Write docs.
 func (r *FileReader) DataRem() ([]flat.Feature, error) {
+	r.acquire()
+	defer r.release()
+	return r.dataRem()
+}
+
+// dataRem implements DataRem without acquiring the reader.
+func (r *FileReader) dataRem() ([]flat.Feature, error) {
 	if r.numFeatures > 0 {
 		rem := r.numFeatures - r.featureIndex
 		p := make([]flat.Feature, rem)
-		n, err := r.Data(p)
+		n, err := r.data(p)
 		p = p[0:n]
 		if err != nil && err != io.EOF {
 			return p, err
@@ -401,7 +553,7 @@ func (r *FileReader) DataRem() ([]flat.Feature, error) {
 		return p, nil
 	} else {
 		p := make([]flat.Feature, 1024)
-		n, err := r.Data(p)
+		n, err := r.data(p)
 		if err != nil && err != io.EOF {
 			return p[0:n], err
 		} else if err == io.EOF {
@@ -410,7 +562,7 @@ func (r *FileReader) DataRem() ([]flat.Feature, error) {
 		q := make([]flat.Feature, 0, 2*len(p))
 		q = append(q, p[0:n]...)
 		for {
-			n, err = r.Data(p)
+			n, err = r.data(p)
 			q = append(q, p[0:n]...)
 			if err != nil && err != io.EOF {
 				return q, err
@@ -421,8 +573,942 @@ func (r *FileReader) DataRem() ([]flat.Feature, error) {
 	}
 }
 
+// DataBatch reads up to n features, storing the bytes of all the
+// feature tables in the single buffer pointed to by buf, and returns
+// views of the features read. Unlike Data, which allocates a separate
+// buffer for each feature, DataBatch reuses the buffer's capacity from
+// one call to the next, growing it as needed, so that processing a
+// file n features at a time causes few allocations.
+//
+// The buffer's previous contents are overwritten, so the features
+// returned are only valid until the next call to DataBatch with the
+// same buffer. Copy any features which must outlive that. On return,
+// *buf holds the feature bytes, possibly in a newly allocated array.
+//
+// Like Data, DataBatch returns io.EOF together with the last features
+// in the data section, and with no features once the data section is
+// exhausted. If an error occurs, the features read before the error
+// are returned.
+func (r *FileReader) DataBatch(n int, buf *[]byte) ([]flat.Feature, error) {
+	if n < 1 {
+		fmtPanic("batch size must be at least 1, got %d", n)
+	} else if buf == nil {
+		textPanic("nil buffer")
+	}
+
+	r.acquire()
+	defer r.release()
+	return r.dataBatch(n, buf)
+}
+
+// dataBatch implements DataBatch without acquiring the reader.
+func (r *FileReader) dataBatch(n int, buf *[]byte) ([]flat.Feature, error) {
+	if err := r.enterData(); err != nil {
+		return nil, err
+	}
+
+	var rem int
+	if r.numFeatures > 0 {
+		rem = r.numFeatures - r.featureIndex
+		if n > rem {
+			n = rem
+		}
+	}
+
+	b := (*buf)[:0]
+	ends := make([]int, 0, n)
+	var err error
+	for len(ends) < n {
+		if b, err = r.appendFeature(b); err != nil {
+			break
+		}
+		ends = append(ends, len(b))
+	}
+	*buf = b
+
+	fs := make([]flat.Feature, len(ends))
+	var start int
+	for i, end := range ends {
+		initFeature(&fs[i], b[start:end])
+		start = end
+	}
+
+	if r.numFeatures == 0 && err == errEndOfData {
+		_ = r.toState(inData, eof)
+		return fs, io.EOF
+	} else if err != nil {
+		return fs, err
+	} else if len(ends) == rem && (rem == 0 || !r.DeferEOF) {
+		if err = r.toState(inData, eof); err != nil {
+			return fs, err
+		}
+		return fs, io.EOF
+	}
+	return fs, nil
+}
+
+// DataBestEffort reads all remaining features, tolerating features
+// whose FlatBuffers table is corrupt. It returns the features that
+// could be decoded, in data order, together with a list of errors
+// describing the features that were skipped.
+//
+// Each feature is fully decoded as it is read. If decoding fails, the
+// feature is skipped, an error identifying it is recorded, and reading
+// continues with the next feature, whose location is known from the
+// corrupt feature's size prefix. The same applies to features rejected
+// by the reader's VerifyTables or MaxVertices checks. Other errors, such
+// as a corrupt size prefix or an I/O error, can't be recovered from: in
+// this case the error is appended to the error list and DataBestEffort
+// returns the features read so far.
+//
+// DataBestEffort is intended for recovering what data is possible from
+// partially corrupt files. The features it returns are valid to use,
+// so if the error list is empty, the result is the same as DataRem.
+func (r *FileReader) DataBestEffort() ([]flat.Feature, []error) {
+	r.acquire()
+	defer r.release()
+
+	var fs []flat.Feature
+	var errs []error
+	p := make([]flat.Feature, 1)
+	for {
+		index, offset := r.featureIndex, r.featureOffset
+		n, err := r.data(p)
+		if n > 0 {
+			if err2 := validateFeature(&p[0]); err2 != nil {
+				errs = append(errs, wrapErr("skipped corrupt feature[%d] (offset %d)", err2, index, offset))
+			} else {
+				fs = append(fs, p[0])
+			}
+		}
+		if err == io.EOF {
+			return fs, errs
+		} else if err != nil {
+			errs = append(errs, err)
+			// A non-sticky error that moved the reader past the
+			// feature only affects that feature, so keep reading.
+			if r.err != nil || r.featureIndex == index {
+				return fs, errs
+			}
+		}
+	}
+}
+
+// CountFeatures returns the total number of features in the file. If
+// the header records the feature count, it is returned immediately.
+// Otherwise, the data section is scanned to count the features, and the
+// count is cached so that subsequent calls are free.
+//
+// When the data section has to be scanned, only the size prefix of each
+// remaining feature is read and the feature tables are skipped over by
+// seeking, so the underlying stream must be an io.Seeker unless the
+// data section has already been fully read. Since the feature tables
+// are not read, they are not validated. The reader's position is
+// restored before CountFeatures returns, so it does not affect
+// subsequent calls to Data or DataRem.
+func (r *FileReader) CountFeatures() (int, error) {
+	r.acquire()
+	defer r.release()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.sanityCheckState()
+	if r.state < afterHeader {
+		return 0, textErr(errHeaderNotCalled)
+	} else if r.numFeatures > 0 {
+		return r.numFeatures, nil
+	} else if r.countedFeatures > 0 {
+		return r.countedFeatures, nil
+	} else if r.state == eof {
+		r.countedFeatures = r.featureIndex
+		return r.featureIndex, nil
+	}
+
+	// Count the remaining features from the current position, then
+	// restore it. A file with unknown feature count can't have a usable
+	// index, so the data section directly follows the header.
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, textErr("can't count features: reader is not an io.Seeker")
+	} else if r.nodeSize > 0 {
+		return 0, textErr("can't count features: header has index but no feature count")
+	}
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, wrapErr("failed to query feature[%d] offset", err, r.featureIndex)
+	}
+
+	featureIndex, featureOffset := r.featureIndex, r.featureOffset
+	buf := make([]byte, discardBufferSize)
+	for {
+		if _, err = r.skipFeature(buf); err == errEndOfData {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	count := r.featureIndex
+	r.featureIndex, r.featureOffset = featureIndex, featureOffset
+	if _, err = s.Seek(pos, io.SeekStart); err != nil {
+		return 0, r.toErr(wrapErr("failed to restore offset %d", err, pos))
+	}
+
+	r.countedFeatures = count
+	return count, nil
+}
+
+// FeatureSizeStats scans the remaining features in the data section
+// and returns the mean and maximum size, in bytes, of their FlatBuffers
+// tables, excluding the 4-byte size prefix. It can be used to choose
+// appropriate buffer sizes for processing a file.
+//
+// Only the size prefix of each feature is read. If the underlying
+// stream is an io.Seeker, the feature tables are skipped by seeking;
+// otherwise they are read and discarded. Since the feature tables are
+// not read, they are not validated. After FeatureSizeStats returns, the
+// data section has been fully consumed, as if by DataRem.
+//
+// If there are no remaining features, the mean and maximum are zero.
+func (r *FileReader) FeatureSizeStats() (mean float64, max int, err error) {
+	r.acquire()
+	defer r.release()
+
+	if err = r.enterData(); err == io.EOF {
+		return 0, 0, nil
+	} else if err != nil {
+		return
+	}
+
+	var count int
+	var total int64
+	if err = r.skipDataRem(func(featureLen uint32) {
+		count++
+		total += int64(featureLen)
+		if int(featureLen) > max {
+			max = int(featureLen)
+		}
+	}); err != nil {
+		return
+	}
+
+	if count > 0 {
+		mean = float64(total) / float64(count)
+	}
+	return
+}
+
+// maxPropertySampleFeatures is the approximate maximum number of
+// features whose properties are sampled by PropertyEntropyEstimate.
+const maxPropertySampleFeatures = 4096
+
+// maxPropertySampleLen is the number of bytes of properties beyond
+// which PropertyEntropyEstimate stops adding to its sample.
+const maxPropertySampleLen = 1 << 20
+
+// PropertyEntropyEstimate reads all remaining features and returns a
+// rough estimate of how well their properties compress, as the ratio of
+// compressed size to uncompressed size. A ratio close to zero indicates
+// highly redundant properties, while a ratio close to one indicates
+// properties that won't benefit from compression. It is intended to
+// help decide whether to compress a file, for example with gzip.
+//
+// The result is only an estimate. The properties of a sample of the
+// features, spread evenly across the data section when the header
+// records the feature count, are concatenated up to a limit of 1 MiB
+// and compressed using DEFLATE, the algorithm used by gzip, at its
+// fastest setting. A full compressor at a higher setting will typically
+// do somewhat better, and the geometries, which usually make up the
+// bulk of a file, are not considered. When there are only a few
+// hundred bytes of properties, the compressor's fixed overhead can make
+// the ratio exceed one.
+//
+// If none of the remaining features have properties, the ratio is one,
+// since there is nothing to gain from compressing them. After
+// PropertyEntropyEstimate returns, the data section has been fully
+// consumed, as if by DataRem.
+func (r *FileReader) PropertyEntropyEstimate() (float64, error) {
+	r.acquire()
+	defer r.release()
+
+	stride := 1
+	if r.numFeatures > 0 {
+		stride = (r.numFeatures-r.featureIndex)/maxPropertySampleFeatures + 1
+	}
+
+	var sample []byte
+	p := make([]flat.Feature, 256)
+	for i := 0; ; {
+		n, err := r.data(p)
+		for j := 0; j < n; j, i = j+1, i+1 {
+			if i%stride == 0 && len(sample) < maxPropertySampleLen {
+				sample = append(sample, p[j].PropertiesBytes()...)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if len(sample) == 0 {
+		return 1, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return 0, wrapErr("failed to create compressor", err)
+	}
+	if _, err = w.Write(sample); err != nil {
+		return 0, wrapErr("failed to compress property sample", err)
+	}
+	if err = w.Close(); err != nil {
+		return 0, wrapErr("failed to compress property sample", err)
+	}
+	return float64(buf.Len()) / float64(len(sample)), nil
+}
+
+// maxDistinctValues is the maximum number of distinct column values
+// that DistinctValues will collect before giving up with an error.
+const maxDistinctValues = 65536
+
+// DistinctValues reads all remaining features and returns the sorted
+// list of distinct values of a single property column, converted to
+// strings. Features which have no value for the column are ignored.
+//
+// Binary and JSON column values are converted to strings by
+// interpreting their bytes directly; all other values are formatted
+// using fmt.Sprint. The schema s is used to interpret the feature
+// properties and will typically be the file header.
+//
+// To bound memory use, an error is returned if the column contains
+// more than 65,536 distinct values.
+func (r *FileReader) DistinctValues(s Schema, colIndex uint16) ([]string, error) {
+	if int(colIndex) >= s.ColumnsLength() {
+		return nil, fmtErr("column index %d not in schema (%d columns)", colIndex, s.ColumnsLength())
+	}
+
+	r.acquire()
+	defer r.release()
+
+	set := make(map[string]struct{})
+	p := make([]flat.Feature, 256)
+	for {
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			var vals []PropValue
+			if err2 := safeFlatBuffersInteraction(func() (err3 error) {
+				vals, err3 = NewPropReader(bytes.NewReader(p[i].PropertiesBytes())).ReadSchema(s)
+				return
+			}); err2 != nil {
+				return nil, wrapErr("failed to read properties of feature[%d]", err2, r.featureIndex-n+i)
+			}
+			for j := range vals {
+				if vals[j].ColIndex != colIndex {
+					continue
+				}
+				set[propString(&vals[j])] = struct{}{}
+				if len(set) > maxDistinctValues {
+					return nil, fmtErr("column %d has more than %d distinct values", colIndex, maxDistinctValues)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	distinct := make([]string, 0, len(set))
+	for v := range set {
+		distinct = append(distinct, v)
+	}
+	sort.Strings(distinct)
+	return distinct, nil
+}
+
+// GroupBy reads all remaining features and groups them by the string
+// key computed for each feature by the function key. Within each group,
+// features are in data order.
+//
+// Since every remaining feature is retained, GroupBy uses as much
+// memory as DataRem, plus the overhead of the map and its slices. It is
+// not suitable for files too large to hold in memory; for those, read
+// the features in batches with Data and write each one to its group's
+// destination as it is read.
+//
+// If key panics while reading a corrupt feature table, the panic is
+// recovered and returned as an error.
+func (r *FileReader) GroupBy(key func(*flat.Feature) string) (map[string][]flat.Feature, error) {
+	if key == nil {
+		textPanic("nil key function")
+	}
+
+	r.acquire()
+	defer r.release()
+
+	groups := make(map[string][]flat.Feature)
+	p := make([]flat.Feature, 256)
+	for {
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			var k string
+			if err2 := safeFlatBuffersInteraction(func() error {
+				k = key(&p[i])
+				return nil
+			}); err2 != nil {
+				return nil, wrapErr("failed to compute key of feature[%d]", err2, r.featureIndex-n+i)
+			}
+			groups[k] = append(groups[k], p[i])
+		}
+		if err == io.EOF {
+			return groups, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DataWhere reads all remaining features and returns those whose
+// properties satisfy the predicate pred, in data order. It provides
+// attribute filtering for files without a spatial index, or for queries
+// which don't have a spatial component.
+//
+// The properties of each feature are decoded using the schema s, which
+// will typically be the file header, and passed to pred in the order
+// they are stored in the feature. Columns for which the feature has no
+// value are omitted. The values passed to pred are only valid for the
+// duration of the call, but the features returned remain valid.
+//
+// Features which don't match are discarded as they are read, so
+// DataWhere only retains the matching features. After DataWhere
+// returns, the data section has been fully consumed, as if by DataRem.
+func (r *FileReader) DataWhere(s Schema, pred func([]PropValue) bool) ([]flat.Feature, error) {
+	if pred == nil {
+		textPanic("nil predicate")
+	}
+
+	r.acquire()
+	defer r.release()
+
+	var fs []flat.Feature
+	p := make([]flat.Feature, 256)
+	for {
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			if ok, err2 := matchProps(&p[i], s, pred); err2 != nil {
+				return nil, wrapErr("failed to read properties of feature[%d]", err2, r.featureIndex-n+i)
+			} else if ok {
+				fs = append(fs, p[i])
+			}
+		}
+		if err == io.EOF {
+			return fs, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DataByOffset reads all remaining features and returns them in a map
+// keyed by the byte offset of each feature within the data section. The
+// offsets are the same as those stored in the leaves of the spatial
+// index, so the map can be used to resolve the Offset of a
+// packedrtree.Result, for example from a search of the index returned
+// by Index, without reading the data section again.
+//
+// Since every remaining feature is retained, DataByOffset uses as much
+// memory as DataRem, plus the overhead of the map. After DataByOffset
+// returns, the data section has been fully consumed, as if by DataRem.
+func (r *FileReader) DataByOffset() (map[int64]flat.Feature, error) {
+	r.acquire()
+	defer r.release()
+
+	m := make(map[int64]flat.Feature)
+	p := make([]flat.Feature, 256)
+	for {
+		offset := r.featureOffset
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			var size uint32
+			if err2 := safeFlatBuffersInteraction(func() (err error) {
+				size, err = tableSize(p[i].Table())
+				return
+			}); err2 != nil {
+				return nil, wrapErr("failed to size feature[%d]", err2, r.featureIndex-n+i)
+			}
+			m[offset] = p[i]
+			offset += flatbuffers.SizeUint32 + int64(size)
+		}
+		if err == io.EOF {
+			return m, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// FindDuplicateGeometries reads all remaining features and returns
+// groups of features which have the same geometry, identified by their
+// zero-based indices in the data section. Each group contains at least
+// two indices, in ascending order, and the groups are ordered by their
+// first index. Features without a geometry are ignored.
+//
+// Two geometries are the same if they have the same type, ring and part
+// structure, and coordinates, including any Z coordinates. If epsilon
+// is positive, coordinates are first quantized by rounding them to the
+// nearest multiple of epsilon, so geometries whose coordinates differ
+// by small amounts, for example due to rounding errors, are also
+// treated as the same. Since quantization snaps to a fixed grid, two
+// coordinates less than epsilon apart which fall either side of a grid
+// boundary are not treated as the same. If epsilon is zero, coordinates
+// must be exactly equal.
+//
+// To keep memory use low, only a 64-bit hash of each geometry is
+// retained, not the geometry itself. Geometries which are different
+// could in theory have the same hash, but the probability is vanishingly
+// small.
+func (r *FileReader) FindDuplicateGeometries(epsilon float64) ([][]int, error) {
+	if !(epsilon >= 0) || math.IsInf(epsilon, 0) {
+		fmtPanic("epsilon must be a non-negative finite number, got %g", epsilon)
+	}
+
+	r.acquire()
+	defer r.release()
+
+	groups := make(map[uint64][]int)
+	h := fnv.New64a()
+	var scratch []byte
+	p := make([]flat.Feature, 256)
+	for {
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			var hasGeometry bool
+			if err2 := safeFlatBuffersInteraction(func() error {
+				var g flat.Geometry
+				if p[i].Geometry(&g) != nil {
+					hasGeometry = true
+					h.Reset()
+					scratch = hashGeometry(h, scratch, &g, epsilon)
+				}
+				return nil
+			}); err2 != nil {
+				return nil, wrapErr("failed to hash geometry of feature[%d]", err2, r.featureIndex-n+i)
+			}
+			if hasGeometry {
+				k := h.Sum64()
+				groups[k] = append(groups[k], r.featureIndex-n+i)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var dups [][]int
+	for _, g := range groups {
+		if len(g) > 1 {
+			dups = append(dups, g)
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i][0] < dups[j][0]
+	})
+	return dups, nil
+}
+
+// hashGeometry writes a canonical encoding of a geometry and all of its
+// parts to a hash, with coordinates quantized by epsilon. The scratch
+// buffer is reused to build the encoding, and is returned for further
+// reuse.
+func hashGeometry(h hash.Hash, scratch []byte, g *flat.Geometry, epsilon float64) []byte {
+	quantize := func(v float64) uint64 {
+		if epsilon > 0 {
+			v = math.Round(v / epsilon)
+		}
+		// Adding zero converts negative zero to positive zero.
+		return math.Float64bits(v + 0)
+	}
+
+	b := append(scratch[:0], byte(g.Type()))
+	n := g.EndsLength()
+	b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	for i := 0; i < n; i++ {
+		b = binary.LittleEndian.AppendUint32(b, g.Ends(i))
+	}
+	n = g.XyLength()
+	b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	for i := 0; i < n; i++ {
+		b = binary.LittleEndian.AppendUint64(b, quantize(g.Xy(i)))
+	}
+	n = g.ZLength()
+	b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	for i := 0; i < n; i++ {
+		b = binary.LittleEndian.AppendUint64(b, quantize(g.Z(i)))
+	}
+	n = g.PartsLength()
+	b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	_, _ = h.Write(b)
+	for i := 0; i < n; i++ {
+		var part flat.Geometry
+		if g.Parts(&part, i) {
+			b = hashGeometry(h, b, &part, epsilon)
+		}
+	}
+	return b
+}
+
+// IndexSearchWhere searches the spatial index for features whose
+// bounding boxes intersect b, like IndexSearch, and returns only those
+// whose properties satisfy the predicate pred. It combines a spatial
+// query with an attribute filter, such as "features in this box with a
+// population over X".
+//
+// The properties of each feature found by the index search are decoded
+// and passed to pred as described for DataWhere. The spatial filter
+// compares bounding boxes only, as for IndexSearch, and the same
+// positioning and index requirements apply.
+func (r *FileReader) IndexSearchWhere(b packedrtree.Box, s Schema, pred func([]PropValue) bool) ([]flat.Feature, error) {
+	if pred == nil {
+		textPanic("nil predicate")
+	}
+
+	fs, err := r.IndexSearch(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var j int
+	for i := range fs {
+		if ok, err := matchProps(&fs[i], s, pred); err != nil {
+			return nil, wrapErr("failed to read properties of search result[%d]", err, i)
+		} else if ok {
+			fs[j] = fs[i]
+			j++
+		}
+	}
+	return fs[:j], nil
+}
+
+// matchProps decodes the properties of a feature using a schema and
+// reports whether they satisfy a predicate.
+func matchProps(f *flat.Feature, s Schema, pred func([]PropValue) bool) (bool, error) {
+	var vals []PropValue
+	if err := safeFlatBuffersInteraction(func() (err error) {
+		vals, err = NewPropReader(bytes.NewReader(f.PropertiesBytes())).ReadSchema(s)
+		return
+	}); err != nil {
+		return false, err
+	}
+	return pred(vals), nil
+}
+
+// PointLookup searches the spatial index for features whose bounding
+// box contains the point (x, y), and returns the value of the property
+// column nameCol of the first such feature, converted to a string as
+// in DistinctValues. The boolean return value is false if no feature
+// matches or the first matching feature has no value for the column.
+//
+// PointLookup filters features by bounding box only, not by exact
+// geometric containment, so the result may be a feature whose bounding
+// box contains the point even though its geometry does not. Where the
+// bounding boxes of several features contain the point, the first in
+// data section order is used.
+//
+// Like IndexSearch, PointLookup may only be called when the reader is
+// positioned immediately after the header, and the file must have an
+// index.
+func (r *FileReader) PointLookup(s Schema, x, y float64, nameCol uint16) (string, bool, error) {
+	if int(nameCol) >= s.ColumnsLength() {
+		return "", false, fmtErr("column index %d not in schema (%d columns)", nameCol, s.ColumnsLength())
+	}
+
+	fs, err := r.IndexSearch(packedrtree.Box{XMin: x, YMin: y, XMax: x, YMax: y})
+	if err != nil || len(fs) == 0 {
+		return "", false, err
+	}
+
+	var vals []PropValue
+	if err = safeFlatBuffersInteraction(func() (err2 error) {
+		vals, err2 = NewPropReader(bytes.NewReader(fs[0].PropertiesBytes())).ReadSchema(s)
+		return
+	}); err != nil {
+		return "", false, wrapErr("failed to read properties of matching feature", err)
+	}
+	for i := range vals {
+		if vals[i].ColIndex == nameCol {
+			return propString(&vals[i]), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// SmallestContaining searches the spatial index for features whose
+// bounding box contains the point (x, y), and returns the one whose
+// bounding box has the smallest area. It is intended for point queries
+// over overlapping features, where the smallest feature is typically
+// the most specific match. If no feature matches, it returns nil and
+// no error.
+//
+// The bounding box of each candidate is computed from its geometry, as
+// by FeatureBounds. Like PointLookup, SmallestContaining filters
+// features by bounding box only, not by exact geometric containment;
+// use PointInGeometry to refine the result if needed. Where several
+// candidates have the same area, the first in data section order is
+// returned.
+//
+// Like IndexSearch, SmallestContaining may only be called when the
+// reader is positioned immediately after the header, and the file must
+// have an index.
+func (r *FileReader) SmallestContaining(x, y float64) (*flat.Feature, error) {
+	fs, err := r.IndexSearch(packedrtree.Box{XMin: x, YMin: y, XMax: x, YMax: y})
+	if err != nil {
+		return nil, err
+	}
+
+	best := -1
+	var bestArea float64
+	for i := range fs {
+		b, err := FeatureBounds(&fs[i])
+		if err != nil {
+			return nil, wrapErr("failed to compute bounds of matching feature", err)
+		}
+		if x < b.XMin || x > b.XMax || y < b.YMin || y > b.YMax {
+			continue
+		}
+		area := (b.XMax - b.XMin) * (b.YMax - b.YMin)
+		if best < 0 || area < bestArea {
+			best, bestArea = i, area
+		}
+	}
+	if best < 0 {
+		return nil, nil
+	}
+	return &fs[best], nil
+}
+
+// ScanIntersecting reads all remaining features and returns the
+// zero-based data section indices, in ascending order, of those whose
+// bounding box intersects b. It is the index-free counterpart of
+// IndexSearch, for files without a spatial index, and returns only the
+// indices so that the features need not be retained.
+//
+// The bounding box of each feature is computed from its geometry, as by
+// FeatureBounds, and intersects b by the same test as a PackedRTree
+// search, so boxes which merely touch along an edge or at a corner
+// intersect. Features without a geometry never match. Like
+// IndexSearch, ScanIntersecting filters features by bounding box only,
+// not by exact geometric intersection.
+//
+// Features are read in batches into a single reused buffer, so memory
+// use is bounded by the number of matches rather than the size of the
+// data section. After ScanIntersecting returns, the data section has
+// been fully consumed, as if by DataRem.
+func (r *FileReader) ScanIntersecting(b packedrtree.Box) ([]int, error) {
+	r.acquire()
+	defer r.release()
+
+	var indices []int
+	var buf []byte
+	for {
+		fs, err := r.dataBatch(256, &buf)
+		for i := range fs {
+			index := r.featureIndex - len(fs) + i
+			fb, err2 := FeatureBounds(&fs[i])
+			if err2 != nil {
+				return nil, wrapErr("failed to compute bounds of feature[%d]", err2, index)
+			}
+			if fb.XMax < b.XMin || fb.YMax < b.YMin || fb.XMin > b.XMax || fb.YMin > b.YMax {
+				continue
+			}
+			indices = append(indices, index)
+		}
+		if err == io.EOF {
+			return indices, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// VerifyIndexConsistency checks that the spatial index agrees with the
+// data section. It reads the index and every feature, recomputes each
+// feature's bounding box using FeatureBounds, and confirms that
+// searching the index for that box yields a result at the feature's
+// actual offset in the data section. It returns an error describing
+// the first inconsistency found, or nil if the index is consistent.
+//
+// A file whose index doesn't match its data, typically because it was
+// produced by a buggy writer, silently returns wrong results from
+// IndexSearch. VerifyIndexConsistency detects this problem. Features
+// with no coordinates can't be located by a spatial search, so they
+// are not checked.
+//
+// VerifyIndexConsistency may only be called when the reader is
+// positioned immediately after the header, the underlying stream must
+// be an io.Seeker, and the file must have an index. On success, the
+// reader is rewound so that it is again positioned immediately after
+// the header.
+func (r *FileReader) VerifyIndexConsistency() error {
+	r.acquire()
+	defer r.release()
+
+	if r.state == afterHeader && r.err == nil {
+		if _, ok := r.r.(io.Seeker); !ok {
+			return textErr("can't verify index consistency: reader is not an io.Seeker")
+		}
+	}
+
+	index, err := r.index()
+	if err != nil {
+		return err
+	} else if index == nil {
+		return ErrNoIndex
+	}
+
+	p := make([]flat.Feature, 1)
+	for {
+		offset := r.featureOffset
+		n, err := r.data(p)
+		if n > 0 {
+			b, err2 := FeatureBounds(&p[0])
+			if err2 != nil {
+				return wrapErr("failed to compute bounds of feature[%d] (offset %d)", err2, r.featureIndex-1, offset)
+			}
+			if b != packedrtree.EmptyBox && !index.ContainsOffset(b, offset) {
+				return fmtErr("feature[%d] (offset %d, bounds %s) not found in index", r.featureIndex-1, offset, b)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if r.featureIndex != index.NumRefs() {
+		return fmtErr("index has %d refs but data section has %d features", index.NumRefs(), r.featureIndex)
+	}
+
+	return r.rewind()
+}
+
+// VerifyNoTrailingData skips over the remaining features in the data
+// section and confirms that the underlying stream is then positioned
+// exactly at end-of-file. A well-formed FlatGeobuf file has nothing
+// after its last feature, so trailing bytes may indicate a corrupted
+// feature count, a truncated concatenation, or a deliberately smuggled
+// payload.
+//
+// The underlying stream must be an io.Seeker, since the end-of-file
+// position is determined by seeking. As with FeatureSizeStats, the
+// feature tables are skipped rather than read, so they are not
+// validated, and after VerifyNoTrailingData returns the data section
+// has been fully consumed. A file whose header does not record the
+// feature count is read until end-of-file, so trailing data in such a
+// file can only be detected if it does not look like a sequence of
+// length-prefixed features.
+func (r *FileReader) VerifyNoTrailingData() error {
+	r.acquire()
+	defer r.release()
+
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return textErr("can't verify trailing data: reader is not an io.Seeker")
+	}
+
+	if err := r.enterData(); err != nil && err != io.EOF {
+		return err
+	} else if err == nil {
+		if err = r.skipDataRem(func(uint32) {}); err != nil {
+			return err
+		}
+	}
+
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query data section end offset", err)
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return wrapErr("failed to query end-of-file offset", err)
+	}
+	if _, err = s.Seek(pos, io.SeekStart); err != nil {
+		return r.toErr(wrapErr("failed to restore offset %d", err, pos))
+	}
+
+	if pos < end {
+		return fmtErr("%d bytes of trailing data after data section (offset %d)", end-pos, pos)
+	} else if pos > end {
+		return fmtErr("data section ends %d bytes past end-of-file (offset %d)", pos-end, end)
+	}
+	return nil
+}
+
+// IsDataHilbertSorted reads all remaining features and reports whether
+// they are stored in the data section in descending Hilbert order of
+// their bounding box centers, which is the order in which the reference
+// FlatGeobuf implementations write the data section of an indexed file.
+//
+// The check is done by Hilbert sorting a copy of the feature bounding
+// boxes using packedrtree.HilbertSort and comparing the result to the
+// file order. Since HilbertSort is not stable, the comparison is made on
+// bounding boxes rather than feature positions, so features with
+// identical bounding boxes may appear in either order.
+//
+// The reader should be positioned at the start of the data section, for
+// example immediately after a successful call to Header, since only the
+// remaining features are considered. The file does not need to have an
+// index.
+func (r *FileReader) IsDataHilbertSorted() (bool, error) {
+	r.acquire()
+	defer r.release()
+
+	var refs []packedrtree.Ref
+	bounds := packedrtree.EmptyBox
+	p := make([]flat.Feature, 256)
+	for {
+		n, err := r.data(p)
+		for i := 0; i < n; i++ {
+			b, err2 := FeatureBounds(&p[i])
+			if err2 != nil {
+				return false, wrapErr("failed to compute bounds of feature[%d]", err2, r.featureIndex-n+i)
+			}
+			refs = append(refs, packedrtree.Ref{Box: b})
+			bounds.Expand(&b)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	sorted := make([]packedrtree.Ref, len(refs))
+	copy(sorted, refs)
+	packedrtree.HilbertSort(sorted, bounds)
+	for i := range refs {
+		if refs[i].Box != sorted[i].Box {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // TODO: Write docs.
 func (r *FileReader) Rewind() error {
+	r.acquire()
+	defer r.release()
+	return r.rewind()
+}
+
+// rewind implements Rewind without acquiring the reader.
+func (r *FileReader) rewind() error {
 	if r.err != nil {
 		return r.err
 	} else if r.state == afterHeader {
@@ -447,9 +1533,64 @@ func (r *FileReader) Rewind() error {
 
 // TODO: Write docs.
 func (r *FileReader) Close() error {
+	r.acquire()
+	defer r.release()
 	return r.close(r.r)
 }
 
+// acquire marks the reader as in use for the duration of a method
+// call, panicking if a call on another goroutine is already in
+// progress. Every exported method which accesses the reader's state
+// acquires the reader, and calls the unexported, non-acquiring
+// implementations of other methods, such as data, rather than the
+// exported ones. Methods which access the reader's state only through
+// other exported methods, such as IndexSearchWhere, don't need to
+// acquire the reader, since the methods they call do so.
+func (r *FileReader) acquire() {
+	if !r.inUse.CompareAndSwap(false, true) {
+		textPanic("concurrent use of FileReader (not safe for concurrent use)")
+	}
+}
+
+// release marks the reader as no longer in use.
+func (r *FileReader) release() {
+	r.inUse.Store(false)
+}
+
+// enterData prepares the reader to read features from the data
+// section, skipping the index if the reader is positioned immediately
+// after the header. It returns io.EOF if the data section has been
+// fully read.
+func (r *FileReader) enterData() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.state == afterHeader {
+		if err := r.skipIndex(); err != nil {
+			return err
+		}
+	}
+
+	if r.state == afterIndex {
+		if err := r.saveDataOffset(nil); err != nil {
+			return err
+		}
+		r.state = inData
+	}
+
+	if r.state == eof {
+		return io.EOF
+	}
+
+	if r.state == uninitialized {
+		return textErr(errHeaderNotCalled)
+	}
+
+	r.sanityCheckState()
+	return nil
+}
+
 func (r *FileReader) indexStateErr(state state) error {
 	switch state {
 	case uninitialized:
@@ -472,8 +1613,17 @@ func (r *FileReader) skipIndex() error {
 		return err
 	}
 
-	// Seek or read to the correct position.
-	if r.nodeSize > 0 {
+	// Seek or read to the correct position. If the index is external,
+	// the data section immediately follows the header, so seeking is
+	// only needed if the reader was rewound.
+	if r.externalIndex {
+		if r.dataOffset > 0 {
+			s := r.r.(io.Seeker)
+			if _, err := s.Seek(r.dataOffset, io.SeekStart); err != nil {
+				return r.toErr(err)
+			}
+		}
+	} else if r.nodeSize > 0 {
 		if r.dataOffset > 0 { // If we already know the data offset, seek to it.
 			s := r.r.(io.Seeker)
 			if _, err := s.Seek(r.dataOffset, io.SeekStart); err != nil {
@@ -534,42 +1684,174 @@ func (r *FileReader) saveGenericOffset(s io.Seeker, offsetPtr *int64, name strin
 	return nil
 }
 
-func (r *FileReader) readFeature(f *flat.Feature) (err error) {
-	// Read the feature length, which is a little-endian 32-bit integer.
-	b := make([]byte, flatbuffers.SizeUint32)
-	var n int
-	n, err = io.ReadFull(r.r, b)
+// readFeature reads the next feature into a buffer of exactly the
+// feature's size, so each feature read costs a single allocation.
+func (r *FileReader) readFeature(f *flat.Feature) error {
+	featureLen, err := r.readFeatureLen()
+	if err != nil {
+		return err
+	}
+	tbl, err := r.appendFeatureTable(make([]byte, 0, flatbuffers.SizeUint32+int(featureLen)), featureLen)
+	if err != nil {
+		return err
+	}
+	initFeature(f, tbl)
+	return nil
+}
+
+// appendFeature reads the next feature and appends its size-prefixed
+// table bytes to buf, returning the extended buffer. If an error occurs,
+// the returned buffer has the original length of buf.
+func (r *FileReader) appendFeature(buf []byte) ([]byte, error) {
+	featureLen, err := r.readFeatureLen()
+	if err != nil {
+		return buf, err
+	}
+	return r.appendFeatureTable(buf, featureLen)
+}
+
+// readFeatureLen reads the length prefix of the next feature, which is
+// a little-endian 32-bit integer, into the reader's scratch buffer and
+// returns it. It returns errEndOfData if the data section ends cleanly
+// before the length prefix.
+func (r *FileReader) readFeatureLen() (uint32, error) {
+	n, err := io.ReadFull(r.r, r.lenBuf[:])
 	if err == io.EOF && n == 0 {
-		return errEndOfData
+		return 0, errEndOfData
 	} else if err != nil {
-		return r.toErr(wrapErr("feature[%d] length read error (offset %d)", err, r.featureIndex, r.featureOffset))
+		return 0, r.toErr(wrapErr("feature[%d] length read error (offset %d)", err, r.featureIndex, r.featureOffset))
 	}
-	featureLen := flatbuffers.GetUint32(b)
+	featureLen := flatbuffers.GetUint32(r.lenBuf[:])
 	if featureLen < flatbuffers.SizeUOffsetT {
-		return r.toErr(fmtErr("feature[%d] length %d not big enough for FlatBuffer uoffset_t (offset %d)", r.featureIndex, featureLen, r.featureOffset))
+		return 0, r.toErr(fmtErr("feature[%d] length %d not big enough for FlatBuffer uoffset_t (offset %d)", r.featureIndex, featureLen, r.featureOffset))
 	}
+	return featureLen, nil
+}
 
-	// Read the feature table bytes.
-	tbl := make([]byte, flatbuffers.SizeUint32+featureLen)
-	copy(tbl, b)
+// appendFeatureTable reads the table bytes of the next feature, whose
+// length prefix has just been read by readFeatureLen, and appends the
+// size-prefixed table to buf, returning the extended buffer. If an
+// error occurs, the returned buffer has the original length of buf.
+func (r *FileReader) appendFeatureTable(buf []byte, featureLen uint32) ([]byte, error) {
+	// Copy the length prefix and read the feature table bytes.
+	start := len(buf)
+	buf = growBytes(buf, flatbuffers.SizeUint32+int(featureLen))
+	tbl := buf[start:]
+	copy(tbl, r.lenBuf[:])
+	var err error
 	if _, err = io.ReadFull(r.r, tbl[flatbuffers.SizeUint32:]); err != nil {
-		return r.toErr(wrapErr("failed to read feature[%d] (offset %d, len=%d)", err, r.featureIndex, r.featureOffset, featureLen))
+		return buf[:start], r.toErr(wrapErr("failed to read feature[%d] (offset %d, len=%d)", err, r.featureIndex, r.featureOffset, featureLen))
 	}
 
-	// Read the uoffset_t that prefixes the tables bytes and which tells
-	// us where the data starts.
-	tblOffset := flatbuffers.GetUOffsetT(tbl[flatbuffers.SizeUint32:])
+	// Advance the feature index and feature offset.
+	index, offset := r.featureIndex, r.featureOffset
+	r.featureIndex++
+	r.featureOffset += 4 + int64(featureLen)
 
-	// Convert the feature table into a size-prefixed FlatBuffer which
-	// is a table of type Feature.
+	// Verify the table, if requested. This error is not sticky since
+	// the reader is correctly positioned at the next feature.
+	if r.VerifyTables {
+		var f flat.Feature
+		if err = verifyRootTable(tbl); err == nil {
+			initFeature(&f, tbl)
+			err = validateFeature(&f)
+		}
+		if err != nil {
+			return buf[:start], wrapErr("feature[%d] failed table verification (offset %d)", err, index, offset)
+		}
+	}
+
+	// Enforce the vertex limit, if any. This error is not sticky since
+	// the reader is correctly positioned at the next feature.
+	if r.MaxVertices > 0 {
+		var f flat.Feature
+		initFeature(&f, tbl)
+		var count int
+		if err = safeFlatBuffersInteraction(func() error {
+			count = featureVertices(&f, r.MaxVertices)
+			return nil
+		}); err != nil {
+			return buf[:start], wrapErr("failed to count vertices of feature[%d] (offset %d)", err, index, offset)
+		} else if count > r.MaxVertices {
+			return buf[:start], fmtErr("feature[%d] has more than %d vertices (offset %d)", index, r.MaxVertices, offset)
+		}
+	}
+
+	// Successful read of a feature.
+	return buf, nil
+}
+
+// initFeature initializes a feature view of a size-prefixed feature
+// table. The uoffset_t that follows the size prefix tells us where the
+// table data starts.
+func initFeature(f *flat.Feature, tbl []byte) {
+	tblOffset := flatbuffers.GetUOffsetT(tbl[flatbuffers.SizeUint32:])
 	f.Init(tbl, flatbuffers.SizeUint32+tblOffset)
+}
+
+// growBytes extends the length of a byte slice by n, reallocating it
+// with spare capacity if necessary. The added bytes are not zeroed.
+func growBytes(b []byte, n int) []byte {
+	if cap(b)-len(b) < n {
+		c := make([]byte, len(b), 2*cap(b)+n)
+		copy(c, b)
+		b = c
+	}
+	return b[:len(b)+n]
+}
+
+// skipFeature reads the length prefix of the next feature and skips
+// over the feature table, seeking past it if the underlying stream is
+// an io.Seeker and otherwise reading and discarding it using buf as
+// scratch space. It returns the length of the feature table, excluding
+// the length prefix.
+func (r *FileReader) skipFeature(buf []byte) (featureLen uint32, err error) {
+	// Read the feature length, which is a little-endian 32-bit integer.
+	b := make([]byte, flatbuffers.SizeUint32)
+	var n int
+	n, err = io.ReadFull(r.r, b)
+	if err == io.EOF && n == 0 {
+		return 0, errEndOfData
+	} else if err != nil {
+		return 0, r.toErr(wrapErr("feature[%d] length read error (offset %d)", err, r.featureIndex, r.featureOffset))
+	}
+	featureLen = flatbuffers.GetUint32(b)
+
+	// Skip the feature table bytes.
+	if s, ok := r.r.(io.Seeker); ok {
+		_, err = s.Seek(int64(featureLen), io.SeekCurrent)
+	} else {
+		err = discard(r.r, buf, int64(featureLen))
+	}
+	if err != nil {
+		return 0, r.toErr(wrapErr("failed to skip feature[%d] (offset %d, len=%d)", err, r.featureIndex, r.featureOffset, featureLen))
+	}
 
 	// Advance the feature index and feature offset.
 	r.featureIndex++
-	r.featureOffset += 4 + int64(featureLen)
+	r.featureOffset += flatbuffers.SizeUint32 + int64(featureLen)
 
-	// Successful read of a feature.
-	return nil
+	return featureLen, nil
+}
+
+// skipDataRem skips over all remaining features in the data section,
+// calling f with the table length of each, and puts the reader into
+// the EOF state. The reader must be in the data section.
+func (r *FileReader) skipDataRem(f func(featureLen uint32)) error {
+	buf := make([]byte, discardBufferSize)
+	for r.numFeatures == 0 || r.featureIndex < r.numFeatures {
+		featureLen, err := r.skipFeature(buf)
+		if err == errEndOfData && r.numFeatures == 0 {
+			break
+		} else if err == errEndOfData {
+			return r.toErr(wrapErr("data section ends before feature[%d]", io.ErrUnexpectedEOF, r.featureIndex))
+		} else if err != nil {
+			return err
+		}
+		f(featureLen)
+	}
+
+	return r.toState(inData, eof)
 }
 
 // discardBufferSize is the suggested buffer size to use with the
@@ -595,3 +1877,13 @@ func discard(r io.Reader, buf []byte, n int64) error {
 	}
 	return nil
 }
+
+// propString converts a property value to a string. Binary and JSON
+// values are converted by interpreting their bytes directly, while all
+// other values are formatted using fmt.Sprint.
+func propString(v *PropValue) string {
+	if b, ok := v.Value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v.Value)
+}
@@ -0,0 +1,319 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// FileReaderAt reads a FlatGeobuf file by random access, using an
+// underlying io.ReaderAt whose total size is known in advance. It is
+// intended for storage backends, such as object stores, which support
+// ranged reads but not seeking, and for memory-mapped files.
+//
+// Unlike FileReader, a FileReaderAt has no read position: the header is
+// read once, when the FileReaderAt is created, and every other method
+// reads only the byte ranges it needs. Consequently, a FileReaderAt is
+// safe for concurrent use by multiple goroutines, provided the
+// underlying io.ReaderAt is, as the io.ReaderAt contract requires for
+// parallel ReadAt calls on the same source.
+type FileReaderAt struct {
+	// r is the random access source of the FlatGeobuf file.
+	r io.ReaderAt
+	// hdr is the FlatGeobuf header, read by NewFileReaderAt.
+	hdr *flat.Header
+	// numFeatures is the number of features recorded in the header,
+	// or zero if the header does not record the feature count.
+	numFeatures int
+	// nodeSize is the index node size recorded in the header.
+	nodeSize uint16
+	// indexOffset is the byte offset of the spatial index within the
+	// file. If there is no index, it is equal to dataOffset.
+	indexOffset int64
+	// dataOffset is the byte offset of the data section within the
+	// file.
+	dataOffset int64
+	// dataSize is the length of the data section in bytes, which
+	// extends to the end of the file.
+	dataSize int64
+}
+
+// NewFileReaderAt creates a FileReaderAt over a FlatGeobuf file of size
+// bytes readable from r. It reads and validates the magic number and
+// header, and computes the offsets of the index and data sections, so
+// that the returned reader is ready to search and read features.
+//
+// An error is returned if the magic number or header can't be read or
+// is invalid, or if the file is too small to contain the index recorded
+// in the header. The feature data themselves are not examined.
+func NewFileReaderAt(r io.ReaderAt, size int64) (*FileReaderAt, error) {
+	if r == nil {
+		textPanic("nil reader")
+	} else if size < 0 {
+		fmtPanic("size must be non-negative, got %d", size)
+	}
+
+	// Verify the magic number.
+	v, err := Magic(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, wrapErr("failed to read magic number", err)
+	}
+	if v.Major < MinSpecMajorVersion || v.Major > MaxSpecMajorVersion {
+		return nil, fmtErr("magic number has unsupported major version %d", v.Major)
+	}
+
+	// Read the header length, which is a little-endian 4-byte unsigned
+	// integer.
+	offset := int64(magicLen)
+	b := make([]byte, flatbuffers.SizeUint32)
+	if err = readFullAt(r, b, offset, size); err != nil {
+		return nil, wrapErr("header length read error", err)
+	}
+	headerLen := flatbuffers.GetUint32(b)
+	if headerLen < flatbuffers.SizeUOffsetT {
+		return nil, fmtErr("header length %d not big enough for FlatBuffer uoffset_t", headerLen)
+	} else if headerLen > headerMaxLen {
+		return nil, fmtErr("header length %d exceeds limit of %d bytes", headerLen, headerMaxLen)
+	}
+
+	// Read the header bytes.
+	tbl := make([]byte, flatbuffers.SizeUint32+headerLen)
+	copy(tbl, b)
+	if err = readFullAt(r, tbl[flatbuffers.SizeUint32:], offset+flatbuffers.SizeUint32, size); err != nil {
+		return nil, wrapErr("failed to read header table (len=%d)", err, headerLen)
+	}
+	offset += int64(len(tbl))
+
+	// Convert to FlatBuffer-based Header structure and get number of
+	// features and size of index tree nodes.
+	var hdr *flat.Header
+	var numFeatures uint64
+	var nodeSize uint16
+	if err = safeFlatBuffersInteraction(func() error {
+		hdr = flat.GetSizePrefixedRootAsHeader(tbl, 0)
+		numFeatures = hdr.FeaturesCount()
+		nodeSize = hdr.IndexNodeSize()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if numFeatures > maxFeatureCount {
+		return nil, featureCountOverflowErr(numFeatures)
+	} else if nodeSize == 1 {
+		return nil, textErr("header index node size 1 not allowed")
+	}
+
+	// Locate the index and data sections. There is only an index if
+	// the header records both the node size and the feature count.
+	var indexSize int
+	if nodeSize > 0 && numFeatures > 0 {
+		if indexSize, err = packedrtree.Size(int(numFeatures), nodeSize); err != nil {
+			return nil, wrapErr("failed to compute index size", err)
+		}
+	}
+	if int64(indexSize) > size-offset {
+		return nil, fmtErr("index size %d exceeds remaining file size %d (offset %d)", indexSize, size-offset, offset)
+	}
+
+	// Return the reader.
+	return &FileReaderAt{
+		r:           r,
+		hdr:         hdr,
+		numFeatures: int(numFeatures),
+		nodeSize:    nodeSize,
+		indexOffset: offset,
+		dataOffset:  offset + int64(indexSize),
+		dataSize:    size - offset - int64(indexSize),
+	}, nil
+}
+
+// Header returns the FlatGeobuf header read by NewFileReaderAt.
+func (r *FileReaderAt) Header() *flat.Header {
+	return r.hdr
+}
+
+// Search searches the spatial index for features whose bounding boxes
+// intersect b, and returns the matching results in ascending order of
+// their data section offsets. Only the index nodes visited by the search
+// are read, so the index is not loaded into memory. The features can be
+// read with FeaturesForResults or FeatureForResult.
+//
+// If the file has no index, ErrNoIndex is returned.
+func (r *FileReaderAt) Search(b packedrtree.Box) (packedrtree.Results, error) {
+	if r.indexOffset == r.dataOffset {
+		return nil, ErrNoIndex
+	}
+
+	rs := io.NewSectionReader(r.r, r.indexOffset, r.dataOffset-r.indexOffset)
+	sr, err := packedrtree.SeekWithSize(rs, r.numFeatures, r.nodeSize, r.dataOffset-r.indexOffset, b)
+	if err != nil {
+		return nil, wrapErr("failed to seek-search index", err)
+	}
+	return sr, nil
+}
+
+// PrefetchIndex reads the whole index section, sequentially and in
+// blocks, and discards the bytes read. Its purpose is to warm caches
+// below the reader, for example the operating system page cache of a
+// memory-mapped file or a caching layer in front of an object store,
+// so that the first Search is not slowed by cold reads. It does not
+// build a PackedRTree or retain anything in memory.
+//
+// PrefetchIndex is purely advisory: whether it has any effect depends
+// on the underlying io.ReaderAt, and Search returns the same results
+// whether it is called or not. If the file has no index, ErrNoIndex is
+// returned.
+func (r *FileReaderAt) PrefetchIndex() error {
+	if r.indexOffset == r.dataOffset {
+		return ErrNoIndex
+	}
+
+	n := r.dataOffset - r.indexOffset
+	if n > prefetchBlockSize {
+		n = prefetchBlockSize
+	}
+	buf := make([]byte, n)
+	for offset := r.indexOffset; offset < r.dataOffset; offset += int64(len(buf)) {
+		if rem := r.dataOffset - offset; rem < int64(len(buf)) {
+			buf = buf[:rem]
+		}
+		if err := readFullAt(r.r, buf, offset, r.dataOffset); err != nil {
+			return wrapErr("failed to prefetch index (offset %d)", err, offset)
+		}
+	}
+	return nil
+}
+
+// FeatureAt reads the feature stored at a given byte offset within the
+// data section. The offset of the first feature is zero, and the
+// offsets of the other features can be obtained from FeatureOffsets or
+// from the results of Search.
+//
+// An error is returned if the offset, or the length prefix stored at
+// it, does not fit within the data section. Since a FlatGeobuf file
+// carries no marker at the start of each feature, FeatureAt can't tell
+// whether offset points to the start of a feature, so an incorrect
+// offset typically results in a corrupt feature or a length error.
+func (r *FileReaderAt) FeatureAt(offset int64) (*flat.Feature, error) {
+	f, err := r.featureAt(offset)
+	if err != nil {
+		return nil, wrapErr("failed to read feature at data offset %d", err, offset)
+	}
+	return f, nil
+}
+
+// FeatureForResult reads the feature referred to by a search result,
+// as by FeatureAt with the result offset. It is the single-result
+// analog of FeaturesForResults.
+func (r *FileReaderAt) FeatureForResult(res packedrtree.Result) (*flat.Feature, error) {
+	f, err := r.featureAt(res.Offset)
+	if err != nil {
+		return nil, wrapErr("failed to read feature[%d] (data offset %d)", err, res.RefIndex, res.Offset)
+	}
+	return f, nil
+}
+
+// FeaturesForResults reads the features referred to by a list of search
+// results, and returns them in the same order as the results. The
+// results returned by Search are in data section order, so the features
+// are read in ascending order of offset.
+func (r *FileReaderAt) FeaturesForResults(rs packedrtree.Results) ([]flat.Feature, error) {
+	fs := make([]flat.Feature, len(rs))
+	for i := range rs {
+		f, err := r.featureAt(rs[i].Offset)
+		if err != nil {
+			return nil, wrapErr("failed to read feature[%d] (data offset %d) for search result %d", err, rs[i].RefIndex, rs[i].Offset, i)
+		}
+		fs[i] = *f
+	}
+	return fs, nil
+}
+
+// FeatureOffsets returns the byte offset within the data section of
+// every feature, in data section order. The element at index i is the
+// offset of feature i, so the offsets can be passed to FeatureAt for
+// random access to features by index.
+//
+// Only the 4-byte length prefix of each feature is read. If the header
+// records the feature count, exactly that many offsets are returned and
+// any data after the last feature are ignored. Otherwise, the features
+// are assumed to extend to the end of the file.
+func (r *FileReaderAt) FeatureOffsets() ([]int64, error) {
+	offsets := make([]int64, 0, r.numFeatures)
+	b := make([]byte, flatbuffers.SizeUint32)
+	var offset int64
+	for r.numFeatures == 0 || len(offsets) < r.numFeatures {
+		if r.numFeatures == 0 && offset == r.dataSize {
+			break
+		}
+		if err := readFullAt(r.r, b, r.dataOffset+offset, r.dataOffset+r.dataSize); err != nil {
+			return nil, wrapErr("feature[%d] length read error (data offset %d)", err, len(offsets), offset)
+		}
+		offsets = append(offsets, offset)
+		offset += flatbuffers.SizeUint32 + int64(flatbuffers.GetUint32(b))
+		if offset > r.dataSize {
+			return nil, fmtErr("feature[%d] extends %d bytes past end of data section (data offset %d)", len(offsets)-1, offset-r.dataSize, offsets[len(offsets)-1])
+		}
+	}
+	return offsets, nil
+}
+
+// featureAt reads the feature at a given data section offset. The
+// returned error text does not have the package prefix, since it is
+// intended to be wrapped.
+func (r *FileReaderAt) featureAt(offset int64) (*flat.Feature, error) {
+	if offset < 0 || offset > r.dataSize-flatbuffers.SizeUint32 {
+		return nil, fmt.Errorf("offset out of range [0, %d)", r.dataSize)
+	}
+
+	// Read the feature length, which is a little-endian 32-bit integer.
+	b := make([]byte, flatbuffers.SizeUint32)
+	end := r.dataOffset + r.dataSize
+	if err := readFullAt(r.r, b, r.dataOffset+offset, end); err != nil {
+		return nil, fmt.Errorf("length read error: %w", err)
+	}
+	featureLen := flatbuffers.GetUint32(b)
+	if featureLen < flatbuffers.SizeUOffsetT {
+		return nil, fmt.Errorf("length %d not big enough for FlatBuffer uoffset_t", featureLen)
+	} else if int64(featureLen) > r.dataSize-offset-flatbuffers.SizeUint32 {
+		return nil, fmt.Errorf("length %d extends past end of data section", featureLen)
+	}
+
+	// Read the feature table bytes.
+	tbl := make([]byte, flatbuffers.SizeUint32+int(featureLen))
+	copy(tbl, b)
+	if err := readFullAt(r.r, tbl[flatbuffers.SizeUint32:], r.dataOffset+offset+flatbuffers.SizeUint32, end); err != nil {
+		return nil, fmt.Errorf("table read error (len=%d): %w", featureLen, err)
+	}
+	var f flat.Feature
+	initFeature(&f, tbl)
+	return &f, nil
+}
+
+// readFullAt reads exactly len(p) bytes from r at offset off into p.
+// The range must end at or before limit, which is the size of the data
+// available to the caller. If fewer bytes are available,
+// io.ErrUnexpectedEOF is returned.
+func readFullAt(r io.ReaderAt, p []byte, off, limit int64) error {
+	if off+int64(len(p)) > limit {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil // ReadAt may return io.EOF with a full read.
+	} else if err == io.EOF || err == nil {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// prefetchBlockSize is the size of the blocks in which PrefetchIndex
+// reads the index section.
+const prefetchBlockSize = 64 * 1024
@@ -0,0 +1,283 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/packedrtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFileReaderAt(t *testing.T) {
+	t.Run("Header", func(t *testing.T) {
+		b := readTestFile(t, "countries.fgb")
+
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(179), r.Header().FeaturesCount())
+		assert.Equal(t, uint16(16), r.Header().IndexNodeSize())
+	})
+
+	testCases := []struct {
+		name     string
+		file     []byte
+		expected string
+	}{
+		{"InvalidMagic", []byte("not a flatgeobuf file"), "flatgeobuf: failed to read magic number: flatgeobuf: invalid magic number"},
+		{"NoHeaderLength", magic[:], "flatgeobuf: header length read error: unexpected EOF"},
+		{"TruncatedHeader", readTestFile(t, "countries.fgb")[:20], "flatgeobuf: failed to read header table (len=604): unexpected EOF"},
+		{"TruncatedIndex", readTestFile(t, "countries.fgb")[:2000], "flatgeobuf: index size 7680 exceeds remaining file size 1384 (offset 616)"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r, err := NewFileReaderAt(bytes.NewReader(testCase.file), int64(len(testCase.file)))
+
+			assert.EqualError(t, err, testCase.expected)
+			assert.Nil(t, r)
+		})
+	}
+}
+
+func TestFileReaderAt_Search(t *testing.T) {
+	b := readTestFile(t, "countries.fgb")
+	r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+
+	boxes := []packedrtree.Box{
+		{XMin: -10, YMin: 35, XMax: 30, YMax: 60},   // Europe
+		{XMin: -20, YMin: -35, XMax: 50, YMax: 35},  // Africa
+		{XMin: -130, YMin: 25, XMax: -65, YMax: 50}, // USA
+		{XMin: -180, YMin: -90, XMax: 180, YMax: 90},
+		{XMin: -30, YMin: -50, XMax: -20, YMax: -40}, // South Atlantic
+	}
+	for _, box := range boxes {
+		t.Run(box.String(), func(t *testing.T) {
+			fr := NewFileReader(bytes.NewReader(b))
+			_, err := fr.Header()
+			require.NoError(t, err)
+			expected, err := fr.IndexSearch(box)
+			require.NoError(t, err)
+
+			sr, err := r.Search(box)
+
+			require.NoError(t, err)
+			require.Len(t, sr, len(expected))
+			for i := range sr {
+				f, err := r.FeatureAt(sr[i].Offset)
+				require.NoError(t, err)
+				assert.Equal(t, featureString(t, &expected[i]), featureString(t, f), "feature %d", i)
+				if i > 0 {
+					assert.Less(t, sr[i-1].Offset, sr[i].Offset)
+				}
+			}
+		})
+	}
+
+	t.Run("NoIndex", func(t *testing.T) {
+		b := readTestFile(t, "heterogeneous.fgb")
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+
+		sr, err := r.Search(packedrtree.Box{XMin: -180, YMin: -90, XMax: 180, YMax: 90})
+
+		assert.ErrorIs(t, err, ErrNoIndex)
+		assert.Nil(t, sr)
+	})
+}
+
+func TestFileReaderAt_FeatureForResult(t *testing.T) {
+	b := readTestFile(t, "countries.fgb")
+	r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	box := packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60} // Europe
+	fr := NewFileReader(bytes.NewReader(b))
+	_, err = fr.Header()
+	require.NoError(t, err)
+	expected, err := fr.IndexSearch(box)
+	require.NoError(t, err)
+	sr, err := r.Search(box)
+	require.NoError(t, err)
+	require.Len(t, sr, len(expected))
+
+	t.Run("Single", func(t *testing.T) {
+		for i := range sr {
+			f, err := r.FeatureForResult(sr[i])
+
+			require.NoError(t, err)
+			assert.Equal(t, featureString(t, &expected[i]), featureString(t, f), "result %d", i)
+		}
+	})
+
+	t.Run("Multiple", func(t *testing.T) {
+		fs, err := r.FeaturesForResults(sr)
+
+		require.NoError(t, err)
+		require.Len(t, fs, len(expected))
+		for i := range fs {
+			assert.Equal(t, featureString(t, &expected[i]), featureString(t, &fs[i]), "result %d", i)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		size := r.dataSize
+		bad := packedrtree.Result{Offset: size - 2, RefIndex: 178}
+
+		f, err := r.FeatureForResult(bad)
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read feature[178] (data offset %d): offset out of range [0, %d)", size-2, size))
+		assert.Nil(t, f)
+
+		fs, err := r.FeaturesForResults(packedrtree.Results{sr[0], bad})
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read feature[178] (data offset %d) for search result 1: offset out of range [0, %d)", size-2, size))
+		assert.Nil(t, fs)
+	})
+}
+
+func TestFileReaderAt_FeatureAt(t *testing.T) {
+	testCases := []string{"UScounties.fgb", "heterogeneous.fgb", "unknown_feature_count.fgb", "empty.fgb"}
+
+	for _, name := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := readTestFile(t, name)
+			fr := NewFileReader(bytes.NewReader(b))
+			_, err := fr.Header()
+			require.NoError(t, err)
+			_, err = fr.Index()
+			require.NoError(t, err)
+			expected, err := fr.DataRem()
+			require.NoError(t, err)
+			r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+			require.NoError(t, err)
+
+			offsets, err := r.FeatureOffsets()
+
+			require.NoError(t, err)
+			require.Len(t, offsets, len(expected))
+			// Read the features in reverse order to exercise random access.
+			for i := len(offsets) - 1; i >= 0; i-- {
+				f, err := r.FeatureAt(offsets[i])
+				require.NoError(t, err)
+				assert.Equal(t, featureString(t, &expected[i]), featureString(t, f), "feature %d", i)
+			}
+		})
+	}
+
+	t.Run("OffsetsMatchIndex", func(t *testing.T) {
+		b := readTestFile(t, "countries.fgb")
+		fr := NewFileReader(bytes.NewReader(b))
+		_, err := fr.Header()
+		require.NoError(t, err)
+		refs, err := ScanRefs(fr)
+		require.NoError(t, err)
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+
+		offsets, err := r.FeatureOffsets()
+
+		require.NoError(t, err)
+		require.Len(t, offsets, len(refs))
+		for i := range refs {
+			assert.Equal(t, refs[i].Offset, offsets[i])
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		b := readTestFile(t, "countries.fgb")
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+		size := r.dataSize
+
+		_, err = r.FeatureAt(-1)
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read feature at data offset -1: offset out of range [0, %d)", size))
+		_, err = r.FeatureAt(size)
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read feature at data offset %d: offset out of range [0, %d)", size, size))
+		_, err = r.FeatureAt(size - 2)
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read feature at data offset %d: offset out of range [0, %d)", size-2, size))
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		b := readTestFile(t, "countries.fgb")
+		b = b[:len(b)-10]
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+
+		offsets, err := r.FeatureOffsets()
+
+		assert.ErrorContains(t, err, "flatgeobuf: feature[178] extends 10 bytes past end of data section")
+		assert.Nil(t, offsets)
+	})
+}
+
+func TestFileReaderAt_PrefetchIndex(t *testing.T) {
+	testCases := []struct {
+		name          string
+		file          string
+		numFeatures   int
+		expectedReads int
+	}{
+		{"OneBlock", "countries.fgb", 179, 1},
+		{"ManyBlocks", "UScounties.fgb", 3221, 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			b := readTestFile(t, testCase.file)
+			c := &countingReaderAt{r: bytes.NewReader(b)}
+			r, err := NewFileReaderAt(c, int64(len(b)))
+			require.NoError(t, err)
+			indexSize, err := packedrtree.Size(testCase.numFeatures, 16)
+			require.NoError(t, err)
+			c.reads, c.n = 0, 0
+
+			err = r.PrefetchIndex()
+
+			require.NoError(t, err)
+			assert.Equal(t, int64(indexSize), c.n)
+			assert.Equal(t, testCase.expectedReads, c.reads)
+			assert.Equal(t, r.indexOffset, c.min)
+			assert.Equal(t, r.dataOffset, c.max)
+		})
+	}
+
+	t.Run("NoIndex", func(t *testing.T) {
+		b := readTestFile(t, "heterogeneous.fgb")
+		r, err := NewFileReaderAt(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+
+		err = r.PrefetchIndex()
+
+		assert.ErrorIs(t, err, ErrNoIndex)
+	})
+}
+
+// countingReaderAt wraps an io.ReaderAt, counting the number of ReadAt
+// calls and bytes read, and tracking the range of offsets read.
+type countingReaderAt struct {
+	r        io.ReaderAt
+	reads    int
+	n        int64
+	min, max int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	if c.reads == 0 || off < c.min {
+		c.min = off
+	}
+	if end := off + int64(n); c.reads == 0 || end > c.max {
+		c.max = end
+	}
+	c.reads++
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package flatgeobuf
+
+import (
+	"io"
+	"iter"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+)
+
+// All returns an iterator over the remaining features in the data
+// section, for use with range-over-func:
+//
+//	for f, err := range r.All() {
+//		if err != nil {
+//			// Handle error.
+//			break
+//		}
+//		// Use f.
+//	}
+//
+// The iterator reads features one at a time using Data, so the same
+// state rules apply: if the reader is positioned immediately after the
+// header, the index is skipped. Iteration stops cleanly at the end of
+// the data section. If a read error occurs, it is yielded with a nil
+// feature, after which iteration stops.
+//
+// Each feature yielded is a distinct value which remains valid after
+// the iteration advances.
+func (r *FileReader) All() iter.Seq2[*flat.Feature, error] {
+	return func(yield func(*flat.Feature, error) bool) {
+		for {
+			p := make([]flat.Feature, 1)
+			n, err := r.Data(p)
+			if n > 0 && !yield(&p[0], nil) {
+				return
+			}
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReader_All(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		expected int
+	}{
+		{"Indexed", "countries.fgb", 179},
+		{"NotIndexed", "heterogeneous.fgb", 3},
+		{"UnknownFeatureCount", "unknown_feature_count.fgb", 1},
+		{"Empty", "empty.fgb", 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, testCase.file)))
+			_, err := r.Header()
+			require.NoError(t, err)
+
+			var n int
+			for f, err := range r.All() {
+				require.NoError(t, err)
+				require.NotNil(t, f)
+				n++
+			}
+
+			assert.Equal(t, testCase.expected, n)
+		})
+	}
+
+	t.Run("Break", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		var n int
+		for _, err := range r.All() {
+			require.NoError(t, err)
+			n++
+			if n == 10 {
+				break
+			}
+		}
+
+		assert.Equal(t, 10, n)
+		rem, err := r.DataRem()
+		assert.NoError(t, err)
+		assert.Len(t, rem, 169)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		b := readTestFile(t, "heterogeneous.fgb")
+		r := NewFileReader(bytes.NewReader(b[0 : len(b)-1]))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		var n int
+		var lastErr error
+		for f, err := range r.All() {
+			if err != nil {
+				assert.Nil(t, f)
+				lastErr = err
+			} else {
+				n++
+			}
+		}
+
+		assert.Equal(t, 2, n)
+		assert.ErrorContains(t, lastErr, "failed to read feature[2]")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+
+		var errs []error
+		for _, err := range r.All() {
+			errs = append(errs, err)
+		}
+
+		assert.Equal(t, []error{textErr(errHeaderNotCalled)}, errs)
+	})
+}
@@ -6,14 +6,19 @@ package flatgeobuf
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/fs"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"unsafe"
 
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
 	"github.com/gogama/flatgeobuf/packedrtree"
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/stretchr/testify/assert"
@@ -125,3 +130,2099 @@ func TestHilbertSort(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestFileReader_HeaderNotCalled(t *testing.T) {
+	schema := headerSpec{columns: []columnSpec{{name: "name", typ: flat.ColumnTypeString}}}.build()
+	testCases := []struct {
+		name string
+		call func(r *FileReader) error
+	}{
+		{"Index", func(r *FileReader) error {
+			_, err := r.Index()
+			return err
+		}},
+		{"IndexSearch", func(r *FileReader) error {
+			_, err := r.IndexSearch(packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60})
+			return err
+		}},
+		{"Data", func(r *FileReader) error {
+			_, err := r.Data(make([]flat.Feature, 1))
+			return err
+		}},
+		{"DataRem", func(r *FileReader) error {
+			_, err := r.DataRem()
+			return err
+		}},
+		{"DataBatch", func(r *FileReader) error {
+			var buf []byte
+			_, err := r.DataBatch(1, &buf)
+			return err
+		}},
+		{"DataBestEffort", func(r *FileReader) error {
+			_, errs := r.DataBestEffort()
+			if len(errs) != 1 {
+				return fmt.Errorf("expected 1 error, got %v", errs)
+			}
+			return errs[0]
+		}},
+		{"CountFeatures", func(r *FileReader) error {
+			_, err := r.CountFeatures()
+			return err
+		}},
+		{"FeatureSizeStats", func(r *FileReader) error {
+			_, _, err := r.FeatureSizeStats()
+			return err
+		}},
+		{"PropertyEntropyEstimate", func(r *FileReader) error {
+			_, err := r.PropertyEntropyEstimate()
+			return err
+		}},
+		{"DistinctValues", func(r *FileReader) error {
+			_, err := r.DistinctValues(schema, 0)
+			return err
+		}},
+		{"GroupBy", func(r *FileReader) error {
+			_, err := r.GroupBy(func(*flat.Feature) string { return "" })
+			return err
+		}},
+		{"DataWhere", func(r *FileReader) error {
+			_, err := r.DataWhere(schema, func([]PropValue) bool { return true })
+			return err
+		}},
+		{"DataByOffset", func(r *FileReader) error {
+			_, err := r.DataByOffset()
+			return err
+		}},
+		{"FindDuplicateGeometries", func(r *FileReader) error {
+			_, err := r.FindDuplicateGeometries(0)
+			return err
+		}},
+		{"IndexSearchWhere", func(r *FileReader) error {
+			_, err := r.IndexSearchWhere(packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60}, schema, func([]PropValue) bool { return true })
+			return err
+		}},
+		{"PointLookup", func(r *FileReader) error {
+			_, _, err := r.PointLookup(schema, 0, 0, 0)
+			return err
+		}},
+		{"SmallestContaining", func(r *FileReader) error {
+			_, err := r.SmallestContaining(0, 0)
+			return err
+		}},
+		{"ScanIntersecting", func(r *FileReader) error {
+			_, err := r.ScanIntersecting(packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60})
+			return err
+		}},
+		{"VerifyIndexConsistency", func(r *FileReader) error {
+			return r.VerifyIndexConsistency()
+		}},
+		{"VerifyNoTrailingData", func(r *FileReader) error {
+			return r.VerifyNoTrailingData()
+		}},
+		{"IsDataHilbertSorted", func(r *FileReader) error {
+			_, err := r.IsDataHilbertSorted()
+			return err
+		}},
+		{"Rewind", func(r *FileReader) error {
+			return r.Rewind()
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+
+			var err error
+			require.NotPanics(t, func() { err = testCase.call(r) })
+
+			assert.EqualError(t, err, "flatgeobuf: "+errHeaderNotCalled)
+			_, err = r.Header()
+			assert.NoError(t, err, "reader must remain usable")
+		})
+	}
+}
+
+func TestFileReader_FeatureCountOverflow(t *testing.T) {
+	// Write just the magic number and header, since the features can't
+	// be written.
+	hdr := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 3_000_000_000}.build()
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	_, err := writeSizePrefixedTable(&buf, hdr.Table())
+	require.NoError(t, err)
+	file := buf.Bytes()
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+
+		hdr, err := r.Header()
+
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3_000_000_000), hdr.FeaturesCount())
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		// Simulate a 32-bit platform.
+		defer func(limit uint64) { maxFeatureCount = limit }(maxFeatureCount)
+		maxFeatureCount = math.MaxInt32
+		r := NewFileReader(bytes.NewReader(file))
+
+		hdr, err := r.Header()
+
+		assert.ErrorIs(t, err, ErrFeatureCountOverflow)
+		assert.EqualError(t, err, "flatgeobuf: feature count overflow: 3000000000 features exceeds platform limit of 2147483647")
+		require.NotNil(t, hdr, "header must be returned with overflow error")
+		assert.Equal(t, uint64(3_000_000_000), hdr.FeaturesCount())
+		_, err = r.Data(make([]flat.Feature, 1))
+		assert.ErrorIs(t, err, ErrFeatureCountOverflow, "error must be sticky")
+	})
+}
+
+func TestFileReader_IndexSearch(t *testing.T) {
+	file := readTestFile(t, "countries.fgb")
+	b := packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60} // Europe
+	search := func(t *testing.T, rd io.Reader) []string {
+		r := NewFileReader(rd)
+		_, err := r.Header()
+		require.NoError(t, err)
+		fs, err := r.IndexSearch(b)
+		require.NoError(t, err)
+		strs := make([]string, len(fs))
+		for i := range fs {
+			strs[i] = featureString(t, &fs[i])
+		}
+		return strs
+	}
+	expected := search(t, bytes.NewReader(file))
+	require.NotEmpty(t, expected)
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		actual := search(t, struct{ io.Reader }{bytes.NewReader(file)})
+
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestFileReader_DataWhere(t *testing.T) {
+	stateIs := func(state string) func([]PropValue) bool {
+		return func(vals []PropValue) bool {
+			for i := range vals {
+				if vals[i].ColIndex == 3 {
+					return vals[i].Value == state
+				}
+			}
+			return false
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		state    string
+		expected []string
+	}{
+		{"AZ", "AZ", []string{
+			"Apache", "Cochise", "Coconino", "Gila", "Graham", "Greenlee", "La Paz", "Maricopa",
+			"Mohave", "Navajo", "Pima", "Pinal", "Santa Cruz", "Yavapai", "Yuma",
+		}},
+		{"DC", "DC", []string{"District of Columbia"}},
+		{"NoMatch", "XX", nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+
+			fs, err := r.DataWhere(hdr, stateIs(testCase.state))
+
+			require.NoError(t, err)
+			var names []string
+			for i := range fs {
+				vals, err := NewPropReader(bytes.NewReader(fs[i].PropertiesBytes())).ReadSchema(hdr)
+				require.NoError(t, err)
+				assert.Equal(t, testCase.state, vals[3].Value)
+				names = append(names, vals[4].Value.(string))
+			}
+			sort.Strings(names)
+			assert.Equal(t, testCase.expected, names)
+			n, err := r.Data(make([]flat.Feature, 1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("Panic", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		assert.PanicsWithValue(t, "flatgeobuf: nil predicate", func() {
+			_, _ = r.DataWhere(hdr, nil)
+		})
+	})
+}
+
+func TestFileReader_DataByOffset(t *testing.T) {
+	t.Run("IndexLeaves", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		index, err := r.Index()
+		require.NoError(t, err)
+
+		m, err := r.DataByOffset()
+
+		require.NoError(t, err)
+		assert.Len(t, m, index.NumRefs())
+		for i, ref := range leafRefs(t, index) {
+			f, ok := m[ref.Offset]
+			if assert.True(t, ok, "leaf %d offset %d not in map", i, ref.Offset) {
+				b, err := FeatureBounds(&f)
+				require.NoError(t, err)
+				assert.Equal(t, ref.Box, b, "leaf %d offset %d", i, ref.Offset)
+			}
+		}
+		n, err := r.Data(make([]flat.Feature, 1))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("Remaining", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		refs, err := ScanRefs(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Rewind())
+		n, err := r.Data(make([]flat.Feature, 1000))
+		require.NoError(t, err)
+		require.Equal(t, 1000, n)
+
+		m, err := r.DataByOffset()
+
+		require.NoError(t, err)
+		assert.Len(t, m, len(refs)-1000)
+		for _, ref := range refs[1000:] {
+			assert.Contains(t, m, ref.Offset)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "empty.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		m, err := r.DataByOffset()
+
+		require.NoError(t, err)
+		assert.Empty(t, m)
+	})
+}
+
+func TestFileReader_FindDuplicateGeometries(t *testing.T) {
+	multi := func(side float64) featureSpec {
+		return featureSpec{geometry: &geometrySpec{
+			typ: flat.GeometryTypeMultiPolygon,
+			parts: []geometrySpec{
+				*squareSpec(0, 0, side).geometry,
+				*squareSpec(2, 2, 1).geometry,
+			},
+		}}
+	}
+	fss := []featureSpec{
+		squareSpec(0, 0, 1),         // 0
+		pointSpec(5, 5),             // 1
+		squareSpec(0, 0, 1),         // 2: same as 0
+		squareSpec(0, 0, 1.0000001), // 3: almost the same as 0
+		pointSpec(5, 5),             // 4: same as 1
+		pointSpec(-0.0000001, 9),    // 5
+		{},                          // 6: no geometry
+		{},                          // 7: no geometry
+		pointSpec(0, 9),             // 8: almost the same as 5
+		multi(1),                    // 9
+		multi(1),                    // 10: same as 9
+		multi(1.0000001),            // 11: almost the same as 9
+		{geometry: &geometrySpec{typ: flat.GeometryTypeMultiPoint, xy: []float64{5, 5}}}, // 12: type differs from 1
+	}
+	hs := headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: uint64(len(fss))}
+	file := writeTestFile(t, hs, fss)
+
+	testCases := []struct {
+		name     string
+		epsilon  float64
+		expected [][]int
+	}{
+		{"Exact", 0, [][]int{{0, 2}, {1, 4}, {9, 10}}},
+		{"Epsilon", 1e-3, [][]int{{0, 2, 3}, {1, 4}, {5, 8}, {9, 10, 11}}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+
+			dups, err := r.FindDuplicateGeometries(testCase.epsilon)
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, dups)
+			n, err := r.Data(make([]flat.Feature, 1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("Remaining", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		_, err = r.Data(make([]flat.Feature, 3))
+		require.NoError(t, err)
+
+		dups, err := r.FindDuplicateGeometries(0)
+
+		require.NoError(t, err)
+		assert.Equal(t, [][]int{{9, 10}}, dups)
+	})
+
+	t.Run("NoDuplicates", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		dups, err := r.FindDuplicateGeometries(0)
+
+		assert.NoError(t, err)
+		assert.Empty(t, dups)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		for _, epsilon := range []float64{-1, math.NaN(), math.Inf(1)} {
+			assert.PanicsWithValue(t, fmt.Sprintf("flatgeobuf: epsilon must be a non-negative finite number, got %g", epsilon), func() {
+				_, _ = r.FindDuplicateGeometries(epsilon)
+			})
+		}
+	})
+}
+
+func TestFileReader_NodeSize8(t *testing.T) {
+	// Write a grid of squares with a non-default node size, giving an
+	// index with four levels.
+	fss := make([]featureSpec, 500)
+	for i := range fss {
+		fss[i] = squareSpec(float64(i%25), float64(i/25), 0.5)
+	}
+	hs := headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: uint64(len(fss)), nodeSize: 8}
+	file := writeTestFile(t, hs, fss)
+	corners := func(t *testing.T, fs []flat.Feature) []string {
+		strs := make([]string, len(fs))
+		for i := range fs {
+			b, err := FeatureBounds(&fs[i])
+			require.NoError(t, err)
+			strs[i] = fmt.Sprintf("%g,%g", b.XMin, b.YMin)
+		}
+		sort.Strings(strs)
+		return strs
+	}
+	search := func(b packedrtree.Box) []string {
+		var strs []string
+		for i := range fss {
+			x, y := float64(i%25), float64(i/25)
+			if x <= b.XMax && x+0.5 >= b.XMin && y <= b.YMax && y+0.5 >= b.YMin {
+				strs = append(strs, fmt.Sprintf("%g,%g", x, y))
+			}
+		}
+		sort.Strings(strs)
+		return strs
+	}
+	boxes := []packedrtree.Box{
+		{XMin: 3.2, YMin: 4.2, XMax: 3.3, YMax: 4.3},
+		{XMin: 2.75, YMin: 2.75, XMax: 7.25, YMax: 9.25},
+		{XMin: -10, YMin: -10, XMax: 100, YMax: 100},
+		{XMin: 24.4, YMin: 19.4, XMax: 30, YMax: 30},
+	}
+	readers := map[string]func() io.Reader{
+		"Seekable":    func() io.Reader { return bytes.NewReader(file) },
+		"NotSeekable": func() io.Reader { return struct{ io.Reader }{bytes.NewReader(file)} },
+	}
+
+	for readerName, reader := range readers {
+		t.Run(readerName, func(t *testing.T) {
+			t.Run("Index", func(t *testing.T) {
+				r := NewFileReader(reader())
+				hdr, err := r.Header()
+				require.NoError(t, err)
+				require.Equal(t, uint16(8), hdr.IndexNodeSize())
+
+				index, err := r.Index()
+
+				require.NoError(t, err)
+				assert.Equal(t, uint16(8), index.NodeSize())
+				assert.Equal(t, len(fss), index.NumRefs())
+				for _, b := range boxes {
+					assert.Len(t, index.Search(b), len(search(b)), "box %s", b)
+				}
+				data, err := r.DataRem()
+				require.NoError(t, err)
+				assert.Len(t, data, len(fss))
+			})
+
+			for _, b := range boxes {
+				t.Run("IndexSearch"+b.String(), func(t *testing.T) {
+					r := NewFileReader(reader())
+					_, err := r.Header()
+					require.NoError(t, err)
+
+					fs, err := r.IndexSearch(b)
+
+					require.NoError(t, err)
+					assert.Equal(t, search(b), corners(t, fs))
+				})
+			}
+
+			t.Run("DataSkipsIndex", func(t *testing.T) {
+				r := NewFileReader(reader())
+				_, err := r.Header()
+				require.NoError(t, err)
+
+				data, err := r.DataRem()
+
+				require.NoError(t, err)
+				assert.Equal(t, search(boxes[2]), corners(t, data))
+			})
+		})
+	}
+
+	t.Run("Rewind", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		for _, b := range boxes {
+			fs, err := r.IndexSearch(b)
+
+			require.NoError(t, err)
+			assert.Equal(t, search(b), corners(t, fs))
+			require.NoError(t, r.Rewind())
+		}
+	})
+
+	t.Run("VerifyIndexConsistency", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		assert.NoError(t, r.VerifyIndexConsistency())
+	})
+}
+
+func TestFileReader_IndexSearchWhere(t *testing.T) {
+	file := readTestFile(t, "UScounties.fgb")
+	b := packedrtree.Box{XMin: -115, YMin: 31, XMax: -109, YMax: 37} // Arizona and its neighbours.
+	state := func(t *testing.T, hdr *flat.Header, f *flat.Feature) string {
+		vals, err := NewPropReader(bytes.NewReader(f.PropertiesBytes())).ReadSchema(hdr)
+		require.NoError(t, err)
+		return vals[3].Value.(string)
+	}
+	isAZ := func(vals []PropValue) bool {
+		for i := range vals {
+			if vals[i].ColIndex == 3 {
+				return vals[i].Value == "AZ"
+			}
+		}
+		return false
+	}
+
+	// Find the expected features by filtering the plain search results.
+	r := NewFileReader(bytes.NewReader(file))
+	hdr, err := r.Header()
+	require.NoError(t, err)
+	all, err := r.IndexSearch(b)
+	require.NoError(t, err)
+	var expected []string
+	for i := range all {
+		if state(t, hdr, &all[i]) == "AZ" {
+			expected = append(expected, featureString(t, &all[i]))
+		}
+	}
+	require.NotEmpty(t, expected)
+	require.Less(t, len(expected), len(all), "search box must include other states")
+
+	t.Run("Match", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		fs, err := r.IndexSearchWhere(b, hdr, isAZ)
+
+		require.NoError(t, err)
+		actual := make([]string, len(fs))
+		for i := range fs {
+			assert.Equal(t, "AZ", state(t, hdr, &fs[i]))
+			actual[i] = featureString(t, &fs[i])
+		}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		fs, err := r.IndexSearchWhere(b, hdr, func([]PropValue) bool { return false })
+
+		assert.NoError(t, err)
+		assert.Empty(t, fs)
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "unknown_feature_count.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		fs, err := r.IndexSearchWhere(b, hdr, isAZ)
+
+		assert.Same(t, ErrNoIndex, err)
+		assert.Nil(t, fs)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		assert.PanicsWithValue(t, "flatgeobuf: nil predicate", func() {
+			_, _ = r.IndexSearchWhere(b, hdr, nil)
+		})
+	})
+}
+
+func TestFileReader_PropertyEntropyEstimate(t *testing.T) {
+	for _, name := range []string{"UScounties.fgb", "countries.fgb"} {
+		t.Run(name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, name)))
+			_, err := r.Header()
+			require.NoError(t, err)
+
+			ratio, err := r.PropertyEntropyEstimate()
+
+			require.NoError(t, err)
+			assert.Greater(t, ratio, 0.0)
+			assert.Less(t, ratio, 1.0)
+			n, err := r.Data(make([]flat.Feature, 1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	properties := func(t *testing.T, value []byte) []byte {
+		var buf bytes.Buffer
+		w := NewPropWriter(&buf)
+		_, err := w.WriteUShort(0)
+		require.NoError(t, err)
+		_, err = w.WriteBinary(value)
+		require.NoError(t, err)
+		return buf.Bytes()
+	}
+	hs := headerSpec{
+		geometryType: flat.GeometryTypePoint,
+		numFeatures:  100,
+		columns:      []columnSpec{{name: "value", typ: flat.ColumnTypeBinary}},
+	}
+
+	t.Run("Redundant", func(t *testing.T) {
+		fss := make([]featureSpec, 100)
+		for i := range fss {
+			fss[i] = pointSpec(float64(i), float64(i))
+			fss[i].properties = properties(t, []byte(strings.Repeat("abcd", 64)))
+		}
+		r := NewFileReader(bytes.NewReader(writeTestFile(t, hs, fss)))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		ratio, err := r.PropertyEntropyEstimate()
+
+		require.NoError(t, err)
+		assert.Less(t, ratio, 0.1)
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(0))
+		fss := make([]featureSpec, 100)
+		for i := range fss {
+			value := make([]byte, 256)
+			_, _ = rnd.Read(value)
+			fss[i] = pointSpec(float64(i), float64(i))
+			fss[i].properties = properties(t, value)
+		}
+		r := NewFileReader(bytes.NewReader(writeTestFile(t, hs, fss)))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		ratio, err := r.PropertyEntropyEstimate()
+
+		require.NoError(t, err)
+		assert.Greater(t, ratio, 0.9)
+	})
+
+	t.Run("NoProperties", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "no_properties.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		ratio, err := r.PropertyEntropyEstimate()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, ratio)
+	})
+}
+
+func TestFileReader_DistinctValues(t *testing.T) {
+	t.Run("ColumnNotInSchema", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		values, err := r.DistinctValues(hdr, 6)
+
+		assert.EqualError(t, err, "flatgeobuf: column index 6 not in schema (6 columns)")
+		assert.Nil(t, values)
+	})
+
+	t.Run("USCountiesState", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		values, err := r.DistinctValues(hdr, 3)
+
+		require.NoError(t, err)
+		assert.True(t, sort.StringsAreSorted(values))
+		assert.Len(t, values, 52) // 50 states, DC, and PR.
+		assert.Equal(t, "AK", values[0])
+		assert.Contains(t, values, "DC")
+		assert.Contains(t, values, "PR")
+		assert.Equal(t, "WY", values[len(values)-1])
+		n, err := r.Data(make([]flat.Feature, 1))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+	})
+}
+
+func TestFileReader_GroupBy(t *testing.T) {
+	t.Run("USCountiesState", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		state := func(f *flat.Feature) string {
+			vals, err := NewPropReader(bytes.NewReader(f.PropertiesBytes())).ReadSchema(hdr)
+			require.NoError(t, err)
+			for i := range vals {
+				if string(vals[i].Col.Name()) == "STATE" {
+					return vals[i].Value.(string)
+				}
+			}
+			return ""
+		}
+
+		groups, err := r.GroupBy(state)
+
+		require.NoError(t, err)
+		assert.Len(t, groups, 52) // 50 states, DC, and PR.
+		var total int
+		for k, fs := range groups {
+			total += len(fs)
+			for i := range fs {
+				assert.Equal(t, k, state(&fs[i]))
+			}
+		}
+		assert.Equal(t, int(hdr.FeaturesCount()), total)
+		assert.Len(t, groups["DC"], 1)
+		assert.Len(t, groups["DE"], 3)
+		n, err := r.Data(make([]flat.Feature, 1))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("DataOrder", func(t *testing.T) {
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePoint}, []featureSpec{
+			pointSpec(1, 0), pointSpec(2, 0), pointSpec(3, 0), pointSpec(4, 0), pointSpec(5, 0),
+		})
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		parity := func(f *flat.Feature) string {
+			var g flat.Geometry
+			if int(f.Geometry(&g).Xy(0))%2 == 0 {
+				return "even"
+			}
+			return "odd"
+		}
+		xs := func(fs []flat.Feature) []float64 {
+			var x []float64
+			var g flat.Geometry
+			for i := range fs {
+				x = append(x, fs[i].Geometry(&g).Xy(0))
+			}
+			return x
+		}
+
+		groups, err := r.GroupBy(parity)
+
+		require.NoError(t, err)
+		require.Len(t, groups, 2)
+		assert.Equal(t, []float64{2, 4}, xs(groups["even"]))
+		assert.Equal(t, []float64{1, 3, 5}, xs(groups["odd"]))
+	})
+
+	t.Run("KeyPanics", func(t *testing.T) {
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePoint}, []featureSpec{
+			pointSpec(1, 0), pointSpec(2, 0),
+		})
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		var calls int
+
+		groups, err := r.GroupBy(func(*flat.Feature) string {
+			if calls++; calls == 2 {
+				panic("corrupt")
+			}
+			return ""
+		})
+
+		assert.EqualError(t, err, "flatgeobuf: failed to compute key of feature[1]: panic: flatbuffers: corrupt")
+		assert.Nil(t, groups)
+	})
+
+	t.Run("NilKey", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+
+		assert.PanicsWithValue(t, "flatgeobuf: nil key function", func() {
+			_, _ = r.GroupBy(nil)
+		})
+	})
+}
+
+func TestFileReader_PointLookup(t *testing.T) {
+	testCases := []struct {
+		name     string
+		x, y     float64
+		expected string
+		ok       bool
+	}{
+		{"Seattle", -122.33, 47.61, "King", true},
+		{"Houston", -95.37, 29.76, "Harris", true},
+		{"MidAtlantic", -40.0, 35.0, "", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+
+			name, ok, err := r.PointLookup(hdr, testCase.x, testCase.y, 4)
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.expected, name)
+		})
+	}
+
+	t.Run("NoIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "unknown_feature_count.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		_, ok, err := r.PointLookup(hdr, 0, 0, 0)
+
+		assert.Same(t, ErrNoIndex, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestFileReader_SmallestContaining(t *testing.T) {
+	// Three nested squares and a separate unit square. The data is
+	// written in index order, so the squares are not in the order
+	// listed.
+	file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: 5, nodeSize: 2}, []featureSpec{
+		squareSpec(0, 0, 10),
+		squareSpec(2, 2, 5),
+		squareSpec(3, 3, 1),
+		squareSpec(20, 20, 1),
+		squareSpec(2, 2, 5), // Same area as the second square.
+	})
+	lowerLeft := func(t *testing.T, f *flat.Feature) [2]float64 {
+		require.NotNil(t, f)
+		b, err := FeatureBounds(f)
+		require.NoError(t, err)
+		return [2]float64{b.XMin, b.XMax}
+	}
+
+	testCases := []struct {
+		name     string
+		x, y     float64
+		expected [2]float64
+	}{
+		{"Innermost", 3.5, 3.5, [2]float64{3, 4}},
+		{"Middle", 6, 6, [2]float64{2, 7}},
+		{"Outer", 9, 1, [2]float64{0, 10}},
+		{"OnBoundary", 4, 4, [2]float64{3, 4}},
+		{"Separate", 20.5, 20.5, [2]float64{20, 21}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+
+			f, err := r.SmallestContaining(testCase.x, testCase.y)
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, lowerLeft(t, f))
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		f, err := r.SmallestContaining(15, 15)
+
+		assert.NoError(t, err)
+		assert.Nil(t, f)
+	})
+
+	t.Run("USCounties", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+
+		f, err := r.SmallestContaining(-122.33, 47.61)
+
+		require.NoError(t, err)
+		require.NotNil(t, f)
+		vals, err := NewPropReader(bytes.NewReader(f.PropertiesBytes())).ReadSchema(hdr)
+		require.NoError(t, err)
+		assert.Equal(t, "King", vals[4].Value)
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "unknown_feature_count.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		f, err := r.SmallestContaining(0, 0)
+
+		assert.Same(t, ErrNoIndex, err)
+		assert.Nil(t, f)
+	})
+}
+
+func TestFileReader_ScanIntersecting(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	fss := make([]featureSpec, 300)
+	for i := range fss {
+		fss[i] = squareSpec(rnd.Float64()*100, rnd.Float64()*100, rnd.Float64()*5)
+	}
+	fss[17] = featureSpec{}
+	file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: uint64(len(fss))}, fss)
+
+	testCases := []struct {
+		name string
+		box  packedrtree.Box
+	}{
+		{"Everything", packedrtree.Box{XMin: -1, YMin: -1, XMax: 106, YMax: 106}},
+		{"Nothing", packedrtree.Box{XMin: 200, YMin: 200, XMax: 300, YMax: 300}},
+		{"Center", packedrtree.Box{XMin: 40, YMin: 40, XMax: 60, YMax: 60}},
+		{"Corner", packedrtree.Box{XMin: 0, YMin: 90, XMax: 10, YMax: 100}},
+		{"Point", packedrtree.Box{XMin: 50, YMin: 50, XMax: 50, YMax: 50}},
+		{"Empty", packedrtree.EmptyBox},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var expected []int
+			for i := range fss {
+				var b packedrtree.Box
+				if fss[i].geometry == nil {
+					b = packedrtree.EmptyBox
+				} else {
+					xy := fss[i].geometry.xy // Square: corners are (xy[0], xy[1]) and (xy[4], xy[5]).
+					b = packedrtree.Box{XMin: xy[0], YMin: xy[1], XMax: xy[4], YMax: xy[5]}
+				}
+				if b.IntersectsAny([]packedrtree.Box{testCase.box}) {
+					expected = append(expected, i)
+				}
+			}
+			r := NewFileReader(bytes.NewReader(file))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+			require.Equal(t, uint16(0), hdr.IndexNodeSize())
+
+			actual, err := r.ScanIntersecting(testCase.box)
+
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+			n, err := r.Data(make([]flat.Feature, 1))
+			assert.Equal(t, 0, n)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("Touching", func(t *testing.T) {
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: 3}, []featureSpec{
+			squareSpec(0, 0, 1), squareSpec(2, 0, 1), squareSpec(4, 0, 1),
+		})
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		actual, err := r.ScanIntersecting(packedrtree.Box{XMin: 1, YMin: 1, XMax: 2, YMax: 2})
+
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 1}, actual)
+	})
+}
+
+func TestFileReader_VerifyIndexConsistency(t *testing.T) {
+	for _, name := range []string{"countries.fgb", "UScounties.fgb", "poly00.fgb", "alldatatypes.fgb"} {
+		t.Run("Consistent/"+name, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, name)))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+
+			err = r.VerifyIndexConsistency()
+
+			require.NoError(t, err)
+			data, err := r.DataRem()
+			assert.NoError(t, err)
+			assert.Len(t, data, int(hdr.FeaturesCount()))
+		})
+	}
+
+	t.Run("Tampered", func(t *testing.T) {
+		// Swap the offsets of the first and last leaf nodes, which are
+		// far apart on the Hilbert curve.
+		b := readTestFile(t, "countries.fgb")
+		indexOffset := magicLen + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(b[magicLen:]))
+		indexSize, err := packedrtree.Size(179, 16)
+		require.NoError(t, err)
+		first := indexOffset + indexSize - 179*40 + 32
+		last := indexOffset + indexSize - 40 + 32
+		x, y := flatbuffers.GetInt64(b[first:]), flatbuffers.GetInt64(b[last:])
+		flatbuffers.WriteInt64(b[first:], y)
+		flatbuffers.WriteInt64(b[last:], x)
+		r := NewFileReader(bytes.NewReader(b))
+		_, err = r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyIndexConsistency()
+
+		assert.Error(t, err)
+		assert.Regexp(t, `^flatgeobuf: feature\[\d+\] \(offset \d+, bounds .*\) not found in index$`, err.Error())
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "heterogeneous.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyIndexConsistency()
+
+		assert.Same(t, ErrNoIndex, err)
+	})
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(readTestFile(t, "poly00.fgb"))})
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyIndexConsistency()
+
+		assert.EqualError(t, err, "flatgeobuf: can't verify index consistency: reader is not an io.Seeker")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "poly00.fgb")))
+
+		err := r.VerifyIndexConsistency()
+
+		assert.EqualError(t, err, "flatgeobuf: must call Header()")
+	})
+}
+
+func TestFileReader_IsDataHilbertSorted(t *testing.T) {
+	t.Run("Indexed", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		sorted, err := r.IsDataHilbertSorted()
+
+		assert.NoError(t, err)
+		assert.True(t, sorted)
+	})
+
+	t.Run("NonIndexed", func(t *testing.T) {
+		hs := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 4}
+		fss := []featureSpec{pointSpec(0, 0), pointSpec(10, 10), pointSpec(0, 10), pointSpec(10, 0)}
+		r := NewFileReader(bytes.NewReader(writeTestFile(t, hs, fss)))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		sorted, err := r.IsDataHilbertSorted()
+
+		assert.NoError(t, err)
+		assert.False(t, sorted)
+	})
+
+	t.Run("NonIndexedSorted", func(t *testing.T) {
+		hs := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 4}
+		fss := []featureSpec{pointSpec(10, 0), pointSpec(10, 10), pointSpec(0, 10), pointSpec(0, 0)}
+		r := NewFileReader(bytes.NewReader(writeTestFile(t, hs, fss)))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		sorted, err := r.IsDataHilbertSorted()
+
+		assert.NoError(t, err)
+		assert.True(t, sorted)
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+
+		_, err := r.IsDataHilbertSorted()
+
+		assert.EqualError(t, err, "flatgeobuf: must call Header()")
+	})
+}
+
+func TestFileReader_VerifyNoTrailingData(t *testing.T) {
+	file := readTestFile(t, "countries.fgb")
+
+	t.Run("Clean", func(t *testing.T) {
+		for _, name := range []string{"countries.fgb", "poly00.fgb", "unknown_feature_count.fgb"} {
+			t.Run(name, func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(readTestFile(t, name)))
+				_, err := r.Header()
+				require.NoError(t, err)
+
+				err = r.VerifyNoTrailingData()
+
+				assert.NoError(t, err)
+				_, err = r.Data(make([]flat.Feature, 1))
+				assert.Equal(t, io.EOF, err)
+			})
+		}
+	})
+
+	t.Run("PartlyRead", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		_, err = r.Data(make([]flat.Feature, 10))
+		require.NoError(t, err)
+
+		err = r.VerifyNoTrailingData()
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("FullyRead", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		_, err = r.DataRem()
+		require.NoError(t, err)
+
+		err = r.VerifyNoTrailingData()
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("TrailingData", func(t *testing.T) {
+		b := append(append([]byte{}, file...), "garbage"...)
+		r := NewFileReader(bytes.NewReader(b))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyNoTrailingData()
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: 7 bytes of trailing data after data section (offset %d)", len(file)))
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file[:len(file)-3]))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyNoTrailingData()
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: data section ends 3 bytes past end-of-file (offset %d)", len(file)-3))
+	})
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(file)})
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyNoTrailingData()
+
+		assert.EqualError(t, err, "flatgeobuf: can't verify trailing data: reader is not an io.Seeker")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+
+		err := r.VerifyNoTrailingData()
+
+		assert.EqualError(t, err, "flatgeobuf: "+errHeaderNotCalled)
+	})
+}
+
+func TestFileReader_CountFeatures(t *testing.T) {
+	t.Run("KnownCount", func(t *testing.T) {
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(readTestFile(t, "countries.fgb"))})
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		n, err := r.CountFeatures()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 179, n)
+	})
+
+	t.Run("UnknownCount", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "unknown_feature_count.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		n, err := r.CountFeatures()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 1, r.countedFeatures)
+		data, err := r.DataRem()
+		require.NoError(t, err)
+		assert.Len(t, data, 1)
+	})
+
+	file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePoint}, []featureSpec{
+		pointSpec(0, 0), pointSpec(1, 1), pointSpec(2, 2), pointSpec(3, 3), pointSpec(4, 4),
+	})
+
+	t.Run("PartlyRead", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		p := make([]flat.Feature, 2)
+		_, err = r.Data(p)
+		require.NoError(t, err)
+
+		n, err := r.CountFeatures()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		data, err := r.DataRem()
+		require.NoError(t, err)
+		require.Len(t, data, 3)
+		var g flat.Geometry
+		require.NotNil(t, data[0].Geometry(&g))
+		assert.Equal(t, 2.0, g.Xy(0))
+	})
+
+	t.Run("FullyRead", func(t *testing.T) {
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(file)})
+		_, err := r.Header()
+		require.NoError(t, err)
+		_, err = r.DataRem()
+		require.NoError(t, err)
+
+		n, err := r.CountFeatures()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		b := append([]byte{}, file...)
+		r := NewFileReader(bytes.NewReader(b))
+		_, err := r.Header()
+		require.NoError(t, err)
+		n, err := r.CountFeatures()
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+		// Corrupt the first feature length so that a recount would give
+		// a different result.
+		dataOffset := magicLen + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(b[magicLen:]))
+		flatbuffers.WriteUint32(b[dataOffset:], 0xffffffff)
+
+		n, err = r.CountFeatures()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+	})
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(file)})
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		_, err = r.CountFeatures()
+
+		assert.EqualError(t, err, "flatgeobuf: can't count features: reader is not an io.Seeker")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+
+		_, err := r.CountFeatures()
+
+		assert.EqualError(t, err, "flatgeobuf: "+errHeaderNotCalled)
+	})
+}
+
+func TestFileReader_MaxVertices(t *testing.T) {
+	t.Run("WithinLimit", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		r.MaxVertices = 1 << 20
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		data, err := r.DataRem()
+
+		assert.NoError(t, err)
+		assert.Len(t, data, 179)
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		multi := featureSpec{geometry: &geometrySpec{
+			typ: flat.GeometryTypeMultiPolygon,
+			parts: []geometrySpec{
+				*squareSpec(0, 0, 1).geometry,
+				*squareSpec(2, 2, 1).geometry,
+			},
+		}}
+		hs := headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: 4}
+		file := writeTestFile(t, hs, []featureSpec{pointSpec(0, 0), squareSpec(0, 0, 1), multi, pointSpec(1, 1)})
+		r := NewFileReader(bytes.NewReader(file))
+		r.MaxVertices = 5
+		_, err := r.Header()
+		require.NoError(t, err)
+		p := make([]flat.Feature, 4)
+
+		n, err := r.Data(p)
+
+		assert.Equal(t, 2, n)
+		assert.ErrorContains(t, err, "flatgeobuf: feature[2] has more than 5 vertices (offset ")
+
+		n, err = r.Data(p)
+
+		assert.Equal(t, 1, n)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("Crafted", func(t *testing.T) {
+		hs := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 1}
+		file := writeTestFile(t, hs, []featureSpec{pointSpec(123.5, -67.25)})
+		// Overwrite the length of the XY vector with an enormous value.
+		pattern := make([]byte, 12)
+		flatbuffers.WriteUint32(pattern, 2)
+		flatbuffers.WriteFloat64(pattern[4:], 123.5)
+		i := bytes.Index(file, pattern)
+		require.GreaterOrEqual(t, i, 0)
+		flatbuffers.WriteUint32(file[i:], 0x7ffffffe)
+		r := NewFileReader(bytes.NewReader(file))
+		r.MaxVertices = 1000
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		data, err := r.DataRem()
+
+		assert.EqualError(t, err, "flatgeobuf: feature[0] has more than 1000 vertices (offset 0)")
+		assert.Empty(t, data)
+	})
+}
+
+func TestFileReader_VerifyTables(t *testing.T) {
+	// Write three points, and locate the table of the middle one, which
+	// the test cases corrupt.
+	fss := []featureSpec{pointSpec(1, 2), pointSpec(123.5, -67.25), pointSpec(3, 4)}
+	hs := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 3}
+	file := writeTestFile(t, hs, fss)
+	sizes := make([]int, len(fss))
+	for i := range fss {
+		sizes[i] = len(fss[i].build().Table().Bytes)
+	}
+	start := len(file) - sizes[1] - sizes[2]
+	end := start + sizes[1]
+	tblPos := func(tbl []byte) int {
+		return flatbuffers.SizeUint32 + int(flatbuffers.GetUOffsetT(tbl[flatbuffers.SizeUint32:]))
+	}
+
+	testCases := []struct {
+		name     string
+		corrupt  func(tbl []byte)
+		expected string
+	}{
+		{
+			name: "RootOffset",
+			corrupt: func(tbl []byte) {
+				flatbuffers.WriteUOffsetT(tbl[flatbuffers.SizeUint32:], 0x7ffffff0)
+			},
+			expected: "root table position 2147483636 out of range [8, ",
+		},
+		{
+			name: "VTableOffset",
+			corrupt: func(tbl []byte) {
+				flatbuffers.WriteSOffsetT(tbl[tblPos(tbl):], -0x10000)
+			},
+			expected: "vtable position ",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			corrupt := make([]byte, len(file))
+			copy(corrupt, file)
+			testCase.corrupt(corrupt[start:end])
+
+			t.Run("Off", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(corrupt))
+				_, err := r.Header()
+				require.NoError(t, err)
+
+				data, err := r.DataRem()
+
+				require.NoError(t, err)
+				require.Len(t, data, 3)
+				assert.Error(t, validateFeature(&data[1]))
+			})
+
+			t.Run("On", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(corrupt))
+				r.VerifyTables = true
+				_, err := r.Header()
+				require.NoError(t, err)
+				p := make([]flat.Feature, 3)
+
+				n, err := r.Data(p)
+
+				assert.Equal(t, 1, n)
+				assert.ErrorContains(t, err, fmt.Sprintf("flatgeobuf: feature[1] failed table verification (offset %d): %s", sizes[0], testCase.expected))
+
+				n, err = r.Data(p)
+
+				assert.Equal(t, 1, n)
+				assert.Equal(t, io.EOF, err)
+				b, err := FeatureBounds(&p[0])
+				assert.NoError(t, err)
+				assert.Equal(t, packedrtree.Box{XMin: 3, YMin: 4, XMax: 3, YMax: 4}, b)
+			})
+		})
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		r.VerifyTables = true
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		data, err := r.DataRem()
+
+		assert.NoError(t, err)
+		assert.Len(t, data, 3221)
+	})
+}
+
+func TestFileReader_MaxHeaderLen(t *testing.T) {
+	file := readTestFile(t, "countries.fgb")
+	headerLen := int(flatbuffers.GetUint32(file[magicLen:]))
+
+	t.Run("Lower", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			maxLen int
+			err    string
+		}{
+			{"Exact", headerLen, ""},
+			{"OneLess", headerLen - 1, fmt.Sprintf("flatgeobuf: header length %d exceeds limit of %d bytes", headerLen, headerLen-1)},
+			{"Tiny", 8, fmt.Sprintf("flatgeobuf: header length %d exceeds limit of 8 bytes", headerLen)},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(file))
+				r.MaxHeaderLen = testCase.maxLen
+
+				hdr, err := r.Header()
+
+				if testCase.err == "" {
+					assert.NoError(t, err)
+					assert.NotNil(t, hdr)
+				} else {
+					assert.EqualError(t, err, testCase.err)
+					assert.Nil(t, hdr)
+				}
+			})
+		}
+	})
+
+	t.Run("Higher", func(t *testing.T) {
+		// Craft a truncated file declaring a header just over the
+		// default limit.
+		crafted := make([]byte, magicLen+4+16)
+		copy(crafted, file[:magicLen])
+		flatbuffers.WriteUint32(crafted[magicLen:], headerMaxLen+1)
+
+		t.Run("Default", func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(crafted))
+
+			_, err := r.Header()
+
+			assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: header length %d exceeds limit of %d bytes", headerMaxLen+1, headerMaxLen))
+		})
+
+		t.Run("Raised", func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(crafted))
+			r.MaxHeaderLen = 2 * headerMaxLen
+
+			_, err := r.Header()
+
+			assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: failed to read header table (len=%d): unexpected EOF", headerMaxLen+1))
+		})
+	})
+}
+
+func TestFileReader_Data(t *testing.T) {
+	t.Run("OneAllocationPerFeature", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		p := make([]flat.Feature, 1)
+		_, err = r.Data(p) // Skip the index before measuring.
+		require.NoError(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, err = r.Data(p)
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), allocs)
+	})
+}
+
+func TestFileReader_DataBatch(t *testing.T) {
+	readAll := func(t *testing.T, file []byte) []string {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		fs, err := r.DataRem()
+		require.NoError(t, err)
+		strs := make([]string, len(fs))
+		for i := range fs {
+			strs[i] = featureString(t, &fs[i])
+		}
+		return strs
+	}
+
+	testCases := []struct {
+		name string
+		file string
+	}{
+		{"KnownCount", "UScounties.fgb"},
+		{"UnknownCount", "unknown_feature_count.fgb"},
+		{"Empty", "empty.fgb"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			file := readTestFile(t, testCase.file)
+			expected := readAll(t, file)
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+			var buf []byte
+			actual := []string{}
+
+			for {
+				fs, err := r.DataBatch(50, &buf)
+				require.LessOrEqual(t, len(fs), 50)
+				for i := range fs {
+					actual = append(actual, featureString(t, &fs[i]))
+				}
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				require.Len(t, fs, 50)
+			}
+
+			assert.Equal(t, expected, actual)
+			fs, err := r.DataBatch(50, &buf)
+			assert.Empty(t, fs)
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("SharedBuffer", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		buf := make([]byte, 0, 1<<20)
+
+		fs, err := r.DataBatch(50, &buf)
+
+		require.NoError(t, err)
+		require.Len(t, fs, 50)
+		assert.Equal(t, 1<<20, cap(buf), "buffer must not be reallocated")
+		var total int
+		for i := range fs {
+			tbl := fs[i].Table().Bytes
+			assert.Same(t, &buf[total], &tbl[0], "feature %d must be a view into the buffer", i)
+			total += len(tbl)
+		}
+		assert.Equal(t, len(buf), total)
+	})
+
+	t.Run("MaxVertices", func(t *testing.T) {
+		fss := []featureSpec{pointSpec(0, 0), squareSpec(1, 1, 1), pointSpec(2, 2)}
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: uint64(len(fss))}, fss)
+		r := NewFileReader(bytes.NewReader(file))
+		r.MaxVertices = 1
+		_, err := r.Header()
+		require.NoError(t, err)
+		var buf []byte
+
+		fs, err := r.DataBatch(3, &buf)
+
+		assert.EqualError(t, err, fmt.Sprintf("flatgeobuf: feature[1] has more than 1 vertices (offset %d)", len(fs[0].Table().Bytes)))
+		require.Len(t, fs, 1)
+		assert.Equal(t, len(buf), len(fs[0].Table().Bytes))
+		fs, err = r.DataBatch(3, &buf)
+		assert.Equal(t, io.EOF, err)
+		require.Len(t, fs, 1)
+		var g flat.Geometry
+		require.NotNil(t, fs[0].Geometry(&g))
+		assert.Equal(t, 2.0, g.Xy(0))
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		var buf []byte
+
+		assert.PanicsWithValue(t, "flatgeobuf: batch size must be at least 1, got 0", func() {
+			_, _ = r.DataBatch(0, &buf)
+		})
+		assert.PanicsWithValue(t, "flatgeobuf: nil buffer", func() {
+			_, _ = r.DataBatch(1, nil)
+		})
+	})
+}
+
+func TestFileReader_DataBestEffort(t *testing.T) {
+	fss := []featureSpec{pointSpec(0, 0), squareSpec(1, 1, 1), pointSpec(2, 2), pointSpec(3, 3)}
+	file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: uint64(len(fss))}, fss)
+	dataOffset := magicLen + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(file[magicLen:]))
+
+	t.Run("NoCorruption", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, errs := r.DataBestEffort()
+
+		assert.Len(t, fs, 4)
+		assert.Empty(t, errs)
+	})
+
+	t.Run("CorruptFeature", func(t *testing.T) {
+		// Point the root offset of the second feature far outside the
+		// feature table.
+		b := append([]byte{}, file...)
+		second := dataOffset + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(file[dataOffset:]))
+		flatbuffers.WriteUint32(b[second+flatbuffers.SizeUint32:], 0x7fffffff)
+		r := NewFileReader(bytes.NewReader(b))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, errs := r.DataBestEffort()
+
+		require.Len(t, fs, 3)
+		for i, expected := range []float64{0, 2, 3} {
+			var g flat.Geometry
+			require.NotNil(t, fs[i].Geometry(&g))
+			assert.Equal(t, expected, g.Xy(0))
+		}
+		require.Len(t, errs, 1)
+		assert.Regexp(t, `^flatgeobuf: skipped corrupt feature\[1\] \(offset \d+\): panic: flatbuffers: `, errs[0].Error())
+	})
+
+	t.Run("MaxVertices", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		r.MaxVertices = 4
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, errs := r.DataBestEffort()
+
+		require.Len(t, fs, 3)
+		for i, expected := range []float64{0, 2, 3} {
+			var g flat.Geometry
+			require.NotNil(t, fs[i].Geometry(&g))
+			assert.Equal(t, expected, g.Xy(0))
+		}
+		require.Len(t, errs, 1)
+		assert.Regexp(t, `^flatgeobuf: feature\[1\] has more than 4 vertices \(offset \d+\)$`, errs[0].Error())
+	})
+
+	t.Run("VerifyTables", func(t *testing.T) {
+		b := append([]byte{}, file...)
+		second := dataOffset + flatbuffers.SizeUint32 + int(flatbuffers.GetUint32(file[dataOffset:]))
+		flatbuffers.WriteUint32(b[second+flatbuffers.SizeUint32:], 0x7fffffff)
+		r := NewFileReader(bytes.NewReader(b))
+		r.VerifyTables = true
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, errs := r.DataBestEffort()
+
+		assert.Len(t, fs, 3)
+		require.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "feature[1] failed table verification")
+	})
+
+	t.Run("TruncatedFile", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file[0 : len(file)-1]))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, errs := r.DataBestEffort()
+
+		assert.Len(t, fs, 3)
+		require.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "failed to read feature[3]")
+	})
+}
+
+func TestFileReader_FeatureSizeStats(t *testing.T) {
+	for _, name := range []string{"UScounties.fgb", "heterogeneous.fgb", "unknown_feature_count.fgb"} {
+		t.Run(name, func(t *testing.T) {
+			b := readTestFile(t, name)
+
+			// Compute the expected statistics manually.
+			r := NewFileReader(bytes.NewReader(b))
+			_, err := r.Header()
+			require.NoError(t, err)
+			data, err := r.DataRem()
+			require.NoError(t, err)
+			require.NotEmpty(t, data)
+			var total, expectedMax int
+			for i := range data {
+				size := len(data[i].Table().Bytes) - flatbuffers.SizeUint32
+				total += size
+				if size > expectedMax {
+					expectedMax = size
+				}
+			}
+			expectedMean := float64(total) / float64(len(data))
+
+			readers := map[string]io.Reader{
+				"Seekable":    bytes.NewReader(b),
+				"NotSeekable": struct{ io.Reader }{bytes.NewReader(b)},
+			}
+			for readerName, reader := range readers {
+				t.Run(readerName, func(t *testing.T) {
+					r := NewFileReader(reader)
+					_, err := r.Header()
+					require.NoError(t, err)
+
+					mean, max, err := r.FeatureSizeStats()
+
+					require.NoError(t, err)
+					assert.Equal(t, expectedMean, mean)
+					assert.Equal(t, expectedMax, max)
+					n, err := r.Data(make([]flat.Feature, 1))
+					assert.Equal(t, 0, n)
+					assert.Equal(t, io.EOF, err)
+				})
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "empty.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		mean, max, err := r.FeatureSizeStats()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, mean)
+		assert.Equal(t, 0, max)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		b := readTestFile(t, "poly00.fgb")
+		r := NewFileReader(struct{ io.Reader }{bytes.NewReader(b[0 : len(b)-10])})
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		_, _, err = r.FeatureSizeStats()
+
+		assert.ErrorContains(t, err, "failed to skip feature[9]")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "poly00.fgb")))
+
+		_, _, err := r.FeatureSizeStats()
+
+		assert.EqualError(t, err, "flatgeobuf: must call Header()")
+	})
+}
+
+func TestNewFileReaderWithIndex(t *testing.T) {
+	// Split countries.fgb into a data-only file and a sidecar index.
+	r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+	hdr, err := r.Header()
+	require.NoError(t, err)
+	index, err := r.Index()
+	require.NoError(t, err)
+	data, err := r.DataRem()
+	require.NoError(t, err)
+	var indexBuf bytes.Buffer
+	_, err = index.Marshal(&indexBuf)
+	require.NoError(t, err)
+	split := func(t *testing.T, numFeatures uint64) []byte {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(headerSpec{
+			name:         string(hdr.Name()),
+			geometryType: hdr.GeometryType(),
+			numFeatures:  numFeatures,
+		}.build())
+		require.NoError(t, err)
+		n := len(data)
+		if numFeatures > 0 {
+			n = int(numFeatures)
+		}
+		for i := 0; i < n; i++ {
+			_, err = w.Data(&data[i])
+			require.NoError(t, err)
+		}
+		return buf.Bytes()
+	}
+	dataOnly := split(t, 179)
+	sidecar := indexBuf.Bytes()
+
+	europe := packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60}
+	r = NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+	_, err = r.Header()
+	require.NoError(t, err)
+	expected, err := r.IndexSearch(europe)
+	require.NoError(t, err)
+	require.NotEmpty(t, expected)
+
+	readers := map[string]func() io.Reader{
+		"Seekable":    func() io.Reader { return bytes.NewReader(dataOnly) },
+		"NotSeekable": func() io.Reader { return struct{ io.Reader }{bytes.NewReader(dataOnly)} },
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			t.Run("IndexSearch", func(t *testing.T) {
+				r, err := NewFileReaderWithIndex(newReader(), bytes.NewReader(sidecar), 179, 16)
+				require.NoError(t, err)
+				_, err = r.Header()
+				require.NoError(t, err)
+
+				actual, err := r.IndexSearch(europe)
+
+				require.NoError(t, err)
+				require.Len(t, actual, len(expected))
+				for i := range expected {
+					assert.Equal(t, expected[i].Table().Bytes, actual[i].Table().Bytes)
+				}
+			})
+
+			t.Run("IndexThenData", func(t *testing.T) {
+				r, err := NewFileReaderWithIndex(newReader(), bytes.NewReader(sidecar), 179, 16)
+				require.NoError(t, err)
+				_, err = r.Header()
+				require.NoError(t, err)
+
+				prt, err := r.Index()
+
+				require.NoError(t, err)
+				assert.Equal(t, 179, prt.NumRefs())
+				assert.Equal(t, uint16(16), prt.NodeSize())
+				actual, err := r.DataRem()
+				require.NoError(t, err)
+				assert.Len(t, actual, 179)
+			})
+
+			t.Run("Data", func(t *testing.T) {
+				r, err := NewFileReaderWithIndex(newReader(), bytes.NewReader(sidecar), 179, 16)
+				require.NoError(t, err)
+				_, err = r.Header()
+				require.NoError(t, err)
+
+				actual, err := r.DataRem()
+
+				require.NoError(t, err)
+				require.Len(t, actual, 179)
+				assert.Equal(t, data[178].Table().Bytes, actual[178].Table().Bytes)
+			})
+		})
+	}
+
+	t.Run("Rewind", func(t *testing.T) {
+		r, err := NewFileReaderWithIndex(bytes.NewReader(dataOnly), bytes.NewReader(sidecar), 179, 16)
+		require.NoError(t, err)
+		_, err = r.Header()
+		require.NoError(t, err)
+		_, err = r.DataRem()
+		require.NoError(t, err)
+		require.NoError(t, r.Rewind())
+
+		actual, err := r.IndexSearch(europe)
+
+		require.NoError(t, err)
+		assert.Len(t, actual, len(expected))
+	})
+
+	t.Run("UnknownFeatureCount", func(t *testing.T) {
+		r, err := NewFileReaderWithIndex(bytes.NewReader(split(t, 0)), bytes.NewReader(sidecar), 179, 16)
+		require.NoError(t, err)
+		_, err = r.Header()
+		require.NoError(t, err)
+
+		actual, err := r.IndexSearch(europe)
+
+		require.NoError(t, err)
+		assert.Len(t, actual, len(expected))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		t.Run("FeatureCount", func(t *testing.T) {
+			_, err := NewFileReaderWithIndex(bytes.NewReader(dataOnly), bytes.NewReader(sidecar), 0, 16)
+
+			assert.EqualError(t, err, "flatgeobuf: external index feature count 0 not allowed (must be at least 1)")
+		})
+
+		t.Run("NodeSize", func(t *testing.T) {
+			_, err := NewFileReaderWithIndex(bytes.NewReader(dataOnly), bytes.NewReader(sidecar), 179, 1)
+
+			assert.EqualError(t, err, "flatgeobuf: external index node size 1 not allowed (must be at least 2)")
+		})
+
+		t.Run("TruncatedIndex", func(t *testing.T) {
+			_, err := NewFileReaderWithIndex(bytes.NewReader(dataOnly), bytes.NewReader(sidecar[0:100]), 179, 16)
+
+			assert.ErrorContains(t, err, "flatgeobuf: failed to read external index: ")
+		})
+
+		t.Run("DataHasIndex", func(t *testing.T) {
+			r, err := NewFileReaderWithIndex(bytes.NewReader(readTestFile(t, "countries.fgb")), bytes.NewReader(sidecar), 179, 16)
+			require.NoError(t, err)
+
+			_, err = r.Header()
+
+			assert.EqualError(t, err, "flatgeobuf: header index node size 16 not allowed with external index (must be 0)")
+		})
+
+		t.Run("CountMismatch", func(t *testing.T) {
+			r, err := NewFileReaderWithIndex(bytes.NewReader(split(t, 178)), bytes.NewReader(sidecar), 179, 16)
+			require.NoError(t, err)
+
+			_, err = r.Header()
+
+			assert.EqualError(t, err, "flatgeobuf: feature count mismatch (header=178, external index=179)")
+		})
+	})
+}
+
+func TestFileReader_DeferEOF(t *testing.T) {
+	file := readTestFile(t, "poly00.fgb")
+
+	testCases := []struct {
+		name string
+		read func(r *FileReader) (int, error)
+	}{
+		{"Data", func(r *FileReader) (int, error) {
+			return r.Data(make([]flat.Feature, 4))
+		}},
+		{"DataBatch", func(r *FileReader) (int, error) {
+			var buf []byte
+			fs, err := r.DataBatch(4, &buf)
+			return len(fs), err
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Run("Off", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(file))
+				_, err := r.Header()
+				require.NoError(t, err)
+				var ns []int
+
+				for err == nil {
+					var n int
+					n, err = testCase.read(r)
+					ns = append(ns, n)
+				}
+
+				assert.Equal(t, io.EOF, err)
+				assert.Equal(t, []int{4, 4, 2}, ns)
+			})
+
+			t.Run("On", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(file))
+				r.DeferEOF = true
+				_, err := r.Header()
+				require.NoError(t, err)
+
+				for pass := 0; pass < 2; pass++ {
+					var ns []int
+					for err = nil; err == nil; {
+						var n int
+						n, err = testCase.read(r)
+						ns = append(ns, n)
+					}
+
+					assert.Equal(t, io.EOF, err, "pass %d", pass)
+					assert.Equal(t, []int{4, 4, 2, 0}, ns, "pass %d", pass)
+					n, err := testCase.read(r)
+					assert.Equal(t, 0, n, "pass %d", pass)
+					assert.Equal(t, io.EOF, err, "pass %d", pass)
+					require.NoError(t, r.Rewind(), "pass %d", pass)
+				}
+			})
+
+			t.Run("RewindBeforeEOF", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(file))
+				r.DeferEOF = true
+				_, err := r.Header()
+				require.NoError(t, err)
+				for i := 0; i < 3; i++ {
+					_, err = testCase.read(r)
+					require.NoError(t, err)
+				}
+
+				require.NoError(t, r.Rewind())
+
+				data, err := r.DataRem()
+				require.NoError(t, err)
+				assert.Len(t, data, 10)
+			})
+		})
+	}
+}
+
+func TestFileReader_Rewind(t *testing.T) {
+	t.Run("IndexAgainAfterIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "poly00.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		index1, err := r.Index()
+		require.NoError(t, err)
+		require.NoError(t, r.Rewind())
+
+		index2, err := r.Index()
+
+		require.NoError(t, err)
+		assert.Same(t, index1, index2)
+		data, err := r.DataRem()
+		require.NoError(t, err)
+		assert.Len(t, data, 10)
+	})
+}
+
+// blockingReader is an io.Reader which, once armed, blocks in its next
+// Read call until released, so that a test can make another call on a
+// FileReader while the first is still in progress.
+type blockingReader struct {
+	io.Reader
+	armed   bool
+	blocked chan struct{}
+	resume  chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if r.armed {
+		r.armed = false
+		close(r.blocked)
+		<-r.resume
+	}
+	return r.Reader.Read(p)
+}
+
+func TestFileReader_ConcurrentUse(t *testing.T) {
+	br := &blockingReader{
+		Reader:  bytes.NewReader(readTestFile(t, "poly00.fgb")),
+		blocked: make(chan struct{}),
+		resume:  make(chan struct{}),
+	}
+	r := NewFileReader(br)
+	hdr, err := r.Header()
+	require.NoError(t, err)
+
+	// Start a Data call which blocks part way through reading.
+	br.armed = true
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := r.Data(make([]flat.Feature, 1))
+		done <- result{n, err}
+	}()
+	<-br.blocked
+
+	// A second call to any method which accesses the reader's state
+	// while the first is in progress panics.
+	var buf []byte
+	calls := map[string]func(){
+		"Data":                    func() { _, _ = r.Data(make([]flat.Feature, 1)) },
+		"DataRem":                 func() { _, _ = r.DataRem() },
+		"DataBatch":               func() { _, _ = r.DataBatch(1, &buf) },
+		"DataBestEffort":          func() { _, _ = r.DataBestEffort() },
+		"PropertyEntropyEstimate": func() { _, _ = r.PropertyEntropyEstimate() },
+		"DistinctValues":          func() { _, _ = r.DistinctValues(hdr, 0) },
+		"GroupBy":                 func() { _, _ = r.GroupBy(func(*flat.Feature) string { return "" }) },
+		"DataWhere":               func() { _, _ = r.DataWhere(hdr, func([]PropValue) bool { return true }) },
+		"DataByOffset":            func() { _, _ = r.DataByOffset() },
+		"FindDuplicateGeometries": func() { _, _ = r.FindDuplicateGeometries(0) },
+		"ScanIntersecting":        func() { _, _ = r.ScanIntersecting(packedrtree.Box{}) },
+		"IsDataHilbertSorted":     func() { _, _ = r.IsDataHilbertSorted() },
+		"VerifyIndexConsistency":  func() { _ = r.VerifyIndexConsistency() },
+		"Index":                   func() { _, _ = r.Index() },
+		"Rewind":                  func() { _ = r.Rewind() },
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			assert.PanicsWithValue(t, "flatgeobuf: concurrent use of FileReader (not safe for concurrent use)", call)
+		})
+	}
+
+	// The first call completes normally, after which the reader can be
+	// used again.
+	close(br.resume)
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, 1, res.n)
+	n, err := r.Data(make([]flat.Feature, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
@@ -6,16 +6,41 @@ package flatgeobuf
 
 import (
 	"io"
-	"math"
+	"runtime"
+	"sort"
 
 	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
 
 	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
 )
 
 // FileWriter writes a FlatGeobuf file to an underlying stream.
 type FileWriter struct {
 	stateful
+	// PackStrategy selects the order in which IndexData, IndexDataPtr,
+	// and IndexDataPtrAsync sort features before packing them into the
+	// spatial index. The zero value is packedrtree.Hilbert, which
+	// matches the reference FlatGeobuf implementations. The features
+	// are written to the data section in the order they are given.
+	//
+	// The chosen strategy is not recorded in the file, and readers do
+	// not need to know it: searching an index works correctly for any
+	// ordering, since the tree is built from the leaves in whatever
+	// order they are given.
+	PackStrategy packedrtree.PackStrategy
+	// StrictGeometryType, if true, makes the writer reject features
+	// whose geometry records a type other than the header geometry
+	// type. Geometries in a file with a known header geometry type
+	// usually leave their own type unset, so only geometries which set
+	// a conflicting type are rejected. The check has no effect when the
+	// header geometry type is Unknown.
+	//
+	// StrictGeometryType applies to Data and to all the methods which
+	// write an index together with its data, and is checked before the
+	// feature is written, so a rejected feature leaves the stream
+	// unchanged.
+	StrictGeometryType bool
 	// w is the stream to write to.
 	w io.Writer
 	// numFeatures is the number of features recorded in the FlatGeobuf
@@ -24,9 +49,20 @@ type FileWriter struct {
 	// nodeSize is the index node size recorded in the FlatGeobuf
 	// header.
 	nodeSize uint16
+	// geometryType is the geometry type recorded in the FlatGeobuf
+	// header.
+	geometryType flat.GeometryType
 	// featureIndex is the index of the next feature to write, a number
 	// in the range [0, numFeatures]
 	featureIndex int
+	// featureOffset is the offset into the data section of the next
+	// feature to write, a non-negative integer.
+	featureOffset int64
+	// featuresCountOffset is the stream offset of the feature count
+	// field within the header written by w. It will only have a
+	// non-zero value if w also implements io.Seeker and the header
+	// table physically contains the feature count field.
+	featuresCountOffset int64
 }
 
 // TODO: Docs
@@ -62,8 +98,8 @@ func (w *FileWriter) Header(hdr *flat.Header) (n int, err error) {
 		err = wrapErr("failed to get header feature count", err)
 		return
 	}
-	if numFeatures > math.MaxInt {
-		err = wrapErr("header feature count overflows int", err)
+	if numFeatures > maxFeatureCount {
+		err = featureCountOverflowErr(numFeatures)
 		return
 	}
 
@@ -82,6 +118,17 @@ func (w *FileWriter) Header(hdr *flat.Header) (n int, err error) {
 		return
 	}
 
+	// Cache geometry type.
+	var geometryType flat.GeometryType
+	err = safeFlatBuffersInteraction(func() error {
+		geometryType = hdr.GeometryType()
+		return nil
+	})
+	if err != nil {
+		err = wrapErr("failed to get header geometry type", err)
+		return
+	}
+
 	// Transition into state for writing magic number.
 	if err = w.toState(uninitialized, beforeMagic); err == errUnexpectedState {
 		err = textErr(errHeaderAlreadyCalled)
@@ -90,6 +137,28 @@ func (w *FileWriter) Header(hdr *flat.Header) (n int, err error) {
 		return
 	}
 
+	// If the writer is seekable, save the stream offset of the header's
+	// feature count field so it can be backfilled by CloseWithCount.
+	if s, ok := w.w.(io.Seeker); ok {
+		var start int64
+		if start, err = s.Seek(0, io.SeekCurrent); err != nil {
+			err = w.toErr(wrapErr("failed to query header offset", err))
+			return
+		}
+		var o flatbuffers.VOffsetT
+		if err = safeFlatBuffersInteraction(func() error {
+			t := hdr.Table()
+			o = t.Offset(headerFeaturesCountSlot)
+			return nil
+		}); err != nil {
+			err = w.toErr(wrapErr("failed to locate header feature count", err))
+			return
+		}
+		if o != 0 {
+			w.featuresCountOffset = start + magicLen + int64(hdr.Table().Pos) + int64(o)
+		}
+	}
+
 	// Write the magic number.
 	m, err := w.w.Write(magic[:])
 	n += m
@@ -111,9 +180,10 @@ func (w *FileWriter) Header(hdr *flat.Header) (n int, err error) {
 		return
 	}
 
-	// Save cached feature count and index node size.
+	// Save cached feature count, index node size, and geometry type.
 	w.numFeatures = int(numFeatures)
 	w.nodeSize = nodeSize
+	w.geometryType = geometryType
 
 	// Transition into the state for writing index.
 	err = w.toState(beforeHeader, afterHeader)
@@ -168,40 +238,95 @@ func (w *FileWriter) IndexData(data []flat.Feature) (n int, err error) {
 
 // TODO: Docs
 func (w *FileWriter) IndexDataPtr(data []*flat.Feature) (n int, err error) {
+	return w.indexDataPtr(data, 1)
+}
+
+// IndexDataPtrAsync is like IndexDataPtr, except that the per-feature
+// bounding box and size calculations needed to build the index are
+// split across up to workers goroutines. The Hilbert sort and all
+// writes remain single-threaded, and the output is identical to that
+// of IndexDataPtr.
+//
+// Despite the name, IndexDataPtrAsync does not return until the index
+// and all the data have been written. If workers is less than 1, the
+// value of runtime.GOMAXPROCS(0) is used.
+//
+// Parallelizing the calculations is mainly beneficial when writing
+// large numbers of features with complex geometries.
+func (w *FileWriter) IndexDataPtrAsync(data []*flat.Feature, workers int) (n int, err error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return w.indexDataPtr(data, workers)
+}
+
+// IndexDataSorted writes an index and data section in which the
+// features are laid out in the data section in the order established by
+// less, rather than in the order given. It can be used to keep related
+// features, for example those with the same value of some property,
+// next to each other in the file. The sort is stable, and the data
+// slice itself is not modified.
+//
+// The index is still packed using PackStrategy, with each leaf pointing
+// at the feature's position in the custom-ordered data section, so
+// spatial searches remain valid. However, the features matching a
+// search are scattered through the data section, so reading them
+// requires more seeking, and non-seekable readers must read past more
+// unwanted features.
+//
+// By convention, the data section of an indexed FlatGeobuf file is in
+// the same order as the index leaves, and some FlatGeobuf readers rely
+// on this, for example by assuming that the offsets of the features
+// matching a streaming search ascend. Files written by IndexDataSorted
+// break this convention, so other readers may mishandle them, for
+// example by failing to find some features. Use IndexDataSorted only
+// if the files will be read by readers known to handle them, such as
+// this package's FileReader.
+func (w *FileWriter) IndexDataSorted(data []*flat.Feature, less func(a, b *flat.Feature) bool) (n int, err error) {
+	if less == nil {
+		textPanic("nil less function")
+	}
+	return w.indexDataPtrSorted(data, 1, less)
+}
+
+func (w *FileWriter) indexDataPtr(data []*flat.Feature, workers int) (n int, err error) {
+	return w.indexDataPtrSorted(data, workers, nil)
+}
+
+// indexDataPtrSorted writes an index and data section. If less is nil,
+// the data are written in the order given. Otherwise, they are written
+// in the order established by less.
+func (w *FileWriter) indexDataPtrSorted(data []*flat.Feature, workers int, less func(a, b *flat.Feature) bool) (n int, err error) {
 	// Verify state.
 	if err = w.canWriteIndex(); err != nil {
 		return
 	}
 
-	// Create index.
-	refs := make([]packedrtree.Ref, len(data))
-	bounds := packedrtree.EmptyBox
-	var i int
-	err = safeFlatBuffersInteraction(func() error {
-		var offset int64
-		for i = range data {
-			refs[i].Offset = offset
-			var size uint32
-			if size, err = tableSize(data[i].Table()); err != nil {
-				return wrapErr("feature %d", err, i)
-			}
-			err = featureBounds(&refs[i].Box, data[i])
-			if err != nil {
-				return wrapErr("feature %d", err, i)
-			}
-			bounds.Expand(&refs[i].Box)
-			offset += int64(size)
+	// Validate feature geometry types before anything is written.
+	for i := range data {
+		if err = w.checkGeometryType(data[i], i); err != nil {
+			return
 		}
-		return nil
-	})
-	if err != nil {
-		err = wrapErr("failed to index feature %d", err, i)
-		return
 	}
-	packedrtree.HilbertSort(refs, bounds)
+
+	// Create index.
 	var index *packedrtree.PackedRTree
-	if index, err = packedrtree.New(refs, w.nodeSize); err != nil {
-		return
+	var order []int
+	if less == nil {
+		if index, err = indexFeatures(data, w.nodeSize, w.PackStrategy, workers); err != nil {
+			return
+		}
+	} else {
+		order = make([]int, len(data))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return less(data[order[i]], data[order[j]])
+		})
+		if index, err = indexFeaturesInOrder(data, order, w.nodeSize, w.PackStrategy, workers); err != nil {
+			return
+		}
 	}
 
 	// Write the index.
@@ -209,10 +334,14 @@ func (w *FileWriter) IndexDataPtr(data []*flat.Feature) (n int, err error) {
 		return
 	}
 
-	// Write the data.
-	for i = range data {
+	// Write the data in the chosen order.
+	for i := range data {
+		j := i
+		if order != nil {
+			j = order[i]
+		}
 		var o int
-		o, err = w.Data(data[i])
+		o, err = w.Data(data[j])
 		n += o
 		if err != nil {
 			return
@@ -237,6 +366,11 @@ func (w *FileWriter) Data(f *flat.Feature) (n int, err error) {
 		return
 	}
 
+	// Ensure the feature's geometry type is compatible with the header.
+	if err = w.checkGeometryType(f, w.featureIndex); err != nil {
+		return
+	}
+
 	// Enter feature writing state.
 	w.state = inData
 
@@ -249,6 +383,7 @@ func (w *FileWriter) Data(f *flat.Feature) (n int, err error) {
 		return
 	}
 	w.featureIndex++
+	w.featureOffset += int64(n)
 
 	// Check for EOF.
 	if w.featureIndex == w.numFeatures && w.numFeatures > 0 {
@@ -259,6 +394,76 @@ func (w *FileWriter) Data(f *flat.Feature) (n int, err error) {
 	return
 }
 
+// DataHilbert writes features to the data section in packed Hilbert
+// R-Tree order, and returns a ref for each one, in the order written,
+// holding the feature's bounding box and its byte offset within the
+// data section. It is intended for files with an external, or sidecar,
+// spatial index: the refs are already sorted, so they can be passed
+// directly to packedrtree.New to build the index, which can then be
+// read with NewFileReaderWithIndex.
+//
+// The features are sorted by the Hilbert value of their bounding box
+// centers, as by packedrtree.HilbertSort, regardless of PackStrategy.
+// Only the features passed in a single call are sorted together, but
+// DataHilbert may be mixed with Data, since the offsets account for any
+// features already written. The data slice itself is not modified.
+//
+// Like Data, DataHilbert can only write features to a file without an
+// index, or after the index is written. Every feature is measured, and
+// its geometry type checked, before anything is written.
+func (w *FileWriter) DataHilbert(data []*flat.Feature) (refs []packedrtree.Ref, n int, err error) {
+	// Minimally validate incoming pointers.
+	for i := range data {
+		if data[i] == nil {
+			fmtPanic("nil feature at index %d", i)
+		}
+	}
+
+	// Ensure we can write the features.
+	if err = w.canWriteData(); err != nil {
+		return
+	} else if w.numFeatures > 0 && len(data) > w.numFeatures-w.featureIndex {
+		err = fmtErr("can't write %d features: only %d of %d header-indicated features remain", len(data), w.numFeatures-w.featureIndex, w.numFeatures)
+		return
+	}
+	for i := range data {
+		if err = w.checkGeometryType(data[i], w.featureIndex+i); err != nil {
+			return
+		}
+	}
+
+	// Sort the features into Hilbert order. Until the data are written,
+	// use the offset field to remember each ref's position in the input.
+	refs = make([]packedrtree.Ref, len(data))
+	sizes := make([]uint32, len(data))
+	if err = measureFeatures(data, refs, sizes, 1); err != nil {
+		refs = nil
+		return
+	}
+	bounds := packedrtree.EmptyBox
+	for i := range refs {
+		refs[i].Offset = int64(i)
+		bounds.Expand(&refs[i].Box)
+	}
+	packedrtree.HilbertSort(refs, bounds)
+
+	// Write the data in Hilbert order, recording their final offsets.
+	for i := range refs {
+		j := int(refs[i].Offset)
+		refs[i].Offset = w.featureOffset
+		var o int
+		o, err = w.Data(data[j])
+		n += o
+		if err != nil {
+			refs = nil
+			return
+		}
+	}
+
+	// Successfully wrote all the data.
+	return
+}
+
 // TODO: Docs
 func (w *FileWriter) Close() error {
 	if err := w.close(w.w); err != nil {
@@ -270,6 +475,59 @@ func (w *FileWriter) Close() error {
 	}
 }
 
+// CloseWithCount backfills the header feature count with the number
+// of features actually written, and then closes the writer as if by
+// Close.
+//
+// CloseWithCount is intended for files whose header was written with
+// an unknown (zero) feature count. The underlying stream must be an
+// io.WriteSeeker, and the header passed to Header must physically
+// contain the feature count field. Because flat.HeaderAddFeaturesCount
+// omits the field when its value equals the default of zero, a header
+// with an unknown feature count must be built by calling
+// HeaderAddFeaturesCountForced in its place.
+//
+// If the header declared a known feature count, CloseWithCount is
+// equivalent to Close.
+func (w *FileWriter) CloseWithCount() error {
+	if w.err != nil {
+		return w.err
+	} else if w.state < afterHeader {
+		return textErr(errHeaderNotCalled)
+	} else if w.numFeatures > 0 {
+		return w.Close()
+	}
+
+	// Verify the feature count can be backfilled.
+	ws, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return textErr("can't backfill feature count: writer is not an io.WriteSeeker")
+	} else if w.featuresCountOffset == 0 {
+		return textErr("can't backfill feature count: header has no feature count field")
+	}
+
+	// Overwrite the feature count, which is a little-endian 8-byte
+	// unsigned integer, and return to the end of the data.
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return w.toErr(wrapErr("failed to query end offset", err))
+	}
+	if _, err = ws.Seek(w.featuresCountOffset, io.SeekStart); err != nil {
+		return w.toErr(wrapErr("failed to seek to header feature count", err))
+	}
+	b := make([]byte, flatbuffers.SizeUint64)
+	flatbuffers.WriteUint64(b, uint64(w.featureIndex))
+	if _, err = ws.Write(b); err != nil {
+		return w.toErr(wrapErr("failed to write header feature count", err))
+	}
+	if _, err = ws.Seek(end, io.SeekStart); err != nil {
+		return w.toErr(wrapErr("failed to seek to end offset", err))
+	}
+
+	// Close the writer.
+	return w.Close()
+}
+
 func (w *FileWriter) canWriteIndex() error {
 	if w.err != nil {
 		return w.err
@@ -310,16 +568,35 @@ func (w *FileWriter) canWriteData() error {
 	return nil
 }
 
-func featureBounds(b *packedrtree.Box, f *flat.Feature) error {
-	*b = packedrtree.EmptyBox
-	return safeFlatBuffersInteraction(func() error {
+// checkGeometryType verifies that a feature's geometry type is
+// compatible with the header geometry type. When the header geometry
+// type is Unknown, which is how FlatGeobuf represents files containing
+// mixed geometry types, every geometry must record its own type, since
+// otherwise readers have no way to interpret it. Otherwise, if
+// StrictGeometryType is set, a geometry which records its own type must
+// agree with the header.
+func (w *FileWriter) checkGeometryType(f *flat.Feature, i int) error {
+	if w.geometryType != flat.GeometryTypeUnknown && !w.StrictGeometryType {
+		return nil
+	}
+	var hasGeometry bool
+	var geometryType flat.GeometryType
+	if err := safeFlatBuffersInteraction(func() error {
 		var g flat.Geometry
 		if f.Geometry(&g) != nil {
-			n := g.XyLength()
-			for i := 0; i < n; i += 2 {
-				b.ExpandXY(g.Xy(i+0), g.Xy(i+1))
-			}
+			hasGeometry = true
+			geometryType = g.Type()
 		}
 		return nil
-	})
+	}); err != nil {
+		return wrapErr("failed to get feature %d geometry type", err, i)
+	}
+	if !hasGeometry {
+		return nil
+	} else if w.geometryType == flat.GeometryTypeUnknown && geometryType == flat.GeometryTypeUnknown {
+		return fmtErr("feature %d geometry type must be set when header geometry type is Unknown", i)
+	} else if w.geometryType != flat.GeometryTypeUnknown && geometryType != flat.GeometryTypeUnknown && geometryType != w.geometryType {
+		return fmtErr("feature %d geometry type %s conflicts with header geometry type %s", i, geometryType, w.geometryType)
+	}
+	return nil
 }
@@ -0,0 +1,625 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriter_CloseWithCount(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "unknown.fgb")
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		w := NewFileWriter(f)
+		_, err = w.Header(headerSpec{geometryType: flat.GeometryTypePoint, forceFeaturesCount: true}.build())
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			_, err = w.Data(pointSpec(float64(i), float64(i)).build())
+			require.NoError(t, err)
+		}
+
+		err = w.CloseWithCount()
+
+		require.NoError(t, err)
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		r := NewFileReader(bytes.NewReader(b))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), hdr.FeaturesCount())
+		data, err := r.DataRem()
+		assert.NoError(t, err)
+		assert.Len(t, data, 3)
+	})
+
+	t.Run("NotSeekable", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(headerSpec{forceFeaturesCount: true}.build())
+		require.NoError(t, err)
+
+		err = w.CloseWithCount()
+
+		assert.EqualError(t, err, "flatgeobuf: can't backfill feature count: writer is not an io.WriteSeeker")
+	})
+
+	t.Run("NoField", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "nofield.fgb"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = f.Close() })
+		w := NewFileWriter(f)
+		_, err = w.Header(headerSpec{}.build())
+		require.NoError(t, err)
+
+		err = w.CloseWithCount()
+
+		assert.EqualError(t, err, "flatgeobuf: can't backfill feature count: header has no feature count field")
+	})
+
+	t.Run("HeaderNotCalled", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+
+		err := w.CloseWithCount()
+
+		assert.EqualError(t, err, "flatgeobuf: must call Header()")
+	})
+}
+
+func TestFileWriter_FeatureCountOverflow(t *testing.T) {
+	// Simulate a 32-bit platform.
+	defer func(limit uint64) { maxFeatureCount = limit }(maxFeatureCount)
+	maxFeatureCount = math.MaxInt32
+	hdr := headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 3_000_000_000}.build()
+	w := NewFileWriter(io.Discard)
+
+	_, err := w.Header(hdr)
+
+	assert.ErrorIs(t, err, ErrFeatureCountOverflow)
+	assert.EqualError(t, err, "flatgeobuf: feature count overflow: 3000000000 features exceeds platform limit of 2147483647")
+}
+
+func TestFileWriter_IndexDataPtrAsync(t *testing.T) {
+	r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+	hdr, err := r.Header()
+	require.NoError(t, err)
+	data, err := r.DataRem()
+	require.NoError(t, err)
+	dataPtr := make([]*flat.Feature, len(data))
+	for i := range data {
+		dataPtr[i] = &data[i]
+	}
+	hdrBytes := hdr.Table().Bytes
+
+	write := func(t *testing.T, f func(w *FileWriter) (int, error)) []byte {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(flat.GetSizePrefixedRootAsHeader(hdrBytes, 0))
+		require.NoError(t, err)
+		_, err = f(w)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	expected := write(t, func(w *FileWriter) (int, error) {
+		return w.IndexDataPtr(dataPtr)
+	})
+
+	for _, workers := range []int{-1, 0, 1, 2, 3, 8, 500} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			actual := write(t, func(w *FileWriter) (int, error) {
+				return w.IndexDataPtrAsync(dataPtr, workers)
+			})
+
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		bad := make([]*flat.Feature, len(dataPtr))
+		copy(bad, dataPtr)
+		bad[100] = flat.GetRootAsFeature(bad[100].Table().Bytes, 0) // Not size-prefixed.
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(flat.GetSizePrefixedRootAsHeader(hdrBytes, 0))
+		require.NoError(t, err)
+
+		_, err = w.IndexDataPtrAsync(bad, 4)
+
+		assert.ErrorContains(t, err, "flatgeobuf: failed to index feature 100: ")
+	})
+}
+
+func BenchmarkFileWriter_IndexDataPtrAsync(b *testing.B) {
+	file, err := os.ReadFile("../testdata/flatgeobuf/UScounties.fgb")
+	require.NoError(b, err)
+	r := NewFileReader(bytes.NewReader(file))
+	hdr, err := r.Header()
+	require.NoError(b, err)
+	data, err := r.DataRem()
+	require.NoError(b, err)
+	dataPtr := make([]*flat.Feature, len(data))
+	for i := range data {
+		dataPtr[i] = &data[i]
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w := NewFileWriter(io.Discard)
+				if _, err := w.Header(hdr); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.IndexDataPtrAsync(dataPtr, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileWriter_MixedGeometryTypes(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		for _, nodeSize := range []uint16{0, 16} {
+			t.Run(fmt.Sprintf("nodeSize=%d", nodeSize), func(t *testing.T) {
+				hs := headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: 2, nodeSize: nodeSize}
+
+				file := writeTestFile(t, hs, []featureSpec{pointSpec(1, 2), squareSpec(3, 4, 5)})
+
+				r := NewFileReader(bytes.NewReader(file))
+				hdr, err := r.Header()
+				require.NoError(t, err)
+				assert.Equal(t, flat.GeometryTypeUnknown, hdr.GeometryType())
+				data, err := r.DataRem()
+				require.NoError(t, err)
+				require.Len(t, data, 2)
+				var g flat.Geometry
+				require.NotNil(t, data[0].Geometry(&g))
+				assert.Equal(t, flat.GeometryTypePoint, g.Type())
+				require.NotNil(t, data[1].Geometry(&g))
+				assert.Equal(t, flat.GeometryTypePolygon, g.Type())
+			})
+		}
+	})
+
+	t.Run("MissingType", func(t *testing.T) {
+		untyped := featureSpec{geometry: &geometrySpec{xy: []float64{1, 2}}}
+
+		t.Run("Data", func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFileWriter(&buf)
+			_, err := w.Header(headerSpec{geometryType: flat.GeometryTypeUnknown}.build())
+			require.NoError(t, err)
+			_, err = w.Data(pointSpec(0, 0).build())
+			require.NoError(t, err)
+			_, err = w.Data(featureSpec{}.build()) // No geometry is OK.
+			require.NoError(t, err)
+			m := buf.Len()
+
+			n, err := w.Data(untyped.build())
+
+			assert.EqualError(t, err, "flatgeobuf: feature 2 geometry type must be set when header geometry type is Unknown")
+			assert.Equal(t, 0, n)
+			assert.Equal(t, m, buf.Len())
+		})
+
+		t.Run("IndexDataPtr", func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFileWriter(&buf)
+			_, err := w.Header(headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: 2, nodeSize: 16}.build())
+			require.NoError(t, err)
+			m := buf.Len()
+
+			_, err = w.IndexDataPtr([]*flat.Feature{pointSpec(0, 0).build(), untyped.build()})
+
+			assert.EqualError(t, err, "flatgeobuf: feature 1 geometry type must be set when header geometry type is Unknown")
+			assert.Equal(t, m, buf.Len())
+		})
+
+		t.Run("TypedHeader", func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFileWriter(&buf)
+			_, err := w.Header(headerSpec{geometryType: flat.GeometryTypePoint}.build())
+			require.NoError(t, err)
+
+			_, err = w.Data(untyped.build())
+
+			assert.NoError(t, err)
+		})
+	})
+}
+
+func TestFileWriter_StrictGeometryType(t *testing.T) {
+	hs := headerSpec{geometryType: flat.GeometryTypePoint}
+	mismatched := squareSpec(0, 0, 1)
+	untyped := featureSpec{geometry: &geometrySpec{xy: []float64{1, 2}}}
+
+	t.Run("Off", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(hs.build())
+		require.NoError(t, err)
+
+		n, err := w.Data(mismatched.build())
+
+		assert.NoError(t, err)
+		assert.Greater(t, n, 0)
+	})
+
+	t.Run("On", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		w.StrictGeometryType = true
+		_, err := w.Header(hs.build())
+		require.NoError(t, err)
+		_, err = w.Data(pointSpec(0, 0).build()) // Matching type is OK.
+		require.NoError(t, err)
+		_, err = w.Data(untyped.build()) // Unset type is OK.
+		require.NoError(t, err)
+		_, err = w.Data(featureSpec{}.build()) // No geometry is OK.
+		require.NoError(t, err)
+		m := buf.Len()
+
+		n, err := w.Data(mismatched.build())
+
+		assert.EqualError(t, err, "flatgeobuf: feature 3 geometry type Polygon conflicts with header geometry type Point")
+		assert.Equal(t, 0, n)
+		assert.Equal(t, m, buf.Len())
+		_, err = w.Data(pointSpec(1, 1).build())
+		assert.NoError(t, err, "writer must remain usable")
+	})
+
+	t.Run("OnIndexDataPtr", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		w.StrictGeometryType = true
+		_, err := w.Header(headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 2, nodeSize: 16}.build())
+		require.NoError(t, err)
+		m := buf.Len()
+
+		_, err = w.IndexDataPtr([]*flat.Feature{pointSpec(0, 0).build(), mismatched.build()})
+
+		assert.EqualError(t, err, "flatgeobuf: feature 1 geometry type Polygon conflicts with header geometry type Point")
+		assert.Equal(t, m, buf.Len())
+	})
+
+	t.Run("OnUnknownHeader", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		w.StrictGeometryType = true
+		_, err := w.Header(headerSpec{geometryType: flat.GeometryTypeUnknown}.build())
+		require.NoError(t, err)
+
+		_, err = w.Data(mismatched.build())
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestFileWriter_PackStrategy(t *testing.T) {
+	r := NewFileReader(bytes.NewReader(readTestFile(t, "UScounties.fgb")))
+	hdr, err := r.Header()
+	require.NoError(t, err)
+	data, err := r.DataRem()
+	require.NoError(t, err)
+	dataPtr := make([]*flat.Feature, len(data))
+	for i := range data {
+		dataPtr[i] = &data[i]
+	}
+	hdrBytes := hdr.Table().Bytes
+	boxes := []packedrtree.Box{
+		{XMin: -130, YMin: 25, XMax: -65, YMax: 50},  // Contiguous USA
+		{XMin: -100, YMin: 30, XMax: -90, YMax: 40},  // Central
+		{XMin: -122, YMin: 47, XMax: -121, YMax: 48}, // Seattle area
+		{XMin: -20, YMin: -35, XMax: 50, YMax: 35},   // Africa
+	}
+
+	for _, ps := range []packedrtree.PackStrategy{packedrtree.Hilbert, packedrtree.Morton} {
+		t.Run(ps.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFileWriter(&buf)
+			w.PackStrategy = ps
+			_, err := w.Header(flat.GetSizePrefixedRootAsHeader(hdrBytes, 0))
+			require.NoError(t, err)
+			_, err = w.IndexDataPtr(dataPtr)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			t.Run("InputOrder", func(t *testing.T) {
+				r := NewFileReader(bytes.NewReader(buf.Bytes()))
+				_, err := r.Header()
+				require.NoError(t, err)
+
+				written, err := r.DataRem()
+
+				require.NoError(t, err)
+				require.Len(t, written, len(data))
+				for i := range written {
+					assert.Equal(t, featureString(t, &data[i]), featureString(t, &written[i]), "feature %d", i)
+				}
+			})
+
+			for _, b := range boxes {
+				t.Run(b.String(), func(t *testing.T) {
+					var expected []string
+					for i := range data {
+						fb, err := FeatureBounds(&data[i])
+						require.NoError(t, err)
+						if fb.XMin <= b.XMax && fb.XMax >= b.XMin && fb.YMin <= b.YMax && fb.YMax >= b.YMin {
+							expected = append(expected, featureString(t, &data[i]))
+						}
+					}
+					r := NewFileReader(bytes.NewReader(buf.Bytes()))
+					_, err := r.Header()
+					require.NoError(t, err)
+
+					actual, err := r.IndexSearch(b)
+
+					require.NoError(t, err)
+					actualStrings := make([]string, len(actual))
+					for i := range actual {
+						actualStrings[i] = featureString(t, &actual[i])
+					}
+					assert.ElementsMatch(t, expected, actualStrings)
+				})
+			}
+		})
+	}
+}
+
+func TestFileWriter_IndexDataSorted(t *testing.T) {
+	r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+	hdr, err := r.Header()
+	require.NoError(t, err)
+	data, err := r.DataRem()
+	require.NoError(t, err)
+	dataPtr := make([]*flat.Feature, len(data))
+	for i := range data {
+		dataPtr[i] = &data[i]
+	}
+	original := make([]*flat.Feature, len(dataPtr))
+	copy(original, dataPtr)
+	// Sort west to east, which is nothing like Hilbert order.
+	xMin := func(f *flat.Feature) float64 {
+		b, err := FeatureBounds(f)
+		require.NoError(t, err)
+		return b.XMin
+	}
+	less := func(a, b *flat.Feature) bool {
+		return xMin(a) < xMin(b)
+	}
+	var buf bytes.Buffer
+	w := NewFileWriter(&buf)
+	_, err = w.Header(flat.GetSizePrefixedRootAsHeader(hdr.Table().Bytes, 0))
+	require.NoError(t, err)
+
+	_, err = w.IndexDataSorted(dataPtr, less)
+
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, original, dataPtr, "input slice must not be modified")
+	file := buf.Bytes()
+
+	t.Run("DataOrder", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		actual, err := r.DataRem()
+
+		require.NoError(t, err)
+		require.Len(t, actual, len(data))
+		for i := 1; i < len(actual); i++ {
+			assert.False(t, less(&actual[i], &actual[i-1]), "feature[%d] out of order", i)
+		}
+	})
+
+	t.Run("IndexConsistency", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		err = r.VerifyIndexConsistency()
+
+		assert.NoError(t, err)
+	})
+
+	// Search both by streaming through the serialized index, and using
+	// an index cached in memory by a prior call to Index.
+	readers := map[string]func(t *testing.T) *FileReader{
+		"Streaming": func(t *testing.T) *FileReader {
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+			return r
+		},
+		"Cached": func(t *testing.T) *FileReader {
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+			_, err = r.Index()
+			require.NoError(t, err)
+			require.NoError(t, r.Rewind())
+			return r
+		},
+	}
+	boxes := []packedrtree.Box{
+		{XMin: -10, YMin: 35, XMax: 30, YMax: 60},   // Europe
+		{XMin: -20, YMin: -35, XMax: 50, YMax: 35},  // Africa
+		{XMin: -130, YMin: 25, XMax: -65, YMax: 50}, // USA
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			for _, b := range boxes {
+				t.Run(b.String(), func(t *testing.T) {
+					var expected []string
+					for i := range data {
+						fb, err := FeatureBounds(&data[i])
+						require.NoError(t, err)
+						if fb.IntersectsAny([]packedrtree.Box{b}) {
+							expected = append(expected, featureString(t, &data[i]))
+						}
+					}
+					r := newReader(t)
+
+					actual, err := r.IndexSearch(b)
+
+					require.NoError(t, err)
+					actualStrings := make([]string, len(actual))
+					for i := range actual {
+						actualStrings[i] = featureString(t, &actual[i])
+					}
+					assert.ElementsMatch(t, expected, actualStrings)
+				})
+			}
+		})
+	}
+}
+
+// featureString returns the raw bytes of a feature table as a string,
+// allowing features from different buffers to be compared.
+func featureString(t *testing.T, f *flat.Feature) string {
+	n, err := tableSize(f.Table())
+	require.NoError(t, err)
+	return string(f.Table().Bytes[:flatbuffers.SizeUint32+n])
+}
+
+func TestFileWriter_DataHilbert(t *testing.T) {
+	// Lay out a grid of squares in row-major order, which is nothing
+	// like Hilbert order.
+	var fss []featureSpec
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 15; x++ {
+			fss = append(fss, squareSpec(float64(10*x), float64(10*y), 5))
+		}
+	}
+	data := make([]*flat.Feature, len(fss))
+	for i := range fss {
+		data[i] = fss[i].build()
+	}
+	original := make([]*flat.Feature, len(data))
+	copy(original, data)
+	hs := headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: uint64(len(fss))}
+
+	// searchSidecar checks that searching a sidecar index built from the
+	// refs finds each feature.
+	searchSidecar := func(t *testing.T, file []byte, refs []packedrtree.Ref) {
+		index, err := packedrtree.New(refs, 4)
+		require.NoError(t, err)
+		var sidecar bytes.Buffer
+		_, err = index.Marshal(&sidecar)
+		require.NoError(t, err)
+		for i := range data {
+			b, err := FeatureBounds(data[i])
+			require.NoError(t, err)
+			r, err := NewFileReaderWithIndex(bytes.NewReader(file), bytes.NewReader(sidecar.Bytes()), len(data), 4)
+			require.NoError(t, err)
+			_, err = r.Header()
+			require.NoError(t, err)
+
+			fs, err := r.IndexSearch(packedrtree.Box{XMin: b.XMin + 1, YMin: b.YMin + 1, XMax: b.XMin + 1, YMax: b.YMin + 1})
+
+			require.NoError(t, err)
+			require.Len(t, fs, 1, "feature %d", i)
+			actualBounds, err := FeatureBounds(&fs[0])
+			require.NoError(t, err)
+			assert.Equal(t, b, actualBounds, "feature %d", i)
+		}
+	}
+
+	t.Run("Sidecar", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(hs.build())
+		require.NoError(t, err)
+
+		refs, n, err := w.DataHilbert(data)
+
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, original, data, "input slice must not be modified")
+		require.Len(t, refs, len(data))
+		file := buf.Bytes()
+
+		// The refs are in Hilbert order, and the data were written in the
+		// same order at the offsets recorded in the refs.
+		bounds := packedrtree.EmptyBox
+		for i := range refs {
+			bounds.Expand(&refs[i].Box)
+		}
+		sorted := make([]packedrtree.Ref, len(refs))
+		copy(sorted, refs)
+		packedrtree.HilbertSort(sorted, bounds)
+		assert.Equal(t, sorted, refs)
+		r := NewFileReader(bytes.NewReader(file))
+		_, err = r.Header()
+		require.NoError(t, err)
+		scanned, err := ScanRefs(r)
+		require.NoError(t, err)
+		assert.Equal(t, refs, scanned)
+		assert.Equal(t, refs[len(refs)-1].Offset+int64(len(data[len(data)-1].Table().Bytes)), int64(n))
+
+		searchSidecar(t, file, refs)
+	})
+
+	t.Run("AfterData", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(hs.build())
+		require.NoError(t, err)
+		n, err := w.Data(data[0])
+		require.NoError(t, err)
+		first := packedrtree.Ref{Offset: 0}
+		first.Box, err = FeatureBounds(data[0])
+		require.NoError(t, err)
+
+		refs, _, err := w.DataHilbert(data[1:])
+
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		require.Len(t, refs, len(data)-1)
+		assert.Equal(t, int64(n), refs[0].Offset)
+		searchSidecar(t, buf.Bytes(), append([]packedrtree.Ref{first}, refs...))
+	})
+
+	t.Run("TooMany", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: 2}.build())
+		require.NoError(t, err)
+		size := buf.Len()
+
+		refs, n, err := w.DataHilbert(data[0:3])
+
+		assert.EqualError(t, err, "flatgeobuf: can't write 3 features: only 2 of 2 header-indicated features remain")
+		assert.Nil(t, refs)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, size, buf.Len(), "nothing must be written")
+	})
+
+	t.Run("IndexNotWritten", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err := w.Header(headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: uint64(len(data)), nodeSize: 16}.build())
+		require.NoError(t, err)
+
+		_, _, err = w.DataHilbert(data)
+
+		assert.EqualError(t, err, "flatgeobuf: "+errIndexNotWritten)
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flat
+
+// GeometryWalker holds reusable Geometry views for traversing the
+// parts of a geometry with WalkParts. It keeps one view per level of
+// nesting, so once a walker has traversed a geometry of a given depth,
+// traversing geometries of the same or lesser depth doesn't allocate.
+//
+// The zero value is ready to use. A GeometryWalker may be reused for
+// any number of walks, but not by concurrent or nested walks.
+type GeometryWalker struct {
+	stack []Geometry
+}
+
+// WalkParts calls fn for each part of the geometry, recursively, in
+// depth-first order, so each part is visited before its own parts. The
+// receiver itself is not visited. The walk stops early if fn returns
+// false.
+//
+// The geometry passed to fn is a view owned by the walker, which is
+// overwritten as the walk proceeds, so fn must not retain it after
+// returning. If w is nil, a temporary walker is used.
+func (rcv *Geometry) WalkParts(w *GeometryWalker, fn func(*Geometry) bool) {
+	if w == nil {
+		w = &GeometryWalker{}
+	}
+	if len(w.stack) == 0 {
+		w.stack = append(w.stack, Geometry{})
+	}
+	w.stack[0] = *rcv
+	w.walk(0, fn)
+}
+
+// walk visits the parts of the geometry view at the given depth,
+// returning false if the walk was stopped by fn.
+func (w *GeometryWalker) walk(depth int, fn func(*Geometry) bool) bool {
+	n := w.stack[depth].PartsLength()
+	if n > 0 && len(w.stack) == depth+1 {
+		w.stack = append(w.stack, Geometry{})
+	}
+	for i := 0; i < n; i++ {
+		// Re-fetch the views on each iteration, since a deeper level
+		// may have grown the stack.
+		part := &w.stack[depth+1]
+		if !w.stack[depth].Parts(part, i) {
+			break
+		}
+		if !fn(part) || !w.walk(depth+1, fn) {
+			return false
+		}
+	}
+	return true
+}
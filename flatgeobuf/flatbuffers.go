@@ -7,13 +7,69 @@ package flatgeobuf
 import (
 	"fmt"
 	"io"
+	"runtime/debug"
+	"sync/atomic"
 
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
 	flatbuffers "github.com/google/flatbuffers/go"
 )
 
+// rethrowFlatBuffersPanics indicates whether panics trapped by
+// safeFlatBuffersInteraction should be rethrown rather than converted
+// to errors.
+var rethrowFlatBuffersPanics atomic.Bool
+
+// SetFlatBuffersPanicMode controls how this package handles panics
+// raised by the FlatBuffers library when it encounters malformed data.
+//
+// By default (rethrow is false), such panics are recovered and
+// converted to normal Go errors, so that corrupt input cannot crash the
+// program. If rethrow is true, the panic is instead rethrown with added
+// context, as a *FlatBuffersPanic which holds the original panic value
+// and the stack trace of the goroutine at the point it panicked.
+// This can be useful in development and testing, when the opaque error
+// would hide the root cause.
+//
+// SetFlatBuffersPanicMode affects the whole package and is safe to call
+// concurrently.
+func SetFlatBuffersPanicMode(rethrow bool) {
+	rethrowFlatBuffersPanics.Store(rethrow)
+}
+
+// FlatBuffersPanic is the panic value rethrown in place of a panic
+// raised by the FlatBuffers library, if rethrowing has been selected
+// using SetFlatBuffersPanicMode.
+//
+// Value is the original panic value. If it is an error, for example a
+// runtime.Error for an out-of-range index, it can be recovered from the
+// FlatBuffersPanic using errors.As or errors.Is. Stack is the stack
+// trace of the panicking goroutine, as returned by debug.Stack, captured
+// before rethrowing so that it includes the frames where the original
+// panic occurred.
+type FlatBuffersPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error describes the original panic value.
+func (p *FlatBuffersPanic) Error() string {
+	return fmt.Sprintf(packageName+"rethrown flatbuffers panic: %v", p.Value)
+}
+
+// Unwrap returns the original panic value if it is an error, and nil
+// otherwise.
+func (p *FlatBuffersPanic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
 // safeFlatBuffersInteraction runs a function that interacts with
 // FlatBuffers, trapping any panic that occurs and converting it to a
-// normal Go error.
+// normal Go error, or rethrowing it with context if this behavior has
+// been selected using SetFlatBuffersPanicMode.
+//
+// A *FlatBuffersPanic rethrown by a nested call is passed through
+// unchanged, so it keeps the original panic value and stack.
 //
 // This function exists because FlatBuffer's Go code doesn't use
 // standard Go error handling, allegedly for performance reasons, and
@@ -22,6 +78,11 @@ import (
 func safeFlatBuffersInteraction(f func() error) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if p, ok := r.(*FlatBuffersPanic); ok {
+				panic(p)
+			} else if rethrowFlatBuffersPanics.Load() {
+				panic(&FlatBuffersPanic{Value: r, Stack: debug.Stack()})
+			}
 			err = fmt.Errorf("panic: flatbuffers: %v", r)
 		}
 	}()
@@ -38,7 +99,7 @@ func writeSizePrefixedTable(w io.Writer, t flatbuffers.Table) (n int, err error)
 	var size uint32
 	if size, err = tableSize(t); err != nil {
 		return
-	} else if uint64(size) > uint64(len(t.Bytes)) {
+	} else if uint64(flatbuffers.SizeUint32)+uint64(size) > uint64(len(t.Bytes)) {
 		err = fmtErr("FlatBuffers table buffer is smaller than the size prefix (Len=%d, size=%d)", len(t.Bytes), size)
 		return
 	} else {
@@ -47,10 +108,110 @@ func writeSizePrefixedTable(w io.Writer, t flatbuffers.Table) (n int, err error)
 	}
 }
 
+// tableSize returns the size, excluding the size prefix itself, of a
+// size-prefixed root FlatBuffers table positioned at offset zero of its
+// buffer. An error is returned if the table does not meet these
+// constraints.
+//
+// A size-prefixed root table at offset zero begins with the 4-byte size
+// prefix, which is followed by the root uoffset_t, which in turn points
+// to the table position relative to itself.
 func tableSize(t flatbuffers.Table) (size uint32, err error) {
-	if t.Pos != flatbuffers.SizeUint32 {
+	if len(t.Bytes) < flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT ||
+		t.Pos != flatbuffers.SizeUint32+flatbuffers.GetUOffsetT(t.Bytes[flatbuffers.SizeUint32:]) {
 		err = fmtErr("not a size-prefixed root FlatBuffers table at offset 0 (Len=%d, Pos=%d)", len(t.Bytes), t.Pos)
+		return
 	}
 	size = flatbuffers.GetUint32(t.Bytes)
 	return
 }
+
+// verifyRootTable checks that the root table of a size-prefixed
+// FlatBuffers table at offset zero of tbl lies within tbl, together with
+// the table's vtable. Unlike validateFeature, it does not check the
+// table's fields, but it guarantees that accessing them won't index
+// outside tbl merely because the root uoffset_t is corrupt.
+//
+// The returned error text does not have the package prefix, since it is
+// intended to be wrapped.
+func verifyRootTable(tbl []byte) error {
+	n := int64(len(tbl))
+	if n < flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT {
+		return fmt.Errorf("table length %d too small for root uoffset_t", n)
+	}
+	pos := flatbuffers.SizeUint32 + int64(flatbuffers.GetUOffsetT(tbl[flatbuffers.SizeUint32:]))
+	if pos < flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT || pos+flatbuffers.SizeSOffsetT > n {
+		return fmt.Errorf("root table position %d out of range [%d, %d]", pos, flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT, n-flatbuffers.SizeSOffsetT)
+	}
+	vt := pos - int64(flatbuffers.GetSOffsetT(tbl[pos:]))
+	if vt < flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT || vt+2*flatbuffers.SizeVOffsetT > n {
+		return fmt.Errorf("vtable position %d out of range [%d, %d]", vt, flatbuffers.SizeUint32+flatbuffers.SizeUOffsetT, n-2*flatbuffers.SizeVOffsetT)
+	}
+	vtLen := int64(flatbuffers.GetVOffsetT(tbl[vt:]))
+	if vtLen < 2*flatbuffers.SizeVOffsetT || vt+vtLen > n {
+		return fmt.Errorf("vtable length %d at position %d exceeds table length %d", vtLen, vt, n)
+	}
+	objLen := int64(flatbuffers.GetVOffsetT(tbl[vt+flatbuffers.SizeVOffsetT:]))
+	if pos+objLen > n {
+		return fmt.Errorf("root table length %d at position %d exceeds table length %d", objLen, pos, n)
+	}
+	return nil
+}
+
+// validateFeature checks that a feature's FlatBuffers table can be
+// decoded, by touching every field, the last element of every vector,
+// and every nested table. It returns an error if any access fails.
+//
+// Because the FlatBuffers Go code reads data lazily, a malformed table
+// is not otherwise detected until the caller happens to access the
+// malformed part of it.
+func validateFeature(f *flat.Feature) error {
+	return safeFlatBuffersInteraction(func() error {
+		var g flat.Geometry
+		if f.Geometry(&g) != nil {
+			validateGeometry(&g)
+		}
+		_ = f.PropertiesBytes()
+		n := f.ColumnsLength()
+		for i := 0; i < n; i++ {
+			var col flat.Column
+			if f.Columns(&col, i) {
+				_ = col.Name()
+				_ = col.Type()
+			}
+		}
+		return nil
+	})
+}
+
+// validateGeometry is a helper for validateFeature which touches every
+// field of a geometry and recursively of its parts. It panics if the
+// geometry is malformed.
+func validateGeometry(g *flat.Geometry) {
+	_ = g.Type()
+	if n := g.EndsLength(); n > 0 {
+		_ = g.Ends(n - 1)
+	}
+	if n := g.XyLength(); n > 0 {
+		_ = g.Xy(n - 1)
+	}
+	if n := g.ZLength(); n > 0 {
+		_ = g.Z(n - 1)
+	}
+	if n := g.MLength(); n > 0 {
+		_ = g.M(n - 1)
+	}
+	if n := g.TLength(); n > 0 {
+		_ = g.T(n - 1)
+	}
+	if n := g.TmLength(); n > 0 {
+		_ = g.Tm(n - 1)
+	}
+	n := g.PartsLength()
+	for i := 0; i < n; i++ {
+		var part flat.Geometry
+		if g.Parts(&part, i) {
+			validateGeometry(&part)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFlatBuffersPanicMode(t *testing.T) {
+	// The root offset of this buffer points far outside the buffer, so
+	// any attempt to access a field of the table panics.
+	malformed := func() error {
+		f := flat.GetRootAsFeature([]byte{0xff, 0xff, 0xff, 0x7f}, 0)
+		_ = f.PropertiesLength()
+		return nil
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		SetFlatBuffersPanicMode(false)
+
+		err := safeFlatBuffersInteraction(malformed)
+
+		require.Error(t, err)
+		assert.Regexp(t, "^panic: flatbuffers: ", err.Error())
+	})
+
+	t.Run("Rethrow", func(t *testing.T) {
+		SetFlatBuffersPanicMode(true)
+		t.Cleanup(func() { SetFlatBuffersPanicMode(false) })
+
+		defer func() {
+			r := recover()
+			require.NotNil(t, r)
+			require.IsType(t, &FlatBuffersPanic{}, r)
+			p := r.(*FlatBuffersPanic)
+			assert.Regexp(t, "^flatgeobuf: rethrown flatbuffers panic: ", p.Error())
+			var re runtime.Error
+			assert.ErrorAs(t, p, &re, "original panic value must be preserved")
+			assert.Equal(t, re, p.Value)
+			assert.Contains(t, string(p.Stack), "flat.(*Feature).PropertiesLength", "original stack must be preserved")
+		}()
+		_ = safeFlatBuffersInteraction(malformed)
+		t.Fatal("expected panic was not rethrown")
+	})
+
+	t.Run("RethrowNested", func(t *testing.T) {
+		SetFlatBuffersPanicMode(true)
+		t.Cleanup(func() { SetFlatBuffersPanicMode(false) })
+
+		defer func() {
+			r := recover()
+			require.NotNil(t, r)
+			require.IsType(t, &FlatBuffersPanic{}, r)
+			p := r.(*FlatBuffersPanic)
+			var re runtime.Error
+			require.ErrorAs(t, p, &re)
+			assert.Equal(t, re, p.Value, "nested panic must not be wrapped again")
+			assert.Contains(t, string(p.Stack), "flat.(*Feature).PropertiesLength")
+		}()
+		_ = safeFlatBuffersInteraction(func() error {
+			return safeFlatBuffersInteraction(malformed)
+		})
+		t.Fatal("expected panic was not rethrown")
+	})
+}
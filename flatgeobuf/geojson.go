@@ -0,0 +1,219 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+)
+
+// GeometryGeoJSON converts a geometry to a GeoJSON geometry object, as
+// defined in RFC 7946, of the form {"type":...,"coordinates":...}. It
+// is intended for exporting geometries without their properties.
+//
+// The seven GeoJSON geometry types are supported: Point, MultiPoint,
+// LineString, MultiLineString, Polygon, MultiPolygon, and
+// GeometryCollection, whose parts are converted recursively using their
+// own types. The lines of a MultiLineString and the rings of a Polygon
+// are delimited by the geometry's Ends array. The polygons of a
+// MultiPolygon are its parts or, if it has no parts, the geometry's own
+// rings, which then form a single polygon. Z coordinates are included
+// as the third element of each position if present, and M coordinates
+// are dropped since GeoJSON can't represent them. The ring orientation
+// is not changed.
+//
+// An error is returned for geometry types which GeoJSON can't
+// represent, such as curves, surfaces, and TINs, and for the Unknown
+// type. Since a FlatGeobuf file whose features all have the same type
+// records the type only in the header, the feature geometries of such
+// a file have the Unknown type; use GeometryGeoJSONWithType to convert
+// them. An error is also returned if the geometry is malformed, if it
+// is an empty Point, which has no GeoJSON representation, or if it
+// contains a coordinate which is not a finite number.
+func GeometryGeoJSON(g *flat.Geometry) (string, error) {
+	return GeometryGeoJSONWithType(g, flat.GeometryTypeUnknown)
+}
+
+// GeometryGeoJSONWithType is like GeometryGeoJSON, but converts the
+// geometry as if it had type typ if its own type is Unknown. Parameter
+// typ should normally be the header geometry type, as returned by
+// flat.Header.GeometryType. If the geometry's own type is not Unknown,
+// typ is ignored.
+func GeometryGeoJSONWithType(g *flat.Geometry, typ flat.GeometryType) (string, error) {
+	if g == nil {
+		textPanic("nil geometry")
+	}
+	var b []byte
+	err := safeFlatBuffersInteraction(func() (err error) {
+		if t := g.Type(); t != flat.GeometryTypeUnknown {
+			typ = t
+		}
+		b, err = appendGeoJSONGeometry(b, g, typ)
+		return
+	})
+	if err != nil {
+		return "", wrapErr("can't convert geometry to GeoJSON", err)
+	}
+	return string(b), nil
+}
+
+// appendGeoJSONGeometry appends the GeoJSON object for a geometry of a
+// given type.
+func appendGeoJSONGeometry(b []byte, g *flat.Geometry, typ flat.GeometryType) ([]byte, error) {
+	n := g.XyLength()
+	if n%2 != 0 {
+		return b, fmt.Errorf("odd number of XY coordinates (%d)", n)
+	}
+	n /= 2
+	var err error
+	switch typ {
+	case flat.GeometryTypePoint:
+		b = append(b, `{"type":"Point","coordinates":`...)
+		if n == 0 {
+			return b, fmt.Errorf("point has no position")
+		} else if n > 1 {
+			return b, fmt.Errorf("point has %d positions", n)
+		} else {
+			b, err = appendGeoJSONPosition(b, g, 0)
+		}
+	case flat.GeometryTypeMultiPoint:
+		b = append(b, `{"type":"MultiPoint","coordinates":`...)
+		b, err = appendGeoJSONPositions(b, g, 0, n)
+	case flat.GeometryTypeLineString:
+		b = append(b, `{"type":"LineString","coordinates":`...)
+		b, err = appendGeoJSONPositions(b, g, 0, n)
+	case flat.GeometryTypeMultiLineString:
+		b = append(b, `{"type":"MultiLineString","coordinates":`...)
+		b, err = appendGeoJSONRings(b, g)
+	case flat.GeometryTypePolygon:
+		b = append(b, `{"type":"Polygon","coordinates":`...)
+		b, err = appendGeoJSONRings(b, g)
+	case flat.GeometryTypeMultiPolygon:
+		b = append(b, `{"type":"MultiPolygon","coordinates":[`...)
+		m := g.PartsLength()
+		if m == 0 {
+			b, err = appendGeoJSONRings(b, g)
+		}
+		for i := 0; i < m && err == nil; i++ {
+			var part flat.Geometry
+			if !g.Parts(&part, i) {
+				return b, fmt.Errorf("missing part %d", i)
+			}
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendGeoJSONRings(b, &part); err != nil {
+				err = fmt.Errorf("part %d: %w", i, err)
+			}
+		}
+		b = append(b, ']')
+	case flat.GeometryTypeGeometryCollection:
+		b = append(b, `{"type":"GeometryCollection","geometries":[`...)
+		m := g.PartsLength()
+		for i := 0; i < m && err == nil; i++ {
+			var part flat.Geometry
+			if !g.Parts(&part, i) {
+				return b, fmt.Errorf("missing part %d", i)
+			}
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendGeoJSONGeometry(b, &part, part.Type()); err != nil {
+				err = fmt.Errorf("part %d: %w", i, err)
+			}
+		}
+		b = append(b, ']')
+	default:
+		return b, fmt.Errorf("geometry type %s not supported by GeoJSON", typ)
+	}
+	if err != nil {
+		return b, err
+	}
+	return append(b, '}'), nil
+}
+
+// appendGeoJSONRings appends a GeoJSON array of position arrays, one for
+// each ring delimited by the geometry's Ends array, or a single ring
+// containing all positions if there is no Ends array.
+func appendGeoJSONRings(b []byte, g *flat.Geometry) ([]byte, error) {
+	n := g.XyLength() / 2
+	m := g.EndsLength()
+	var err error
+	b = append(b, '[')
+	if m == 0 {
+		b, err = appendGeoJSONPositions(b, g, 0, n)
+		return append(b, ']'), err
+	}
+	var start int
+	for i := 0; i < m; i++ {
+		end := int(g.Ends(i))
+		if end < start || end > n {
+			return b, fmt.Errorf("ring %d end %d out of range [%d, %d]", i, end, start, n)
+		}
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if b, err = appendGeoJSONPositions(b, g, start, end); err != nil {
+			return b, err
+		}
+		start = end
+	}
+	return append(b, ']'), nil
+}
+
+// appendGeoJSONPositions appends a GeoJSON array of the positions with
+// indices in the range [start, end).
+func appendGeoJSONPositions(b []byte, g *flat.Geometry, start, end int) ([]byte, error) {
+	b = append(b, '[')
+	for i := start; i < end; i++ {
+		if i > start {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = appendGeoJSONPosition(b, g, i); err != nil {
+			return b, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// appendGeoJSONPosition appends the GeoJSON position of the vertex with
+// index i, including its Z coordinate if the geometry has one.
+func appendGeoJSONPosition(b []byte, g *flat.Geometry, i int) ([]byte, error) {
+	b = append(b, '[')
+	b, err := appendGeoJSONNumber(b, g.Xy(2*i+0))
+	if err == nil {
+		b = append(b, ',')
+		b, err = appendGeoJSONNumber(b, g.Xy(2*i+1))
+	}
+	if err == nil && g.ZLength() > 0 {
+		if i >= g.ZLength() {
+			return b, fmt.Errorf("position %d has no Z coordinate", i)
+		}
+		b = append(b, ',')
+		b, err = appendGeoJSONNumber(b, g.Z(i))
+	}
+	if err != nil {
+		return b, fmt.Errorf("position %d: %w", i, err)
+	}
+	return append(b, ']'), nil
+}
+
+// appendGeoJSONNumber appends a coordinate as a JSON number, choosing
+// between decimal and exponent notation as the encoding/json package
+// does.
+func appendGeoJSONNumber(b []byte, v float64) ([]byte, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return b, fmt.Errorf("coordinate %v is not a finite number", v)
+	}
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	return strconv.AppendFloat(b, v, format, -1, 64), nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeometryGeoJSON(t *testing.T) {
+	square := func(x, y, side float64) []float64 {
+		return []float64{x, y, x + side, y, x + side, y + side, x, y + side, x, y}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			gs       geometrySpec
+			expected string
+		}{
+			{
+				name:     "Point",
+				gs:       geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{1.5, -2}},
+				expected: `{"type":"Point","coordinates":[1.5,-2]}`,
+			},
+			{
+				name:     "PointZ",
+				gs:       geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{1, 2}, z: []float64{3}},
+				expected: `{"type":"Point","coordinates":[1,2,3]}`,
+			},
+			{
+				name:     "PointExtremeValues",
+				gs:       geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{1e-7, 1e21}},
+				expected: `{"type":"Point","coordinates":[1e-07,1e+21]}`,
+			},
+			{
+				name:     "MultiPoint",
+				gs:       geometrySpec{typ: flat.GeometryTypeMultiPoint, xy: []float64{0, 0, 1, 1}},
+				expected: `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`,
+			},
+			{
+				name:     "LineString",
+				gs:       geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1, 1, 2, 0}},
+				expected: `{"type":"LineString","coordinates":[[0,0],[1,1],[2,0]]}`,
+			},
+			{
+				name:     "MultiLineString",
+				gs:       geometrySpec{typ: flat.GeometryTypeMultiLineString, xy: []float64{0, 0, 1, 1, 5, 5, 6, 6}, ends: []uint32{2, 4}},
+				expected: `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[5,5],[6,6]]]}`,
+			},
+			{
+				name:     "MultiLineStringNoEnds",
+				gs:       geometrySpec{typ: flat.GeometryTypeMultiLineString, xy: []float64{0, 0, 1, 1}},
+				expected: `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]]]}`,
+			},
+			{
+				name:     "Polygon",
+				gs:       geometrySpec{typ: flat.GeometryTypePolygon, xy: square(0, 0, 1)},
+				expected: `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}`,
+			},
+			{
+				name: "PolygonWithHole",
+				gs: geometrySpec{
+					typ:  flat.GeometryTypePolygon,
+					xy:   append(square(0, 0, 4), square(1, 1, 2)...),
+					ends: []uint32{5, 10},
+				},
+				expected: `{"type":"Polygon","coordinates":[[[0,0],[4,0],[4,4],[0,4],[0,0]],[[1,1],[3,1],[3,3],[1,3],[1,1]]]}`,
+			},
+			{
+				name: "MultiPolygon",
+				gs: geometrySpec{
+					typ: flat.GeometryTypeMultiPolygon,
+					parts: []geometrySpec{
+						{typ: flat.GeometryTypePolygon, xy: square(0, 0, 1)},
+						{xy: square(5, 5, 1)},
+					},
+				},
+				expected: `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,6],[5,5]]]]}`,
+			},
+			{
+				name:     "MultiPolygonNoParts",
+				gs:       geometrySpec{typ: flat.GeometryTypeMultiPolygon, xy: square(0, 0, 1)},
+				expected: `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,1],[0,0]]]]}`,
+			},
+			{
+				name: "GeometryCollection",
+				gs: geometrySpec{
+					typ: flat.GeometryTypeGeometryCollection,
+					parts: []geometrySpec{
+						{typ: flat.GeometryTypePoint, xy: []float64{1, 2}},
+						{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1, 1}},
+						{
+							typ:   flat.GeometryTypeGeometryCollection,
+							parts: []geometrySpec{{typ: flat.GeometryTypePolygon, xy: square(0, 0, 1)}},
+						},
+					},
+				},
+				expected: `{"type":"GeometryCollection","geometries":[` +
+					`{"type":"Point","coordinates":[1,2]},` +
+					`{"type":"LineString","coordinates":[[0,0],[1,1]]},` +
+					`{"type":"GeometryCollection","geometries":[{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}]}]}`,
+			},
+			{
+				name:     "GeometryCollectionEmpty",
+				gs:       geometrySpec{typ: flat.GeometryTypeGeometryCollection},
+				expected: `{"type":"GeometryCollection","geometries":[]}`,
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				actual, err := GeometryGeoJSON(testGeometry(testCase.gs))
+
+				require.NoError(t, err)
+				assert.Equal(t, testCase.expected, actual)
+				assert.True(t, json.Valid([]byte(actual)))
+			})
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			gs       geometrySpec
+			expected string
+		}{
+			{
+				name:     "Unknown",
+				gs:       geometrySpec{xy: []float64{1, 2}},
+				expected: "geometry type Unknown not supported by GeoJSON",
+			},
+			{
+				name:     "TIN",
+				gs:       geometrySpec{typ: flat.GeometryTypeTIN},
+				expected: "geometry type TIN not supported by GeoJSON",
+			},
+			{
+				name:     "OddXY",
+				gs:       geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 1}},
+				expected: "odd number of XY coordinates (3)",
+			},
+			{
+				name:     "PointEmpty",
+				gs:       geometrySpec{typ: flat.GeometryTypePoint},
+				expected: "point has no position",
+			},
+			{
+				name:     "PointTooManyPositions",
+				gs:       geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{0, 0, 1, 1}},
+				expected: "point has 2 positions",
+			},
+			{
+				name:     "EndOutOfRange",
+				gs:       geometrySpec{typ: flat.GeometryTypePolygon, xy: square(0, 0, 1), ends: []uint32{5, 6}},
+				expected: "ring 1 end 6 out of range [5, 5]",
+			},
+			{
+				name:     "NotFinite",
+				gs:       geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, math.NaN(), 1}},
+				expected: "position 1: coordinate NaN is not a finite number",
+			},
+			{
+				name: "CollectionPart",
+				gs: geometrySpec{
+					typ:   flat.GeometryTypeGeometryCollection,
+					parts: []geometrySpec{{typ: flat.GeometryTypePoint, xy: []float64{0, 0}}, {xy: []float64{1, 2}}},
+				},
+				expected: "part 1: geometry type Unknown not supported by GeoJSON",
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				actual, err := GeometryGeoJSON(testGeometry(testCase.gs))
+
+				assert.EqualError(t, err, "flatgeobuf: can't convert geometry to GeoJSON: "+testCase.expected)
+				assert.Empty(t, actual)
+			})
+		}
+	})
+
+	t.Run("WithType", func(t *testing.T) {
+		t.Run("Unknown", func(t *testing.T) {
+			g := testGeometry(geometrySpec{xy: []float64{0, 0, 1, 1}})
+
+			actual, err := GeometryGeoJSONWithType(g, flat.GeometryTypeLineString)
+
+			require.NoError(t, err)
+			assert.Equal(t, `{"type":"LineString","coordinates":[[0,0],[1,1]]}`, actual)
+		})
+
+		t.Run("Known", func(t *testing.T) {
+			g := testGeometry(geometrySpec{typ: flat.GeometryTypeMultiPoint, xy: []float64{0, 0, 1, 1}})
+
+			actual, err := GeometryGeoJSONWithType(g, flat.GeometryTypeLineString)
+
+			require.NoError(t, err)
+			assert.Equal(t, `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`, actual)
+		})
+
+		t.Run("File", func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, "poly00.fgb")))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+			require.Equal(t, flat.GeometryTypePolygon, hdr.GeometryType())
+			fs, err := r.DataRem()
+			require.NoError(t, err)
+			require.NotEmpty(t, fs)
+
+			for i := range fs {
+				g := fs[i].Geometry(nil)
+				require.NotNil(t, g, "feature %d", i)
+				require.Equal(t, flat.GeometryTypeUnknown, g.Type(), "feature %d", i)
+
+				actual, err := GeometryGeoJSONWithType(g, hdr.GeometryType())
+
+				require.NoError(t, err, "feature %d", i)
+				assert.True(t, strings.HasPrefix(actual, `{"type":"Polygon","coordinates":[[[`), "feature %d", i)
+				assert.True(t, json.Valid([]byte(actual)), "feature %d", i)
+			}
+		})
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		assert.PanicsWithValue(t, "flatgeobuf: nil geometry", func() {
+			_, _ = GeometryGeoJSON(nil)
+		})
+	})
+}
@@ -0,0 +1,448 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+)
+
+// FeatureBounds returns the bounding box of a feature's geometry. This
+// is the same bounding box FileWriter records for the feature in the
+// spatial index, so it can be used to query an index for a specific
+// feature.
+//
+// The bounding box is computed over the XY coordinates of the geometry
+// and, recursively, all of its parts. Z and M coordinates are ignored.
+// If the feature has no geometry, or the geometry has no coordinates,
+// the return value is packedrtree.EmptyBox. An error is returned if
+// the feature's FlatBuffers data is malformed.
+func FeatureBounds(f *flat.Feature) (packedrtree.Box, error) {
+	b := packedrtree.EmptyBox
+	err := safeFlatBuffersInteraction(func() error {
+		var g flat.Geometry
+		if f.Geometry(&g) != nil {
+			geometryBounds(&g, &b)
+		}
+		return nil
+	})
+	return b, err
+}
+
+// BoxAroundPoints returns the bounding box of a set of points, expanded
+// by padding on each side. It can be used to build an index search box
+// for finding features near several query points at once. If there are
+// no points, the return value is packedrtree.EmptyBox, which doesn't
+// intersect any box, and the padding is not applied.
+//
+// The padding must be a non-negative number in the same units as the
+// point coordinates.
+func BoxAroundPoints(points [][2]float64, padding float64) packedrtree.Box {
+	if !(padding >= 0) {
+		fmtPanic("padding must be non-negative, got %g", padding)
+	}
+	b := packedrtree.EmptyBox
+	if len(points) == 0 {
+		return b
+	}
+	for i := range points {
+		b.ExpandXY(points[i][0], points[i][1])
+	}
+	b.XMin -= padding
+	b.YMin -= padding
+	b.XMax += padding
+	b.YMax += padding
+	return b
+}
+
+// BoundedFeature wraps a feature together with its bounding box, which
+// is computed once when the BoundedFeature is created. It is useful for
+// code that repeatedly needs the bounds of the same features, for
+// example to sort or rank them, and would otherwise walk their
+// geometries each time using FeatureBounds.
+//
+// Since the bounding box is computed only once, it is not updated if
+// the underlying FlatBuffers data of the feature is later modified.
+type BoundedFeature struct {
+	*flat.Feature
+	box packedrtree.Box
+}
+
+// NewBoundedFeature creates a BoundedFeature wrapping f, computing the
+// bounding box of f as in FeatureBounds. An error is returned if the
+// feature's FlatBuffers data is malformed.
+func NewBoundedFeature(f *flat.Feature) (*BoundedFeature, error) {
+	if f == nil {
+		textPanic("nil feature")
+	}
+	b, err := FeatureBounds(f)
+	if err != nil {
+		return nil, err
+	}
+	return &BoundedFeature{Feature: f, box: b}, nil
+}
+
+// Box returns the bounding box of the wrapped feature, as computed by
+// FeatureBounds when the BoundedFeature was created.
+func (bf *BoundedFeature) Box() packedrtree.Box {
+	return bf.box
+}
+
+// geometryBounds expands a bounding box to include the XY coordinates
+// of a geometry and all of its parts.
+func geometryBounds(g *flat.Geometry, b *packedrtree.Box) {
+	n := g.XyLength()
+	for i := 0; i < n; i += 2 {
+		b.ExpandXY(g.Xy(i+0), g.Xy(i+1))
+	}
+	n = g.PartsLength()
+	for i := 0; i < n; i++ {
+		var part flat.Geometry
+		if g.Parts(&part, i) {
+			geometryBounds(&part, b)
+		}
+	}
+}
+
+// featureVertices counts the XY vertices of a feature's geometry and
+// all of its parts, using only the recorded vector lengths. Counting
+// stops as soon as the count exceeds max, so the return value is only
+// exact if it is at most max.
+func featureVertices(f *flat.Feature, max int) int {
+	var g flat.Geometry
+	if f.Geometry(&g) == nil {
+		return 0
+	}
+	return geometryVertices(&g, 0, max)
+}
+
+// geometryVertices adds the number of XY vertices in a geometry and all
+// of its parts to count, stopping as soon as the count exceeds max.
+func geometryVertices(g *flat.Geometry, count, max int) int {
+	count += g.XyLength() / 2
+	n := g.PartsLength()
+	for i := 0; i < n && count <= max; i++ {
+		var part flat.Geometry
+		if g.Parts(&part, i) {
+			count = geometryVertices(&part, count, max)
+		}
+	}
+	return count
+}
+
+// PointInGeometry reports whether the point (x, y) lies inside the
+// area covered by a polygonal geometry. It can be used to refine the
+// results of an index search, which only compares bounding boxes, to
+// true geometric containment.
+//
+// Containment is tested by ray casting using the even-odd rule over
+// all the rings of each polygon, so points inside a hole are correctly
+// reported as outside the polygon. The rings of a polygon are
+// delimited by the geometry's Ends array. For multi-part geometries
+// (MultiPolygon, PolyhedralSurface, TIN, and GeometryCollection), the
+// point is inside the geometry if it is inside any part. Points exactly
+// on a ring boundary may be reported as either inside or outside.
+//
+// Non-polygonal geometries, such as points and line strings, have no
+// area and never contain a point. Nor does a geometry whose type is
+// Unknown, since its shape can't be interpreted. Since a FlatGeobuf
+// file whose features all have the same type records the type only in
+// the header, the feature geometries of such a file have the Unknown
+// type; use PointInGeometryWithType to test them.
+//
+// Since PointInGeometry accesses the FlatBuffers data directly, it may
+// panic if the geometry is malformed.
+func PointInGeometry(g *flat.Geometry, x, y float64) bool {
+	return PointInGeometryWithType(g, flat.GeometryTypeUnknown, x, y)
+}
+
+// PointInGeometryWithType is like PointInGeometry, but tests the
+// geometry as if it had type typ if its own type is Unknown. Parameter
+// typ should normally be the header geometry type, as returned by
+// flat.Header.GeometryType. If the geometry's own type is not Unknown,
+// typ is ignored. The parts of a MultiPolygon or PolyhedralSurface
+// whose type is Unknown are tested as polygons, and those of a TIN as
+// triangles.
+func PointInGeometryWithType(g *flat.Geometry, typ flat.GeometryType, x, y float64) bool {
+	if t := g.Type(); t != flat.GeometryTypeUnknown {
+		typ = t
+	}
+	switch typ {
+	case flat.GeometryTypePolygon, flat.GeometryTypeTriangle:
+		return pointInRings(g, x, y)
+	case flat.GeometryTypeMultiPolygon, flat.GeometryTypePolyhedralSurface,
+		flat.GeometryTypeTIN, flat.GeometryTypeGeometryCollection:
+		return pointInParts(g, partType(typ), x, y)
+	default:
+		return false
+	}
+}
+
+// partType returns the type implied for the parts of a multi-part
+// geometry of a given type whose own type is Unknown, or Unknown if the
+// parts of such a geometry must record their own types.
+func partType(typ flat.GeometryType) flat.GeometryType {
+	switch typ {
+	case flat.GeometryTypeMultiPolygon, flat.GeometryTypePolyhedralSurface:
+		return flat.GeometryTypePolygon
+	case flat.GeometryTypeTIN:
+		return flat.GeometryTypeTriangle
+	case flat.GeometryTypeMultiLineString:
+		return flat.GeometryTypeLineString
+	default:
+		return flat.GeometryTypeUnknown
+	}
+}
+
+// pointInParts reports whether the point (x, y) is inside any part of
+// a multi-part geometry whose parts have type typ unless they record
+// their own type.
+func pointInParts(g *flat.Geometry, typ flat.GeometryType, x, y float64) bool {
+	n := g.PartsLength()
+	for i := 0; i < n; i++ {
+		var part flat.Geometry
+		if g.Parts(&part, i) && PointInGeometryWithType(&part, typ, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInRings reports whether the point (x, y) is inside a polygon
+// made up of one or more rings, using the even-odd rule.
+func pointInRings(g *flat.Geometry, x, y float64) bool {
+	numPoints := uint32(g.XyLength() / 2)
+	numRings := g.EndsLength()
+	inside := false
+	var start uint32
+	for i := 0; i == 0 || i < numRings; i++ {
+		end := numPoints
+		if numRings > 0 {
+			end = g.Ends(i)
+			if end > numPoints {
+				end = numPoints
+			}
+		}
+		if crossesRing(g, start, end, x, y) {
+			inside = !inside
+		}
+		start = end
+	}
+	return inside
+}
+
+// crossesRing reports whether a horizontal ray cast from the point
+// (x, y) crosses the ring formed by the coordinate pairs in the range
+// [start, end) an odd number of times.
+func crossesRing(g *flat.Geometry, start, end uint32, x, y float64) bool {
+	if end <= start {
+		return false
+	}
+	odd := false
+	j := end - 1
+	for i := start; i < end; i++ {
+		xi, yi := g.Xy(int(2*i)), g.Xy(int(2*i+1))
+		xj, yj := g.Xy(int(2*j)), g.Xy(int(2*j+1))
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			odd = !odd
+		}
+		j = i
+	}
+	return odd
+}
+
+// ValidateGeometry checks the rings of a polygonal geometry for common
+// defects, returning a list of human-readable descriptions of the
+// issues found, or nil if there are none. It is intended for data
+// quality checks, not as a full implementation of the OGC validity
+// rules.
+//
+// Each ring of a polygon is checked to ensure it has at least four
+// points, that it is closed, meaning its first and last points are the
+// same, and that it doesn't intersect itself. The self-intersection
+// check compares every pair of non-adjacent segments, so it takes time
+// quadratic in the number of points in the ring. Consecutive repeated
+// points are ignored, including when counting the points, so a ring
+// made of four copies of the same point is too small. The rings of a
+// polygon are not checked against each other, so for example a hole
+// lying outside its shell is not detected.
+//
+// Multi-part geometries are checked by checking each part, and the
+// issues found in a part are prefixed by the part index. Non-polygonal
+// geometries, such as points and line strings, have no rings and no
+// issues. A geometry whose type is Unknown can't be interpreted, so
+// this is reported as an issue. Since a FlatGeobuf file whose features
+// all have the same type records the type only in the header, the
+// feature geometries of such a file have the Unknown type; use
+// ValidateGeometryWithType to check them.
+//
+// Since ValidateGeometry accesses the FlatBuffers data directly, it may
+// panic if the geometry is malformed.
+func ValidateGeometry(g *flat.Geometry) []string {
+	return ValidateGeometryWithType(g, flat.GeometryTypeUnknown)
+}
+
+// ValidateGeometryWithType is like ValidateGeometry, but checks the
+// geometry as if it had type typ if its own type is Unknown. Parameter
+// typ should normally be the header geometry type, as returned by
+// flat.Header.GeometryType. If the geometry's own type is not Unknown,
+// typ is ignored. Parts whose type is Unknown are interpreted as in
+// PointInGeometryWithType.
+func ValidateGeometryWithType(g *flat.Geometry, typ flat.GeometryType) []string {
+	if t := g.Type(); t != flat.GeometryTypeUnknown {
+		typ = t
+	}
+	switch typ {
+	case flat.GeometryTypePolygon, flat.GeometryTypeTriangle:
+		return validateRings(g)
+	case flat.GeometryTypeMultiPolygon, flat.GeometryTypePolyhedralSurface,
+		flat.GeometryTypeTIN, flat.GeometryTypeGeometryCollection:
+		return validateParts(g, partType(typ))
+	case flat.GeometryTypeUnknown:
+		return []string{"unknown geometry type"}
+	default:
+		return nil
+	}
+}
+
+// validateParts validates each part of a multi-part geometry whose
+// parts have type typ unless they record their own type.
+func validateParts(g *flat.Geometry, typ flat.GeometryType) []string {
+	var issues []string
+	n := g.PartsLength()
+	for i := 0; i < n; i++ {
+		var part flat.Geometry
+		if !g.Parts(&part, i) {
+			continue
+		}
+		for _, issue := range ValidateGeometryWithType(&part, typ) {
+			issues = append(issues, fmt.Sprintf("part %d: %s", i, issue))
+		}
+	}
+	return issues
+}
+
+// validateRings validates the rings of a polygon.
+func validateRings(g *flat.Geometry) []string {
+	var issues []string
+	numXY := g.XyLength()
+	if numXY%2 != 0 {
+		issues = append(issues, fmt.Sprintf("odd number of XY coordinates (%d)", numXY))
+	}
+	numPoints := uint32(numXY / 2)
+	numRings := g.EndsLength()
+	var start uint32
+	for i := 0; i == 0 || i < numRings; i++ {
+		end := numPoints
+		if numRings > 0 {
+			end = g.Ends(i)
+			if end < start || end > numPoints {
+				issues = append(issues, fmt.Sprintf("ring %d end %d out of range [%d, %d]", i, end, start, numPoints))
+				return issues
+			}
+		}
+		for _, issue := range validateRing(g, start, end) {
+			issues = append(issues, fmt.Sprintf("ring %d %s", i, issue))
+		}
+		start = end
+	}
+	if start < numPoints {
+		issues = append(issues, fmt.Sprintf("%d points after last ring", numPoints-start))
+	}
+	return issues
+}
+
+// ringPoint is a point of a ring.
+type ringPoint struct {
+	x, y float64
+}
+
+// validateRing validates the ring formed by the coordinate pairs in the
+// range [start, end).
+func validateRing(g *flat.Geometry, start, end uint32) []string {
+	// Collect the points, dropping consecutive repeats.
+	n := end - start
+	pts := make([]ringPoint, 0, n)
+	for i := start; i < end; i++ {
+		p := ringPoint{g.Xy(int(2 * i)), g.Xy(int(2*i + 1))}
+		if len(pts) == 0 || p != pts[len(pts)-1] {
+			pts = append(pts, p)
+		}
+	}
+
+	// A ring whose points collapse to fewer than four after dropping
+	// repeats, such as four copies of one point, is degenerate.
+	if len(pts) < 4 {
+		if len(pts) == int(n) {
+			return []string{fmt.Sprintf("has < 4 points (%d)", n)}
+		}
+		return []string{fmt.Sprintf("has < 4 points (%d, of which %d distinct)", n, len(pts))}
+	}
+
+	var issues []string
+	closed := pts[0] == pts[len(pts)-1]
+	if !closed {
+		issues = append(issues, "not closed")
+	}
+	if ringSelfIntersects(pts, closed) {
+		issues = append(issues, "self-intersects")
+	}
+	return issues
+}
+
+// ringSelfIntersects reports whether any two non-adjacent segments of a
+// ring intersect. Segment i joins points i and i+1.
+func ringSelfIntersects(pts []ringPoint, closed bool) bool {
+	k := len(pts) - 1
+	for i := 0; i < k; i++ {
+		for j := i + 2; j < k; j++ {
+			if closed && i == 0 && j == k-1 {
+				continue // First and last segments share the closing point.
+			}
+			if segmentsIntersect(pts[i], pts[i+1], pts[j], pts[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentsIntersect reports whether the segments pq and rs share at
+// least one point.
+func segmentsIntersect(p, q, r, s ringPoint) bool {
+	o1, o2 := orientation(p, q, r), orientation(p, q, s)
+	o3, o4 := orientation(r, s, p), orientation(r, s, q)
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+	return o1 == 0 && onSegment(p, r, q) ||
+		o2 == 0 && onSegment(p, s, q) ||
+		o3 == 0 && onSegment(r, p, s) ||
+		o4 == 0 && onSegment(r, q, s)
+}
+
+// orientation returns 1 if the points p, q, r turn counter-clockwise,
+// -1 if they turn clockwise, and 0 if they are collinear.
+func orientation(p, q, r ringPoint) int {
+	v := (q.x-p.x)*(r.y-p.y) - (q.y-p.y)*(r.x-p.x)
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// onSegment reports whether q, which is collinear with p and r, lies on
+// the segment pr.
+func onSegment(p, q, r ringPoint) bool {
+	return q.x >= math.Min(p.x, r.x) && q.x <= math.Max(p.x, r.x) &&
+		q.y >= math.Min(p.y, r.y) && q.y <= math.Max(p.y, r.y)
+}
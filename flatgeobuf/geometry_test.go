@@ -0,0 +1,487 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointInGeometry(t *testing.T) {
+	// A 10x10 square with a 4x4 square hole in the middle.
+	polygonWithHole := geometrySpec{
+		typ: flat.GeometryTypePolygon,
+		xy: []float64{
+			0, 0, 10, 0, 10, 10, 0, 10, 0, 0,
+			3, 3, 3, 7, 7, 7, 7, 3, 3, 3,
+		},
+		ends: []uint32{5, 10},
+	}
+	// The same shape, plus a separate unit square at (20, 20).
+	multiPolygon := geometrySpec{
+		typ: flat.GeometryTypeMultiPolygon,
+		parts: []geometrySpec{
+			polygonWithHole,
+			*squareSpec(20, 20, 1).geometry,
+		},
+	}
+	unknownPolygon := polygonWithHole
+	unknownPolygon.typ = flat.GeometryTypeUnknown
+
+	testCases := []struct {
+		name     string
+		geometry geometrySpec
+		x, y     float64
+		expected bool
+	}{
+		{"Polygon/InsideOuterRing", polygonWithHole, 1, 1, true},
+		{"Polygon/InsideHole", polygonWithHole, 5, 5, false},
+		{"Polygon/Outside", polygonWithHole, 11, 5, false},
+		{"Polygon/OutsideBelow", polygonWithHole, 5, -1, false},
+		{"Polygon/SingleRingNoEnds", *squareSpec(0, 0, 2).geometry, 1, 1, true},
+		{"MultiPolygon/FirstPart", multiPolygon, 8, 8, true},
+		{"MultiPolygon/SecondPart", multiPolygon, 20.5, 20.5, true},
+		{"MultiPolygon/InsideHole", multiPolygon, 4, 6, false},
+		{"MultiPolygon/Outside", multiPolygon, 15, 15, false},
+		{"Unknown", unknownPolygon, 9, 1, false},
+		{"Point", geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{1, 1}}, 1, 1, false},
+		{"LineString", geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 2, 2, 0, 2, 0, 0}}, 0.5, 1, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			g := testGeometry(testCase.geometry)
+
+			actual := PointInGeometry(g, testCase.x, testCase.y)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+
+	t.Run("WithType", func(t *testing.T) {
+		unknownParts := geometrySpec{
+			typ: flat.GeometryTypeMultiPolygon,
+			parts: []geometrySpec{
+				{xy: polygonWithHole.xy, ends: polygonWithHole.ends},
+				{xy: squareSpec(20, 20, 1).geometry.xy},
+			},
+		}
+
+		testCases := []struct {
+			name     string
+			geometry geometrySpec
+			typ      flat.GeometryType
+			x, y     float64
+			expected bool
+		}{
+			{"Polygon/Inside", unknownPolygon, flat.GeometryTypePolygon, 9, 1, true},
+			{"Polygon/InsideHole", unknownPolygon, flat.GeometryTypePolygon, 6, 4, false},
+			{"MultiPolygon/UnknownParts", unknownParts, flat.GeometryTypeUnknown, 20.5, 20.5, true},
+			{"LineString", unknownPolygon, flat.GeometryTypeLineString, 9, 1, false},
+			{"OwnTypeWins", polygonWithHole, flat.GeometryTypeLineString, 9, 1, true},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				g := testGeometry(testCase.geometry)
+
+				actual := PointInGeometryWithType(g, testCase.typ, testCase.x, testCase.y)
+
+				assert.Equal(t, testCase.expected, actual)
+			})
+		}
+	})
+
+	t.Run("LineStringFile", func(t *testing.T) {
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypeLineString, numFeatures: 1}, []featureSpec{
+			{geometry: &geometrySpec{xy: []float64{0, 0, 10, 0, 10, 10}}},
+		})
+		r := NewFileReader(bytes.NewReader(file))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		fs, err := r.DataRem()
+		require.NoError(t, err)
+		require.Len(t, fs, 1)
+		g := fs[0].Geometry(nil)
+		require.Equal(t, flat.GeometryTypeUnknown, g.Type())
+
+		actual := PointInGeometryWithType(g, hdr.GeometryType(), 8, 2)
+
+		assert.False(t, actual)
+	})
+}
+
+func TestValidateGeometry(t *testing.T) {
+	// A 10x10 square with a 4x4 square hole in the middle.
+	polygonWithHole := geometrySpec{
+		typ: flat.GeometryTypePolygon,
+		xy: []float64{
+			0, 0, 10, 0, 10, 10, 0, 10, 0, 0,
+			3, 3, 3, 7, 7, 7, 7, 3, 3, 3,
+		},
+		ends: []uint32{5, 10},
+	}
+	unclosed := geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 1, 0, 1, 1, 0, 1}}
+	bowtie := geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 2, 2, 2, 0, 0, 2, 0, 0}}
+
+	testCases := []struct {
+		name     string
+		geometry geometrySpec
+		expected []string
+	}{
+		{"Valid", polygonWithHole, nil},
+		{"Valid/SingleRingNoEnds", *squareSpec(0, 0, 2).geometry, nil},
+		{"Valid/RepeatedPoints", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 1, 0, 1, 0, 1, 1, 0, 1, 0, 0, 0, 0}}, nil},
+		{"Valid/Triangle", geometrySpec{typ: flat.GeometryTypeTriangle, xy: []float64{0, 0, 1, 0, 0, 1, 0, 0}}, nil},
+		{"NotClosed", unclosed, []string{"ring 0 not closed"}},
+		{"TooFewPoints", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 1, 0, 0, 0}}, []string{"ring 0 has < 4 points (3)"}},
+		{"TooFewPoints/Repeated", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{1, 1, 1, 1, 1, 1, 1, 1}}, []string{"ring 0 has < 4 points (4, of which 1 distinct)"}},
+		{"TooFewPoints/RepeatedLine", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 1, 0, 1, 0, 0, 0}}, []string{"ring 0 has < 4 points (4, of which 3 distinct)"}},
+		{"SelfIntersects", bowtie, []string{"ring 0 self-intersects"}},
+		{"SelfIntersects/TouchingVertex", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 4, 0, 2, 2, 4, 4, 0, 4, 2, 2, 0, 0}}, []string{"ring 0 self-intersects"}},
+		{"SelfIntersects/Collinear", geometrySpec{typ: flat.GeometryTypePolygon, xy: []float64{0, 0, 4, 0, 4, 2, 2, 0, 1, 2, 0, 0}}, []string{"ring 0 self-intersects"}},
+		{"SecondRing", geometrySpec{typ: flat.GeometryTypePolygon, xy: append(append([]float64{}, polygonWithHole.xy[:10]...), unclosed.xy...), ends: []uint32{5, 9}}, []string{"ring 1 not closed"}},
+		{"EndOutOfRange", geometrySpec{typ: flat.GeometryTypePolygon, xy: polygonWithHole.xy, ends: []uint32{5, 11}}, []string{"ring 1 end 11 out of range [5, 10]"}},
+		{"PointsAfterLastRing", geometrySpec{typ: flat.GeometryTypePolygon, xy: polygonWithHole.xy, ends: []uint32{5}}, []string{"5 points after last ring"}},
+		{"OddXY", geometrySpec{typ: flat.GeometryTypePolygon, xy: append(append([]float64{}, squareSpec(0, 0, 1).geometry.xy...), 0)}, []string{"odd number of XY coordinates (11)"}},
+		{
+			name: "MultiPolygon",
+			geometry: geometrySpec{
+				typ:   flat.GeometryTypeMultiPolygon,
+				parts: []geometrySpec{polygonWithHole, bowtie, unclosed},
+			},
+			expected: []string{"part 1: ring 0 self-intersects", "part 2: ring 0 not closed"},
+		},
+		{"Unknown", geometrySpec{xy: unclosed.xy}, []string{"unknown geometry type"}},
+		{"LineString", geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 2, 2, 2, 0, 0, 2}}, nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			g := testGeometry(testCase.geometry)
+
+			issues := ValidateGeometry(g)
+
+			assert.Equal(t, testCase.expected, issues)
+		})
+	}
+
+	t.Run("WithType", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			geometry geometrySpec
+			typ      flat.GeometryType
+			expected []string
+		}{
+			{"Polygon", geometrySpec{xy: unclosed.xy}, flat.GeometryTypePolygon, []string{"ring 0 not closed"}},
+			{"Point", geometrySpec{xy: []float64{1, 1}}, flat.GeometryTypePoint, nil},
+			{"LineString", geometrySpec{xy: []float64{0, 0, 1, 0, 1, 1}}, flat.GeometryTypeLineString, nil},
+			{"MultiPolygon/UnknownParts", geometrySpec{typ: flat.GeometryTypeMultiPolygon, parts: []geometrySpec{{xy: unclosed.xy}}}, flat.GeometryTypeUnknown, []string{"part 0: ring 0 not closed"}},
+			{"OwnTypeWins", unclosed, flat.GeometryTypeLineString, []string{"ring 0 not closed"}},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				g := testGeometry(testCase.geometry)
+
+				issues := ValidateGeometryWithType(g, testCase.typ)
+
+				assert.Equal(t, testCase.expected, issues)
+			})
+		}
+	})
+
+	t.Run("HomogeneousFiles", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			typ  flat.GeometryType
+			fss  []featureSpec
+		}{
+			{"Point", flat.GeometryTypePoint, []featureSpec{
+				{geometry: &geometrySpec{xy: []float64{1, 1}}},
+				{geometry: &geometrySpec{xy: []float64{2, 3}}},
+			}},
+			{"LineString", flat.GeometryTypeLineString, []featureSpec{
+				{geometry: &geometrySpec{xy: []float64{0, 0, 1, 0, 1, 1}}},
+				{geometry: &geometrySpec{xy: []float64{5, 5, 6, 6}}},
+			}},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				file := writeTestFile(t, headerSpec{geometryType: testCase.typ, numFeatures: uint64(len(testCase.fss))}, testCase.fss)
+				r := NewFileReader(bytes.NewReader(file))
+				hdr, err := r.Header()
+				require.NoError(t, err)
+				fs, err := r.DataRem()
+				require.NoError(t, err)
+				require.Len(t, fs, len(testCase.fss))
+
+				for i := range fs {
+					g := fs[i].Geometry(nil)
+					require.Equal(t, flat.GeometryTypeUnknown, g.Type(), "feature %d", i)
+
+					issues := ValidateGeometryWithType(g, hdr.GeometryType())
+
+					assert.Nil(t, issues, "feature %d", i)
+				}
+			})
+		}
+	})
+}
+
+func TestFeatureBounds(t *testing.T) {
+	t.Run("NoGeometry", func(t *testing.T) {
+		b, err := FeatureBounds(featureSpec{}.build())
+
+		assert.NoError(t, err)
+		assert.Equal(t, packedrtree.EmptyBox, b)
+	})
+
+	t.Run("MultiPart", func(t *testing.T) {
+		f := featureSpec{geometry: &geometrySpec{
+			typ: flat.GeometryTypeMultiPolygon,
+			parts: []geometrySpec{
+				*squareSpec(-1, 2, 3).geometry,
+				*squareSpec(5, -4, 1).geometry,
+			},
+		}}.build()
+
+		b, err := FeatureBounds(f)
+
+		assert.NoError(t, err)
+		assert.Equal(t, packedrtree.Box{XMin: -1, YMin: -4, XMax: 6, YMax: 5}, b)
+	})
+
+	t.Run("MatchesIndexLeaf", func(t *testing.T) {
+		fss := []featureSpec{
+			pointSpec(1, 1),
+			squareSpec(10, -3, 2),
+			{geometry: &geometrySpec{
+				typ:   flat.GeometryTypeMultiPoint,
+				parts: []geometrySpec{{typ: flat.GeometryTypePoint, xy: []float64{-5, 7}}},
+			}},
+			{geometry: &geometrySpec{typ: flat.GeometryTypeLineString, xy: []float64{0, 0, 4, 9, -2, 3}}},
+		}
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypeUnknown, numFeatures: uint64(len(fss)), nodeSize: 2}, fss)
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		index, err := r.Index()
+		require.NoError(t, err)
+		data, err := r.DataRem()
+		require.NoError(t, err)
+		require.Len(t, data, len(fss))
+
+		leaves := leafRefs(t, index)
+
+		byOffset := make(map[int64]packedrtree.Box, len(leaves))
+		for i := range leaves {
+			byOffset[leaves[i].Offset] = leaves[i].Box
+		}
+		var offset int64
+		for i := range data {
+			b, err := FeatureBounds(&data[i])
+			require.NoError(t, err)
+			require.Contains(t, byOffset, offset)
+			assert.Equal(t, byOffset[offset], b, "feature %d", i)
+			offset += int64(len(data[i].Table().Bytes))
+		}
+	})
+}
+
+func TestBoxAroundPoints(t *testing.T) {
+	testCases := []struct {
+		name     string
+		points   [][2]float64
+		padding  float64
+		expected packedrtree.Box
+	}{
+		{"NoPoints", nil, 0, packedrtree.EmptyBox},
+		{"NoPointsPadded", [][2]float64{}, 5, packedrtree.EmptyBox},
+		{"OnePoint", [][2]float64{{1, 2}}, 0, packedrtree.Box{XMin: 1, YMin: 2, XMax: 1, YMax: 2}},
+		{"OnePointPadded", [][2]float64{{1, 2}}, 0.5, packedrtree.Box{XMin: 0.5, YMin: 1.5, XMax: 1.5, YMax: 2.5}},
+		{"SeveralPoints", [][2]float64{{3, -1}, {-2, 4}, {0, 0}, {1, 7}}, 0, packedrtree.Box{XMin: -2, YMin: -1, XMax: 3, YMax: 7}},
+		{"SeveralPointsPadded", [][2]float64{{3, -1}, {-2, 4}, {0, 0}, {1, 7}}, 1, packedrtree.Box{XMin: -3, YMin: -2, XMax: 4, YMax: 8}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := BoxAroundPoints(testCase.points, testCase.padding)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+
+	t.Run("FindsNearbyFeatures", func(t *testing.T) {
+		file := writeTestFile(t, headerSpec{geometryType: flat.GeometryTypePoint, numFeatures: 4, nodeSize: 2}, []featureSpec{
+			pointSpec(0, 0), pointSpec(10, 10), pointSpec(10.5, 5), pointSpec(20, 20),
+		})
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		fs, err := r.IndexSearch(BoxAroundPoints([][2]float64{{9, 9}, {11, 4}}, 1))
+
+		require.NoError(t, err)
+		assert.Len(t, fs, 2)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		assert.PanicsWithValue(t, "flatgeobuf: padding must be non-negative, got -1", func() {
+			BoxAroundPoints([][2]float64{{0, 0}}, -1)
+		})
+	})
+}
+
+func TestGeometry_WalkParts(t *testing.T) {
+	g := testGeometry(nestedSpec(3, 2))
+	var expected []float64
+	var collect func(gs geometrySpec)
+	collect = func(gs geometrySpec) {
+		for _, part := range gs.parts {
+			expected = append(expected, part.xy[0])
+			collect(part)
+		}
+	}
+	collect(nestedSpec(3, 2))
+
+	t.Run("All", func(t *testing.T) {
+		var w flat.GeometryWalker
+		for _, walker := range []*flat.GeometryWalker{nil, &w, &w} {
+			var actual []float64
+			g.WalkParts(walker, func(part *flat.Geometry) bool {
+				actual = append(actual, part.Xy(0))
+				return true
+			})
+
+			assert.Equal(t, expected, actual)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		var actual []float64
+		g.WalkParts(nil, func(part *flat.Geometry) bool {
+			actual = append(actual, part.Xy(0))
+			return len(actual) < 5
+		})
+
+		assert.Equal(t, expected[:5], actual)
+	})
+
+	t.Run("NoParts", func(t *testing.T) {
+		point := testGeometry(*pointSpec(1, 2).geometry)
+
+		point.WalkParts(nil, func(*flat.Geometry) bool {
+			assert.Fail(t, "unexpected part")
+			return true
+		})
+	})
+}
+
+func BenchmarkGeometry_WalkParts(b *testing.B) {
+	g := testGeometry(nestedSpec(6, 4))
+
+	b.Run("Recursive", func(b *testing.B) {
+		b.ReportAllocs()
+		var visit func(g *flat.Geometry) int
+		visit = func(g *flat.Geometry) int {
+			n := g.PartsLength()
+			count := n
+			for i := 0; i < n; i++ {
+				part := &flat.Geometry{}
+				if g.Parts(part, i) {
+					count += visit(part)
+				}
+			}
+			return count
+		}
+		for i := 0; i < b.N; i++ {
+			visit(g)
+		}
+	})
+
+	b.Run("WalkParts", func(b *testing.B) {
+		b.ReportAllocs()
+		var w flat.GeometryWalker
+		count := 0
+		fn := func(*flat.Geometry) bool {
+			count++
+			return true
+		}
+		for i := 0; i < b.N; i++ {
+			g.WalkParts(&w, fn)
+		}
+	})
+}
+
+// nestedSpec returns a geometry spec for a geometry collection nested
+// depth levels deep, where each collection has width parts and the
+// leaves are squares. The first X coordinate of each part is unique,
+// in depth-first order.
+func nestedSpec(depth, width int) geometrySpec {
+	var x float64
+	var build func(depth int) geometrySpec
+	build = func(depth int) geometrySpec {
+		if depth == 0 {
+			x++
+			return *squareSpec(x, 0, 1).geometry
+		}
+		gs := geometrySpec{typ: flat.GeometryTypeGeometryCollection, xy: []float64{x, 0}}
+		x++
+		for i := 0; i < width; i++ {
+			gs.parts = append(gs.parts, build(depth-1))
+		}
+		return gs
+	}
+	return build(depth)
+}
+
+func TestNewBoundedFeature(t *testing.T) {
+	t.Run("NilFeature", func(t *testing.T) {
+		assert.PanicsWithValue(t, "flatgeobuf: nil feature", func() {
+			_, _ = NewBoundedFeature(nil)
+		})
+	})
+
+	t.Run("MatchesFeatureBounds", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		data, err := r.DataRem()
+		require.NoError(t, err)
+
+		for i := range data {
+			bf, err := NewBoundedFeature(&data[i])
+
+			require.NoError(t, err)
+			expected, err := FeatureBounds(&data[i])
+			require.NoError(t, err)
+			assert.Equal(t, expected, bf.Box(), "feature %d", i)
+			assert.Same(t, &data[i], bf.Feature)
+		}
+	})
+
+	t.Run("NoGeometry", func(t *testing.T) {
+		bf, err := NewBoundedFeature(featureSpec{}.build())
+
+		require.NoError(t, err)
+		assert.Equal(t, packedrtree.EmptyBox, bf.Box())
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		f := flat.GetRootAsFeature([]byte{0xff, 0xff, 0xff, 0x7f}, 0)
+
+		bf, err := NewBoundedFeature(f)
+
+		assert.Error(t, err)
+		assert.Nil(t, bf)
+	})
+}
@@ -0,0 +1,348 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"math"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// ColumnInfo is a mutable description of a property column, containing
+// the same fields as a flat.Column table. It is used to edit the column
+// list, or schema, of a header with CloneHeaderWithColumns.
+//
+// Note that the zero value of ColumnInfo is not the same as the default
+// value of a flat.Column table, since in the FlatGeobuf schema the
+// Width, Precision, and Scale fields default to -1 and the Nullable
+// field defaults to true. Use NewColumnInfo to create a ColumnInfo with
+// the schema defaults.
+type ColumnInfo struct {
+	Name        string
+	Type        flat.ColumnType
+	Title       string
+	Description string
+	Width       int32
+	Precision   int32
+	Scale       int32
+	Nullable    bool
+	Unique      bool
+	PrimaryKey  bool
+	Metadata    string
+}
+
+// NewColumnInfo returns a ColumnInfo with the given name and type, and
+// all other fields set to the default values given by the FlatGeobuf
+// schema.
+func NewColumnInfo(name string, typ flat.ColumnType) ColumnInfo {
+	return ColumnInfo{
+		Name:      name,
+		Type:      typ,
+		Width:     -1,
+		Precision: -1,
+		Scale:     -1,
+		Nullable:  true,
+	}
+}
+
+// ReadColumn returns a ColumnInfo copied from all the fields of a
+// column table, including the optional descriptive fields such as the
+// title and description and the numeric format fields such as the
+// width and precision. Absent string fields are copied as empty
+// strings, and absent numeric and boolean fields as the default values
+// given by the FlatGeobuf schema.
+//
+// Since ReadColumn accesses the FlatBuffers data directly, it may panic
+// if the column table is malformed. Use SchemaColumns to read all the
+// columns of a schema safely.
+func ReadColumn(c *flat.Column) ColumnInfo {
+	return ColumnInfo{
+		Name:        string(c.Name()),
+		Type:        c.Type(),
+		Title:       string(c.Title()),
+		Description: string(c.Description()),
+		Width:       c.Width(),
+		Precision:   c.Precision(),
+		Scale:       c.Scale(),
+		Nullable:    c.Nullable(),
+		Unique:      c.Unique(),
+		PrimaryKey:  c.PrimaryKey(),
+		Metadata:    string(c.Metadata()),
+	}
+}
+
+// BuildColumn builds a column table containing all the fields of col
+// using a FlatBuffers builder, returning the table's offset. It is the
+// inverse of ReadColumn. Empty string fields, other than the name, are
+// omitted from the table.
+//
+// The returned offset can be added to a vector of columns for a header
+// being built with the flat package, for example:
+//
+//	offsets := make([]flatbuffers.UOffsetT, len(cols))
+//	for i := range cols {
+//		offsets[i] = flatgeobuf.BuildColumn(b, cols[i])
+//	}
+//	flat.HeaderStartColumnsVector(b, len(offsets))
+//	for i := len(offsets) - 1; i >= 0; i-- {
+//		b.PrependUOffsetT(offsets[i])
+//	}
+//	columns := b.EndVector(len(offsets))
+func BuildColumn(b *flatbuffers.Builder, col ColumnInfo) flatbuffers.UOffsetT {
+	name := b.CreateString(col.Name)
+	title := createString(b, col.Title)
+	description := createString(b, col.Description)
+	metadata := createString(b, col.Metadata)
+	flat.ColumnStart(b)
+	flat.ColumnAddName(b, name)
+	flat.ColumnAddType(b, col.Type)
+	if title != 0 {
+		flat.ColumnAddTitle(b, title)
+	}
+	if description != 0 {
+		flat.ColumnAddDescription(b, description)
+	}
+	flat.ColumnAddWidth(b, col.Width)
+	flat.ColumnAddPrecision(b, col.Precision)
+	flat.ColumnAddScale(b, col.Scale)
+	flat.ColumnAddNullable(b, col.Nullable)
+	flat.ColumnAddUnique(b, col.Unique)
+	flat.ColumnAddPrimaryKey(b, col.PrimaryKey)
+	if metadata != 0 {
+		flat.ColumnAddMetadata(b, metadata)
+	}
+	return flat.ColumnEnd(b)
+}
+
+// SchemaColumns returns a list of ColumnInfo copied from the columns of
+// a schema, which will typically be a header. An error is returned if
+// the schema's FlatBuffers data is malformed.
+//
+// The result can be edited, for example by appending a new column, and
+// passed to CloneHeaderWithColumns to produce a modified header.
+func SchemaColumns(s Schema) ([]ColumnInfo, error) {
+	var cols []ColumnInfo
+	err := safeFlatBuffersInteraction(func() error {
+		n := s.ColumnsLength()
+		cols = make([]ColumnInfo, n)
+		for i := 0; i < n; i++ {
+			var c flat.Column
+			if !s.Columns(&c, i) {
+				return fmtErr("failed to read column %d", i)
+			}
+			cols[i] = ReadColumn(&c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cols, nil
+}
+
+// CloneHeaderWithColumns builds a new header table which is a copy of h
+// in every respect except that its column list is replaced by cols. The
+// new header is a size-prefixed root table at offset 0, which is the
+// format required by FileWriter, so it can be used directly to write a
+// file with a migrated schema.
+//
+// All fields of h are copied, including the CRS table. If the feature
+// count field is physically present in h, it is also physically present
+// in the copy even if its value is zero, so the copy can still be used
+// with FileWriter.CloseWithCount.
+//
+// An error is returned if any column has an empty name, if two columns
+// have the same name, if there are more columns than can be addressed
+// by a property column index, or if the FlatBuffers data of h is
+// malformed.
+func CloneHeaderWithColumns(h *flat.Header, cols []ColumnInfo) (*flat.Header, error) {
+	if h == nil {
+		textPanic("nil header")
+	}
+
+	// Validate the new columns.
+	if len(cols) > math.MaxUint16+1 {
+		return nil, fmtErr("too many columns (%d, max %d)", len(cols), math.MaxUint16+1)
+	}
+	names := make(map[string]int, len(cols))
+	for i := range cols {
+		if cols[i].Name == "" {
+			return nil, fmtErr("column %d name is empty", i)
+		} else if j, ok := names[cols[i].Name]; ok {
+			return nil, fmtErr("duplicate column name %q (columns %d and %d)", cols[i].Name, j, i)
+		}
+		names[cols[i].Name] = i
+	}
+
+	// Build the new header.
+	clone, err := cloneHeader(h, h.IndexNodeSize(), func(b *flatbuffers.Builder) flatbuffers.UOffsetT {
+		return buildColumns(b, cols)
+	}, nil)
+	if err != nil {
+		return nil, wrapErr("failed to clone header", err)
+	}
+	return clone, nil
+}
+
+// cloneHeader builds a copy of a header as a size-prefixed root table at
+// offset 0, with the index node size replaced by nodeSize. If columns
+// is not nil, it is called to build the column list of the copy instead
+// of copying the column list of h; likewise, if crs is not nil, it is
+// called to build the CRS table of the copy. Either function may return
+// zero to omit the field.
+func cloneHeader(h *flat.Header, nodeSize uint16, columns, crs func(b *flatbuffers.Builder) flatbuffers.UOffsetT) (*flat.Header, error) {
+	if columns == nil {
+		cols, err := SchemaColumns(h)
+		if err != nil {
+			return nil, err
+		}
+		columns = func(b *flatbuffers.Builder) flatbuffers.UOffsetT {
+			return buildColumns(b, cols)
+		}
+	}
+	var clone *flat.Header
+	err := safeFlatBuffersInteraction(func() error {
+		b := flatbuffers.NewBuilder(0)
+		name := createByteString(b, h.Name())
+		var envelope flatbuffers.UOffsetT
+		if n := h.EnvelopeLength(); n > 0 {
+			flat.HeaderStartEnvelopeVector(b, n)
+			for i := n - 1; i >= 0; i-- {
+				b.PrependFloat64(h.Envelope(i))
+			}
+			envelope = b.EndVector(n)
+		}
+		cols := columns(b)
+		var c flatbuffers.UOffsetT
+		if crs != nil {
+			c = crs(b)
+		} else {
+			var orig flat.Crs
+			if h.Crs(&orig) != nil {
+				c = cloneCrs(b, &orig)
+			}
+		}
+		title := createByteString(b, h.Title())
+		description := createByteString(b, h.Description())
+		metadata := createByteString(b, h.Metadata())
+
+		flat.HeaderStart(b)
+		if name != 0 {
+			flat.HeaderAddName(b, name)
+		}
+		if envelope != 0 {
+			flat.HeaderAddEnvelope(b, envelope)
+		}
+		flat.HeaderAddGeometryType(b, h.GeometryType())
+		flat.HeaderAddHasZ(b, h.HasZ())
+		flat.HeaderAddHasM(b, h.HasM())
+		flat.HeaderAddHasT(b, h.HasT())
+		flat.HeaderAddHasTm(b, h.HasTm())
+		if cols != 0 {
+			flat.HeaderAddColumns(b, cols)
+		}
+		if t := h.Table(); t.Offset(headerFeaturesCountSlot) != 0 && h.FeaturesCount() == 0 {
+			// Force the zero-valued feature count to be present.
+			HeaderAddFeaturesCountForced(b, 0)
+		} else {
+			flat.HeaderAddFeaturesCount(b, h.FeaturesCount())
+		}
+		flat.HeaderAddIndexNodeSize(b, nodeSize)
+		if c != 0 {
+			flat.HeaderAddCrs(b, c)
+		}
+		if title != 0 {
+			flat.HeaderAddTitle(b, title)
+		}
+		if description != 0 {
+			flat.HeaderAddDescription(b, description)
+		}
+		if metadata != 0 {
+			flat.HeaderAddMetadata(b, metadata)
+		}
+		flat.FinishSizePrefixedHeaderBuffer(b, flat.HeaderEnd(b))
+		clone = flat.GetSizePrefixedRootAsHeader(b.FinishedBytes(), 0)
+		return nil
+	})
+	return clone, err
+}
+
+// HeaderAddFeaturesCountForced adds the feature count field to a header
+// table being built, like flat.HeaderAddFeaturesCount, except that the
+// field is physically written even if featuresCount is zero. The
+// generated function omits a field whose value equals its default, so
+// a header built with it for an unknown (zero) feature count has no
+// feature count field for FileWriter.CloseWithCount to backfill.
+//
+// Like the other header field functions, it must be called between
+// flat.HeaderStart and flat.HeaderEnd.
+func HeaderAddFeaturesCountForced(b *flatbuffers.Builder, featuresCount uint64) {
+	b.PrependUint64(featuresCount)
+	b.Slot(int((headerFeaturesCountSlot - 4) / 2))
+}
+
+// buildColumns builds a vector of column tables, returning its offset,
+// or zero if there are no columns.
+func buildColumns(b *flatbuffers.Builder, cols []ColumnInfo) flatbuffers.UOffsetT {
+	if len(cols) == 0 {
+		return 0
+	}
+	offsets := make([]flatbuffers.UOffsetT, len(cols))
+	for i := range cols {
+		offsets[i] = BuildColumn(b, cols[i])
+	}
+	flat.HeaderStartColumnsVector(b, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offsets[i])
+	}
+	return b.EndVector(len(offsets))
+}
+
+// cloneCrs builds a copy of a CRS table, returning its offset.
+func cloneCrs(b *flatbuffers.Builder, c *flat.Crs) flatbuffers.UOffsetT {
+	org := createByteString(b, c.Org())
+	name := createByteString(b, c.Name())
+	description := createByteString(b, c.Description())
+	wkt := createByteString(b, c.Wkt())
+	codeString := createByteString(b, c.CodeString())
+	flat.CrsStart(b)
+	if org != 0 {
+		flat.CrsAddOrg(b, org)
+	}
+	flat.CrsAddCode(b, c.Code())
+	if name != 0 {
+		flat.CrsAddName(b, name)
+	}
+	if description != 0 {
+		flat.CrsAddDescription(b, description)
+	}
+	if wkt != 0 {
+		flat.CrsAddWkt(b, wkt)
+	}
+	if codeString != 0 {
+		flat.CrsAddCodeString(b, codeString)
+	}
+	return flat.CrsEnd(b)
+}
+
+// createByteString creates a FlatBuffers string from a byte slice,
+// returning its offset, or zero if the slice is nil, which indicates an
+// absent string field.
+func createByteString(b *flatbuffers.Builder, s []byte) flatbuffers.UOffsetT {
+	if s == nil {
+		return 0
+	}
+	return b.CreateByteString(s)
+}
+
+// createString creates a FlatBuffers string, returning its offset, or
+// zero if the string is empty.
+func createString(b *flatbuffers.Builder, s string) flatbuffers.UOffsetT {
+	if s == "" {
+		return 0
+	}
+	return b.CreateString(s)
+}
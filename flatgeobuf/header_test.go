@@ -0,0 +1,234 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadColumn(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			col  ColumnInfo
+		}{
+			{"Defaults", NewColumnInfo("id", flat.ColumnTypeString)},
+			{"TitleAndPrecision", ColumnInfo{
+				Name:      "area",
+				Type:      flat.ColumnTypeDouble,
+				Title:     "Area (km²)",
+				Width:     -1,
+				Precision: 12,
+				Scale:     3,
+				Nullable:  true,
+			}},
+			{"AllFields", ColumnInfo{
+				Name:        "code",
+				Type:        flat.ColumnTypeInt,
+				Title:       "Code",
+				Description: "Unique region code",
+				Width:       8,
+				Precision:   0,
+				Scale:       0,
+				Nullable:    false,
+				Unique:      true,
+				PrimaryKey:  true,
+				Metadata:    `{"source":"census"}`,
+			}},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				b := flatbuffers.NewBuilder(0)
+				b.Finish(BuildColumn(b, testCase.col))
+				c := flat.GetRootAsColumn(b.FinishedBytes(), 0)
+
+				actual := ReadColumn(c)
+
+				assert.Equal(t, testCase.col, actual)
+			})
+		}
+	})
+
+	t.Run("SchemaDefaults", func(t *testing.T) {
+		b := flatbuffers.NewBuilder(0)
+		name := b.CreateString("name")
+		flat.ColumnStart(b)
+		flat.ColumnAddName(b, name)
+		flat.ColumnAddType(b, flat.ColumnTypeLong)
+		b.Finish(flat.ColumnEnd(b))
+		c := flat.GetRootAsColumn(b.FinishedBytes(), 0)
+
+		actual := ReadColumn(c)
+
+		assert.Equal(t, NewColumnInfo("name", flat.ColumnTypeLong), actual)
+	})
+
+	t.Run("TestFile", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "alldatatypes.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		cols, err := SchemaColumns(hdr)
+		require.NoError(t, err)
+		require.NotEmpty(t, cols)
+
+		for i := range cols {
+			var c flat.Column
+			require.True(t, hdr.Columns(&c, i))
+			b := flatbuffers.NewBuilder(0)
+			b.Finish(BuildColumn(b, ReadColumn(&c)))
+
+			actual := ReadColumn(flat.GetRootAsColumn(b.FinishedBytes(), 0))
+
+			assert.Equal(t, cols[i], actual)
+		}
+	})
+}
+
+func TestCloneHeaderWithColumns(t *testing.T) {
+	readHeader := func(t *testing.T, name string) *flat.Header {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, name)))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		return hdr
+	}
+
+	t.Run("AddColumn", func(t *testing.T) {
+		orig := readHeader(t, "countries.fgb")
+		cols, err := SchemaColumns(orig)
+		require.NoError(t, err)
+		require.Len(t, cols, 2)
+		cols = append(cols, NewColumnInfo("population", flat.ColumnTypeLong))
+
+		clone, err := CloneHeaderWithColumns(orig, cols)
+
+		require.NoError(t, err)
+		// Write the cloned header to a file and read it back.
+		var buf bytes.Buffer
+		w := NewFileWriter(&buf)
+		_, err = w.Header(clone)
+		require.NoError(t, err)
+		r := NewFileReader(bytes.NewReader(buf.Bytes()))
+		actual, err := r.Header()
+		require.NoError(t, err)
+		assert.Equal(t, orig.Name(), actual.Name())
+		require.Equal(t, orig.EnvelopeLength(), actual.EnvelopeLength())
+		for i := 0; i < orig.EnvelopeLength(); i++ {
+			assert.Equal(t, orig.Envelope(i), actual.Envelope(i))
+		}
+		assert.Equal(t, orig.GeometryType(), actual.GeometryType())
+		assert.Equal(t, orig.FeaturesCount(), actual.FeaturesCount())
+		assert.Equal(t, orig.IndexNodeSize(), actual.IndexNodeSize())
+		var origCrs, actualCrs flat.Crs
+		require.NotNil(t, orig.Crs(&origCrs))
+		require.NotNil(t, actual.Crs(&actualCrs))
+		assert.Equal(t, origCrs.Code(), actualCrs.Code())
+		assert.Equal(t, origCrs.Org(), actualCrs.Org())
+		assert.Equal(t, origCrs.Wkt(), actualCrs.Wkt())
+		actualCols, err := SchemaColumns(actual)
+		require.NoError(t, err)
+		assert.Equal(t, cols, actualCols)
+		var col flat.Column
+		require.True(t, actual.Columns(&col, 2))
+		assert.Equal(t, []byte("population"), col.Name())
+		assert.Equal(t, flat.ColumnTypeLong, col.Type())
+		assert.True(t, col.Nullable())
+		assert.Equal(t, int32(-1), col.Width())
+	})
+
+	t.Run("RemoveColumns", func(t *testing.T) {
+		orig := readHeader(t, "UScounties.fgb")
+		cols, err := SchemaColumns(orig)
+		require.NoError(t, err)
+		require.Len(t, cols, 6)
+
+		clone, err := CloneHeaderWithColumns(orig, cols[1:2])
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, clone.ColumnsLength())
+		actualCols, err := SchemaColumns(clone)
+		require.NoError(t, err)
+		assert.Equal(t, cols[1:2], actualCols)
+		clone, err = CloneHeaderWithColumns(orig, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, clone.ColumnsLength())
+	})
+
+	t.Run("ForcedFeaturesCount", func(t *testing.T) {
+		orig := headerSpec{name: "forced", forceFeaturesCount: true}.build()
+
+		clone, err := CloneHeaderWithColumns(orig, nil)
+
+		require.NoError(t, err)
+		tbl := clone.Table()
+		assert.NotZero(t, tbl.Offset(headerFeaturesCountSlot))
+		assert.Equal(t, []byte("forced"), clone.Name())
+		clone, err = CloneHeaderWithColumns(headerSpec{name: "absent"}.build(), nil)
+		require.NoError(t, err)
+		tbl = clone.Table()
+		assert.Zero(t, tbl.Offset(headerFeaturesCountSlot))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		orig := readHeader(t, "countries.fgb")
+		testCases := []struct {
+			name     string
+			cols     []ColumnInfo
+			expected string
+		}{
+			{"EmptyName", []ColumnInfo{NewColumnInfo("a", flat.ColumnTypeInt), {}}, "flatgeobuf: column 1 name is empty"},
+			{"DuplicateName", []ColumnInfo{NewColumnInfo("a", flat.ColumnTypeInt), NewColumnInfo("b", flat.ColumnTypeInt), NewColumnInfo("a", flat.ColumnTypeString)}, `flatgeobuf: duplicate column name "a" (columns 0 and 2)`},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				clone, err := CloneHeaderWithColumns(orig, testCase.cols)
+
+				assert.EqualError(t, err, testCase.expected)
+				assert.Nil(t, clone)
+			})
+		}
+	})
+
+	t.Run("NilHeader", func(t *testing.T) {
+		assert.PanicsWithValue(t, "flatgeobuf: nil header", func() {
+			_, _ = CloneHeaderWithColumns(nil, nil)
+		})
+	})
+}
+
+func TestHeaderAddFeaturesCountForced(t *testing.T) {
+	build := func(add func(b *flatbuffers.Builder)) *flat.Header {
+		b := flatbuffers.NewBuilder(0)
+		flat.HeaderStart(b)
+		flat.HeaderAddGeometryType(b, flat.GeometryTypePoint)
+		add(b)
+		flat.FinishSizePrefixedHeaderBuffer(b, flat.HeaderEnd(b))
+		return flat.GetSizePrefixedRootAsHeader(b.FinishedBytes(), 0)
+	}
+
+	t.Run("Zero", func(t *testing.T) {
+		hdr := build(func(b *flatbuffers.Builder) { HeaderAddFeaturesCountForced(b, 0) })
+
+		assert.Equal(t, uint64(0), hdr.FeaturesCount())
+		tbl := hdr.Table()
+		assert.NotZero(t, tbl.Offset(headerFeaturesCountSlot), "field must be present")
+	})
+
+	t.Run("MatchesGenerated", func(t *testing.T) {
+		expected := build(func(b *flatbuffers.Builder) { flat.HeaderAddFeaturesCount(b, 42) })
+
+		actual := build(func(b *flatbuffers.Builder) { HeaderAddFeaturesCountForced(b, 42) })
+
+		assert.Equal(t, uint64(42), actual.FeaturesCount())
+		assert.Equal(t, expected.Table().Bytes, actual.Table().Bytes)
+	})
+}
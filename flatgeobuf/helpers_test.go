@@ -0,0 +1,277 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/require"
+)
+
+// headerSpec describes a FlatGeobuf header to build for test purposes.
+type headerSpec struct {
+	name         string
+	geometryType flat.GeometryType
+	numFeatures  uint64
+	nodeSize     uint16
+	columns      []columnSpec
+	crs          *crsSpec
+	// forceFeaturesCount forces the feature count field to be
+	// physically present even if its value is the default of zero.
+	forceFeaturesCount bool
+}
+
+// columnSpec describes a header column to build for test purposes.
+type columnSpec struct {
+	name string
+	typ  flat.ColumnType
+}
+
+// crsSpec describes a header CRS to build for test purposes. Empty
+// strings are omitted from the CRS table.
+type crsSpec struct {
+	org        string
+	code       int32
+	wkt        string
+	codeString string
+}
+
+// build builds the header as a size-prefixed root table at offset 0,
+// which is the format required by FileWriter.
+func (hs headerSpec) build() *flat.Header {
+	b := flatbuffers.NewBuilder(0)
+	name := b.CreateString(hs.name)
+	var crs flatbuffers.UOffsetT
+	if hs.crs != nil {
+		optString := func(s string) flatbuffers.UOffsetT {
+			if s == "" {
+				return 0
+			}
+			return b.CreateString(s)
+		}
+		org := optString(hs.crs.org)
+		wkt := optString(hs.crs.wkt)
+		codeString := optString(hs.crs.codeString)
+		flat.CrsStart(b)
+		if org != 0 {
+			flat.CrsAddOrg(b, org)
+		}
+		flat.CrsAddCode(b, hs.crs.code)
+		if wkt != 0 {
+			flat.CrsAddWkt(b, wkt)
+		}
+		if codeString != 0 {
+			flat.CrsAddCodeString(b, codeString)
+		}
+		crs = flat.CrsEnd(b)
+	}
+	var columns flatbuffers.UOffsetT
+	if len(hs.columns) > 0 {
+		offsets := make([]flatbuffers.UOffsetT, len(hs.columns))
+		for i := range hs.columns {
+			colName := b.CreateString(hs.columns[i].name)
+			flat.ColumnStart(b)
+			flat.ColumnAddName(b, colName)
+			flat.ColumnAddType(b, hs.columns[i].typ)
+			offsets[i] = flat.ColumnEnd(b)
+		}
+		flat.HeaderStartColumnsVector(b, len(offsets))
+		for i := len(offsets) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(offsets[i])
+		}
+		columns = b.EndVector(len(offsets))
+	}
+	flat.HeaderStart(b)
+	flat.HeaderAddName(b, name)
+	flat.HeaderAddGeometryType(b, hs.geometryType)
+	if columns != 0 {
+		flat.HeaderAddColumns(b, columns)
+	}
+	if crs != 0 {
+		flat.HeaderAddCrs(b, crs)
+	}
+	if hs.forceFeaturesCount && hs.numFeatures == 0 {
+		HeaderAddFeaturesCountForced(b, 0)
+	} else {
+		flat.HeaderAddFeaturesCount(b, hs.numFeatures)
+	}
+	flat.HeaderAddIndexNodeSize(b, hs.nodeSize)
+	flat.FinishSizePrefixedHeaderBuffer(b, flat.HeaderEnd(b))
+	return flat.GetSizePrefixedRootAsHeader(b.FinishedBytes(), 0)
+}
+
+// geometrySpec describes a FlatGeobuf geometry to build for test
+// purposes.
+type geometrySpec struct {
+	typ   flat.GeometryType
+	xy    []float64
+	z     []float64
+	ends  []uint32
+	parts []geometrySpec
+}
+
+// buildGeometry builds a geometry table, returning its offset.
+func buildGeometry(b *flatbuffers.Builder, gs geometrySpec) flatbuffers.UOffsetT {
+	var parts flatbuffers.UOffsetT
+	if len(gs.parts) > 0 {
+		offsets := make([]flatbuffers.UOffsetT, len(gs.parts))
+		for i := range gs.parts {
+			offsets[i] = buildGeometry(b, gs.parts[i])
+		}
+		flat.GeometryStartPartsVector(b, len(offsets))
+		for i := len(offsets) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(offsets[i])
+		}
+		parts = b.EndVector(len(offsets))
+	}
+	var ends flatbuffers.UOffsetT
+	if len(gs.ends) > 0 {
+		flat.GeometryStartEndsVector(b, len(gs.ends))
+		for i := len(gs.ends) - 1; i >= 0; i-- {
+			b.PrependUint32(gs.ends[i])
+		}
+		ends = b.EndVector(len(gs.ends))
+	}
+	var xy flatbuffers.UOffsetT
+	if len(gs.xy) > 0 {
+		flat.GeometryStartXyVector(b, len(gs.xy))
+		for i := len(gs.xy) - 1; i >= 0; i-- {
+			b.PrependFloat64(gs.xy[i])
+		}
+		xy = b.EndVector(len(gs.xy))
+	}
+	var z flatbuffers.UOffsetT
+	if len(gs.z) > 0 {
+		flat.GeometryStartZVector(b, len(gs.z))
+		for i := len(gs.z) - 1; i >= 0; i-- {
+			b.PrependFloat64(gs.z[i])
+		}
+		z = b.EndVector(len(gs.z))
+	}
+	flat.GeometryStart(b)
+	if parts != 0 {
+		flat.GeometryAddParts(b, parts)
+	}
+	if ends != 0 {
+		flat.GeometryAddEnds(b, ends)
+	}
+	if xy != 0 {
+		flat.GeometryAddXy(b, xy)
+	}
+	if z != 0 {
+		flat.GeometryAddZ(b, z)
+	}
+	flat.GeometryAddType(b, gs.typ)
+	return flat.GeometryEnd(b)
+}
+
+// testGeometry builds a standalone geometry table.
+func testGeometry(gs geometrySpec) *flat.Geometry {
+	b := flatbuffers.NewBuilder(0)
+	b.Finish(buildGeometry(b, gs))
+	return flat.GetRootAsGeometry(b.FinishedBytes(), 0)
+}
+
+// featureSpec describes a FlatGeobuf feature to build for test
+// purposes.
+type featureSpec struct {
+	geometry   *geometrySpec
+	properties []byte
+}
+
+// build builds the feature as a size-prefixed root table at offset 0,
+// which is the format required by FileWriter.
+func (fs featureSpec) build() *flat.Feature {
+	b := flatbuffers.NewBuilder(0)
+	var geometry flatbuffers.UOffsetT
+	if fs.geometry != nil {
+		geometry = buildGeometry(b, *fs.geometry)
+	}
+	var properties flatbuffers.UOffsetT
+	if fs.properties != nil {
+		properties = b.CreateByteVector(fs.properties)
+	}
+	flat.FeatureStart(b)
+	if geometry != 0 {
+		flat.FeatureAddGeometry(b, geometry)
+	}
+	if properties != 0 {
+		flat.FeatureAddProperties(b, properties)
+	}
+	flat.FinishSizePrefixedFeatureBuffer(b, flat.FeatureEnd(b))
+	return flat.GetSizePrefixedRootAsFeature(b.FinishedBytes(), 0)
+}
+
+// pointSpec returns a feature spec for a point feature.
+func pointSpec(x, y float64) featureSpec {
+	return featureSpec{geometry: &geometrySpec{typ: flat.GeometryTypePoint, xy: []float64{x, y}}}
+}
+
+// squareSpec returns a feature spec for a square polygon feature with
+// its lower left corner at (x, y).
+func squareSpec(x, y, side float64) featureSpec {
+	return featureSpec{geometry: &geometrySpec{
+		typ: flat.GeometryTypePolygon,
+		xy:  []float64{x, y, x + side, y, x + side, y + side, x, y + side, x, y},
+	}}
+}
+
+// writeTestFile writes a complete FlatGeobuf file from a header spec
+// and a list of feature specs, returning the file bytes. If the header
+// has a non-zero node size, an index is generated.
+func writeTestFile(t *testing.T, hs headerSpec, fss []featureSpec) []byte {
+	var buf bytes.Buffer
+	w := NewFileWriter(&buf)
+	_, err := w.Header(hs.build())
+	require.NoError(t, err)
+	features := make([]*flat.Feature, len(fss))
+	for i := range fss {
+		features[i] = fss[i].build()
+	}
+	if hs.nodeSize > 0 {
+		_, err = w.IndexDataPtr(features)
+		require.NoError(t, err)
+	} else {
+		for i := range features {
+			_, err = w.Data(features[i])
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// leafRefs returns the leaf nodes of an index, in index order, by
+// parsing its serialized form.
+func leafRefs(t *testing.T, index *packedrtree.PackedRTree) []packedrtree.Ref {
+	var buf bytes.Buffer
+	_, err := index.Marshal(&buf)
+	require.NoError(t, err)
+	const size = 40 // Size of a serialized node.
+	b := buf.Bytes()
+	b = b[len(b)-index.NumRefs()*size:]
+	refs := make([]packedrtree.Ref, index.NumRefs())
+	for i := range refs {
+		refs[i].XMin = flatbuffers.GetFloat64(b[i*size+0:])
+		refs[i].YMin = flatbuffers.GetFloat64(b[i*size+8:])
+		refs[i].XMax = flatbuffers.GetFloat64(b[i*size+16:])
+		refs[i].YMax = flatbuffers.GetFloat64(b[i*size+24:])
+		refs[i].Offset = flatbuffers.GetInt64(b[i*size+32:])
+	}
+	return refs
+}
+
+// readTestFile reads the contents of a file in the test data
+// directory.
+func readTestFile(t *testing.T, name string) []byte {
+	b, err := os.ReadFile("../testdata/flatgeobuf/" + name)
+	require.NoError(t, err)
+	return b
+}
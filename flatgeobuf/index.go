@@ -0,0 +1,261 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"io"
+	"math"
+	"sync"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// BuildIndex reads all remaining features from a FileReader and builds
+// a packed Hilbert R-Tree spatial index over them. It returns both the
+// index and the features read, in data order, which is the order in
+// which they must be written to the data section for the index to be
+// valid.
+//
+// The reader should be positioned at the start of the data section,
+// for example immediately after a successful call to Header, because
+// the index offsets are calculated relative to the first feature read.
+// If the reader contains no more features, the returned index is nil.
+func BuildIndex(r *FileReader, nodeSize uint16) (*packedrtree.PackedRTree, []flat.Feature, error) {
+	if nodeSize < 2 {
+		return nil, nil, fmtErr("index node size %d not allowed (must be at least 2)", nodeSize)
+	}
+
+	data, err := r.DataRem()
+	if err != nil {
+		return nil, nil, err
+	} else if len(data) == 0 {
+		return nil, data, nil
+	}
+
+	dataPtr := make([]*flat.Feature, len(data))
+	for i := range data {
+		dataPtr[i] = &data[i]
+	}
+	index, err := indexFeatures(dataPtr, nodeSize, packedrtree.Hilbert, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return index, data, nil
+}
+
+// ScanRefs reads all remaining features from a FileReader and returns
+// a packed R-Tree ref for each one, in data section order, without
+// retaining the features themselves. Each ref holds the bounding box of
+// the feature's geometry and the byte offset of the feature relative to
+// the first feature read.
+//
+// Features are read in batches into a single reused buffer, so memory
+// use is bounded by the size of the refs rather than the size of the
+// data section. The reader should be positioned at the start of the
+// data section, for example immediately after a successful call to
+// Header, so that the offsets are relative to the start of the data
+// section.
+func ScanRefs(r *FileReader) ([]packedrtree.Ref, error) {
+	var refs []packedrtree.Ref
+	var buf []byte
+	var offset int64
+	for {
+		fs, err := r.DataBatch(256, &buf)
+		for i := range fs {
+			var ref packedrtree.Ref
+			var size uint32
+			if err2 := safeFlatBuffersInteraction(func() (err error) {
+				if size, err = tableSize(fs[i].Table()); err != nil {
+					return
+				}
+				ref.Box, err = FeatureBounds(&fs[i])
+				return
+			}); err2 != nil {
+				return nil, wrapErr("failed to index feature %d", err2, len(refs))
+			}
+			ref.Offset = offset
+			offset += flatbuffers.SizeUint32 + int64(size)
+			refs = append(refs, ref)
+		}
+		if err == io.EOF {
+			return refs, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// BuildIndexStreaming builds a packed Hilbert R-Tree spatial index over
+// the features of the FlatGeobuf file read from rs, without holding the
+// features in memory. It is intended for files too large to index with
+// BuildIndex, which reads all the features at once.
+//
+// The features are first scanned, as by ScanRefs, to collect only their
+// bounding boxes and offsets. The refs are then Hilbert sorted and the
+// index is built from them. Unlike BuildIndex, BuildIndexStreaming does
+// not reorder the data section, so the index leaves refer to the
+// features at their existing offsets, which are not in ascending order
+// unless the features are already Hilbert sorted. The index can be used
+// as a sidecar index for the file, for example with
+// NewFileReaderWithIndex.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+// If the file already has an index, it is skipped, by seeking where
+// possible. If the file contains no features, the returned index is
+// nil.
+func BuildIndexStreaming(rs io.ReadSeeker, nodeSize uint16) (*packedrtree.PackedRTree, error) {
+	if nodeSize < 2 {
+		return nil, fmtErr("index node size %d not allowed (must be at least 2)", nodeSize)
+	}
+
+	r := NewFileReader(rs)
+	if _, err := r.Header(); err != nil {
+		return nil, err
+	}
+	refs, err := ScanRefs(r)
+	if err != nil {
+		return nil, err
+	} else if len(refs) == 0 {
+		return nil, nil
+	}
+
+	bounds := packedrtree.EmptyBox
+	for i := range refs {
+		bounds.Expand(&refs[i].Box)
+	}
+	packedrtree.HilbertSort(refs, bounds)
+	return packedrtree.New(refs, nodeSize)
+}
+
+// indexFeatures builds a packed R-Tree spatial index over a non-empty
+// list of features, sorted according to strategy, assuming the features
+// will be written to the data section in the order given. The
+// per-feature bounds and size calculations are split across up to
+// workers goroutines.
+func indexFeatures(data []*flat.Feature, nodeSize uint16, strategy packedrtree.PackStrategy, workers int) (*packedrtree.PackedRTree, error) {
+	refs := make([]packedrtree.Ref, len(data))
+	sizes := make([]uint32, len(data))
+	if err := measureFeatures(data, refs, sizes, workers); err != nil {
+		return nil, err
+	}
+	bounds := packedrtree.EmptyBox
+	var offset int64
+	for i := range refs {
+		refs[i].Offset = offset
+		bounds.Expand(&refs[i].Box)
+		offset += flatbuffers.SizeUint32 + int64(sizes[i])
+	}
+	strategy.Sort(refs, bounds)
+	return packedrtree.New(refs, nodeSize)
+}
+
+// indexFeaturesInOrder builds a packed R-Tree spatial index over a
+// non-empty list of features which will be written to the data section
+// in the given order, rather than in the order of the list. The refs
+// are still sorted according to strategy.
+func indexFeaturesInOrder(data []*flat.Feature, order []int, nodeSize uint16, strategy packedrtree.PackStrategy, workers int) (*packedrtree.PackedRTree, error) {
+	refs := make([]packedrtree.Ref, len(data))
+	sizes := make([]uint32, len(data))
+	if err := measureFeatures(data, refs, sizes, workers); err != nil {
+		return nil, err
+	}
+	bounds := packedrtree.EmptyBox
+	var offset int64
+	for _, j := range order {
+		refs[j].Offset = offset
+		offset += flatbuffers.SizeUint32 + int64(sizes[j])
+		bounds.Expand(&refs[j].Box)
+	}
+	strategy.Sort(refs, bounds)
+	return packedrtree.New(refs, nodeSize)
+}
+
+// measureFeatures computes the bounding box and table size of each
+// feature, storing them in the corresponding elements of refs and
+// sizes. The features are divided into contiguous chunks which are
+// processed by up to workers goroutines in parallel. If more than one
+// feature has an error, the error for the lowest-indexed is returned.
+func measureFeatures(data []*flat.Feature, refs []packedrtree.Ref, sizes []uint32, workers int) error {
+	if workers <= 1 || len(data) <= 1 {
+		return measureFeatureRange(data, refs, sizes, 0, len(data))
+	}
+	chunk := (len(data) + workers - 1) / workers
+	workers = (len(data) + chunk - 1) / chunk
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		lo, hi := k*chunk, (k+1)*chunk
+		if hi > len(data) {
+			hi = len(data)
+		}
+		wg.Add(1)
+		go func(k, lo, hi int) {
+			defer wg.Done()
+			errs[k] = measureFeatureRange(data, refs, sizes, lo, hi)
+		}(k, lo, hi)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measureFeatureRange computes the bounding box and table size of the
+// features in the index range [lo, hi).
+func measureFeatureRange(data []*flat.Feature, refs []packedrtree.Ref, sizes []uint32, lo, hi int) error {
+	i := lo
+	err := safeFlatBuffersInteraction(func() (err error) {
+		for ; i < hi; i++ {
+			if sizes[i], err = tableSize(data[i].Table()); err != nil {
+				return
+			}
+			if refs[i].Box, err = FeatureBounds(data[i]); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		return wrapErr("failed to index feature %d", err, i)
+	}
+	return nil
+}
+
+// GuessNodeSize finds an index node size which, for a given feature
+// count, produces a packed Hilbert R-Tree index of exactly indexBytes
+// bytes. It can be used to recover the node size of a file whose header
+// is missing or untrustworthy, given the length of its index section.
+// The boolean return value is false if no node size matches.
+//
+// More than one node size can produce the same index length. If the
+// FlatGeobuf default node size of 16 matches, it is returned. Otherwise,
+// the smallest matching node size is returned.
+func GuessNodeSize(numFeatures int, indexBytes int64) (uint16, bool) {
+	if numFeatures < 1 || indexBytes <= 0 {
+		return 0, false
+	}
+	if n, err := packedrtree.Size(numFeatures, defaultNodeSize); err == nil && int64(n) == indexBytes {
+		return defaultNodeSize, true
+	}
+	// Index size never increases as node size increases, so the search
+	// can stop once the size falls below the target.
+	for nodeSize := 2; nodeSize <= math.MaxUint16; nodeSize++ {
+		n, err := packedrtree.Size(numFeatures, uint16(nodeSize))
+		if err != nil {
+			continue
+		} else if int64(n) == indexBytes {
+			return uint16(nodeSize), true
+		} else if int64(n) < indexBytes {
+			break
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,322 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/gogama/flatgeobuf/packedrtree"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildIndex(t *testing.T) {
+	t.Run("NodeSizeTooSmall", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "heterogeneous.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		index, data, err := BuildIndex(r, 1)
+
+		assert.EqualError(t, err, "flatgeobuf: index node size 1 not allowed (must be at least 2)")
+		assert.Nil(t, index)
+		assert.Nil(t, data)
+	})
+
+	t.Run("NonIndexed", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "heterogeneous.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		index, data, err := BuildIndex(r, 16)
+
+		require.NoError(t, err)
+		require.NotNil(t, index)
+		assert.Len(t, data, 3)
+		assert.Equal(t, 3, index.NumRefs())
+		all := index.Search(index.Bounds())
+		assert.Len(t, all, 3)
+		for i := range data {
+			b, err := FeatureBounds(&data[i])
+			require.NoError(t, err)
+			rs := index.Search(b)
+			assert.NotEmpty(t, rs, "search for feature %d bounds %s", i, b)
+		}
+		r = NewFileReader(bytes.NewReader(readTestFile(t, "heterogeneous.fgb")))
+		_, err = r.Header()
+		require.NoError(t, err)
+		original, err := r.DataRem()
+		require.NoError(t, err)
+		for i := range data {
+			assert.Equal(t, featureString(t, &original[i]), featureString(t, &data[i]), "feature %d must be in data order", i)
+		}
+	})
+
+	t.Run("MatchesFileIndex", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		expected, err := r.Index()
+		require.NoError(t, err)
+
+		actual, data, err := BuildIndex(r, expected.NodeSize())
+
+		require.NoError(t, err)
+		assert.Len(t, data, expected.NumRefs())
+		var expectedBytes, actualBytes bytes.Buffer
+		_, err = expected.Marshal(&expectedBytes)
+		require.NoError(t, err)
+		_, err = actual.Marshal(&actualBytes)
+		require.NoError(t, err)
+		assert.Equal(t, expectedBytes.Bytes(), actualBytes.Bytes())
+	})
+}
+
+func TestScanRefs(t *testing.T) {
+	t.Run("MatchesFileIndex", func(t *testing.T) {
+		// The countries file is Hilbert sorted, so the refs in data
+		// order are the index leaves.
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		index, err := r.Index()
+		require.NoError(t, err)
+
+		refs, err := ScanRefs(r)
+
+		require.NoError(t, err)
+		assert.Equal(t, leafRefs(t, index), refs)
+	})
+
+	t.Run("UnknownFeatureCount", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "unknown_feature_count.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+		count, err := r.CountFeatures()
+		require.NoError(t, err)
+
+		refs, err := ScanRefs(r)
+
+		require.NoError(t, err)
+		require.Len(t, refs, count)
+		assert.Equal(t, int64(0), refs[0].Offset)
+		for i := 1; i < len(refs); i++ {
+			assert.Greater(t, refs[i].Offset, refs[i-1].Offset)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "empty.fgb")))
+		_, err := r.Header()
+		require.NoError(t, err)
+
+		refs, err := ScanRefs(r)
+
+		assert.NoError(t, err)
+		assert.Empty(t, refs)
+	})
+}
+
+func TestBuildIndexStreaming(t *testing.T) {
+	t.Run("NodeSizeTooSmall", func(t *testing.T) {
+		index, err := BuildIndexStreaming(bytes.NewReader(readTestFile(t, "heterogeneous.fgb")), 1)
+
+		assert.EqualError(t, err, "flatgeobuf: index node size 1 not allowed (must be at least 2)")
+		assert.Nil(t, index)
+	})
+
+	t.Run("MatchesBuildIndex", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		expected, _, err := BuildIndex(r, 16)
+		require.NoError(t, err)
+
+		actual, err := BuildIndexStreaming(bytes.NewReader(file), 16)
+
+		require.NoError(t, err)
+		var expectedBytes, actualBytes bytes.Buffer
+		_, err = expected.Marshal(&expectedBytes)
+		require.NoError(t, err)
+		_, err = actual.Marshal(&actualBytes)
+		require.NoError(t, err)
+		assert.Equal(t, expectedBytes.Bytes(), actualBytes.Bytes())
+	})
+
+	t.Run("Unsorted", func(t *testing.T) {
+		// Write squares with no index in an order unrelated to their
+		// Hilbert order.
+		fss := make([]featureSpec, 20)
+		for i := range fss {
+			fss[i] = squareSpec(float64((i*7)%20)*10, float64((i*13)%20)*10, 5)
+		}
+		hs := headerSpec{geometryType: flat.GeometryTypePolygon, numFeatures: uint64(len(fss))}
+		file := writeTestFile(t, hs, fss)
+		r := NewFileReader(bytes.NewReader(file))
+		_, err := r.Header()
+		require.NoError(t, err)
+		expected, _, err := BuildIndex(r, 4)
+		require.NoError(t, err)
+
+		actual, err := BuildIndexStreaming(bytes.NewReader(file), 4)
+
+		// The leaves are in the same order as the index built by
+		// BuildIndex, but refer to the features at their original
+		// offsets.
+		require.NoError(t, err)
+		expectedRefs, actualRefs := leafRefs(t, expected), leafRefs(t, actual)
+		require.Len(t, actualRefs, len(expectedRefs))
+		for i := range expectedRefs {
+			assert.Equal(t, expectedRefs[i].Box, actualRefs[i].Box)
+		}
+
+		// The index works as a sidecar index for the original file.
+		var sidecar bytes.Buffer
+		_, err = actual.Marshal(&sidecar)
+		require.NoError(t, err)
+		for i := range fss {
+			b, err := FeatureBounds(fss[i].build())
+			require.NoError(t, err)
+			r, err := NewFileReaderWithIndex(bytes.NewReader(file), bytes.NewReader(sidecar.Bytes()), len(fss), 4)
+			require.NoError(t, err)
+			_, err = r.Header()
+			require.NoError(t, err)
+
+			fs, err := r.IndexSearch(packedrtree.Box{XMin: b.XMin + 1, YMin: b.YMin + 1, XMax: b.XMin + 1, YMax: b.YMin + 1})
+
+			require.NoError(t, err)
+			require.Len(t, fs, 1)
+			actualBounds, err := FeatureBounds(&fs[0])
+			require.NoError(t, err)
+			assert.Equal(t, b, actualBounds)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		index, err := BuildIndexStreaming(bytes.NewReader(readTestFile(t, "empty.fgb")), 16)
+
+		assert.NoError(t, err)
+		assert.Nil(t, index)
+	})
+}
+
+func TestPackedRTree_EstimateMatches(t *testing.T) {
+	testCases := []struct {
+		file  string
+		boxes []packedrtree.Box
+	}{
+		{
+			file: "countries.fgb",
+			boxes: []packedrtree.Box{
+				{XMin: -10, YMin: 35, XMax: 30, YMax: 60},    // Europe
+				{XMin: -20, YMin: -35, XMax: 50, YMax: 35},   // Africa
+				{XMin: -130, YMin: 25, XMax: -65, YMax: 50},  // USA
+				{XMin: 60, YMin: 0, XMax: 150, YMax: 60},     // Asia
+				{XMin: -180, YMin: -90, XMax: 0, YMax: 0},    // SW quadrant
+				{XMin: -40, YMin: -50, XMax: -30, YMax: -40}, // Ocean
+			},
+		},
+		{
+			file: "UScounties.fgb",
+			boxes: []packedrtree.Box{
+				{XMin: -130, YMin: 25, XMax: -65, YMax: 50},  // Contiguous USA
+				{XMin: -100, YMin: 30, XMax: -90, YMax: 40},  // Central
+				{XMin: -122, YMin: 47, XMax: -121, YMax: 48}, // Seattle area
+				{XMin: -20, YMin: -35, XMax: 50, YMax: 35},   // Africa
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.file, func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(readTestFile(t, testCase.file)))
+			_, err := r.Header()
+			require.NoError(t, err)
+			index, err := r.Index()
+			require.NoError(t, err)
+
+			t.Run("Bounds", func(t *testing.T) {
+				assert.Equal(t, index.NumRefs(), index.EstimateMatches(index.Bounds()))
+			})
+
+			t.Run("EmptyBox", func(t *testing.T) {
+				assert.Equal(t, 0, index.EstimateMatches(packedrtree.EmptyBox))
+			})
+
+			for _, b := range testCase.boxes {
+				t.Run(b.String(), func(t *testing.T) {
+					actual := len(index.Search(b))
+
+					estimate := index.EstimateMatches(b)
+
+					tolerance := 10 + float64(actual)/2
+					assert.InDelta(t, actual, estimate, tolerance)
+				})
+			}
+		})
+	}
+}
+
+func TestGuessNodeSize(t *testing.T) {
+	t.Run("Countries", func(t *testing.T) {
+		b := readTestFile(t, "countries.fgb")
+		r := NewFileReader(bytes.NewReader(b))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		indexOffset := magicLen + 4 + int64(flatbuffers.GetUint32(b[magicLen:]))
+		_, err = r.Data(make([]flat.Feature, 1))
+		require.NoError(t, err)
+		dataOffset := r.dataOffset
+		require.Greater(t, dataOffset, indexOffset)
+
+		nodeSize, ok := GuessNodeSize(int(hdr.FeaturesCount()), dataOffset-indexOffset)
+
+		assert.True(t, ok)
+		assert.Equal(t, hdr.IndexNodeSize(), nodeSize)
+	})
+
+	testCases := []struct {
+		name         string
+		numFeatures  int
+		nodeSize     uint16
+		expectedSize uint16
+	}{
+		{"Default", 1000, 16, 16},
+		{"Two", 1000, 2, 2},
+		{"Unusual", 1000, 7, 7},
+		{"Large", 100000, 300, 300},
+		{"AmbiguousPrefersDefault", 10, 12, 16},
+		{"AmbiguousSmallest", 20, 25, 20},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			n, err := packedrtree.Size(testCase.numFeatures, testCase.nodeSize)
+			require.NoError(t, err)
+
+			nodeSize, ok := GuessNodeSize(testCase.numFeatures, int64(n))
+
+			assert.True(t, ok)
+			assert.Equal(t, testCase.expectedSize, nodeSize)
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		nodeSize, ok := GuessNodeSize(1000, 12345)
+
+		assert.False(t, ok)
+		assert.Equal(t, uint16(0), nodeSize)
+	})
+
+	t.Run("NoFeatures", func(t *testing.T) {
+		_, ok := GuessNodeSize(0, 40)
+
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"io"
+
+	"github.com/gogama/flatgeobuf/packedrtree"
+)
+
+// FileLayout describes the location of the sections of a FlatGeobuf
+// file, as returned by Describe. All offsets are byte offsets relative
+// to the start of the file.
+type FileLayout struct {
+	// Version is the FlatGeobuf specification version recorded in the
+	// file's magic number.
+	Version SpecVersion
+	// HeaderOffset is the offset of the header section, which begins
+	// with the 4-byte header length immediately after the magic
+	// number.
+	HeaderOffset int64
+	// IndexOffset is the offset of the spatial index section. If the
+	// file has no index, it is equal to DataOffset.
+	IndexOffset int64
+	// DataOffset is the offset of the data section, which contains the
+	// features.
+	DataOffset int64
+	// NumFeatures is the number of features recorded in the header.
+	// It is zero if the feature count is unknown.
+	NumFeatures int
+	// NodeSize is the index node size recorded in the header. It is
+	// zero if the file has no index.
+	NodeSize uint16
+	// HasIndex indicates whether the file has a spatial index.
+	HasIndex bool
+}
+
+// Describe reads the magic number and header of a FlatGeobuf file and
+// returns a description of the file's layout, without reading the index
+// or data sections. The location of the data section is calculated
+// from the header using packedrtree.Size, so an error is returned if
+// the file has an index but its header does not record the feature
+// count.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+// Before returning, Describe restores the stream to its original
+// position.
+func Describe(rs io.ReadSeeker) (layout *FileLayout, err error) {
+	// Save the starting position and ensure it is restored on return.
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, wrapErr("failed to query start offset", err)
+	}
+	defer func() {
+		if _, seekErr := rs.Seek(start, io.SeekStart); seekErr != nil && err == nil {
+			layout, err = nil, wrapErr("failed to restore start offset", seekErr)
+		}
+	}()
+
+	// Read the version, then rewind so the file reader can read the
+	// magic number again.
+	version, err := Magic(rs)
+	if err != nil {
+		return nil, wrapErr("failed to read magic number", err)
+	}
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return nil, wrapErr("failed to seek to start offset", err)
+	}
+
+	// Read the header to find the end of the header section and the
+	// index parameters.
+	r := NewFileReader(rs)
+	if _, err = r.Header(); err != nil {
+		return nil, err
+	}
+	headerEnd, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, wrapErr("failed to query header end offset", err)
+	}
+	var indexSize int
+	if r.nodeSize > 0 {
+		if r.numFeatures == 0 {
+			return nil, textErr("can't describe layout: header feature count is unknown")
+		}
+		if indexSize, err = packedrtree.Size(r.numFeatures, r.nodeSize); err != nil {
+			return nil, wrapErr("can't describe layout: failed to calculate index size", err)
+		}
+	}
+
+	return &FileLayout{
+		Version:      version,
+		HeaderOffset: magicLen,
+		IndexOffset:  headerEnd - start,
+		DataOffset:   headerEnd - start + int64(indexSize),
+		NumFeatures:  r.numFeatures,
+		NodeSize:     r.nodeSize,
+		HasIndex:     r.nodeSize > 0,
+	}, nil
+}
+
+// PeekBounds returns the bounding box of all the features in an indexed
+// FlatGeobuf file by reading only the header and the root node of the
+// spatial index, whose box encloses every feature. This is much cheaper
+// than unmarshalling the index to get its bounds, and unlike the header
+// envelope, which is optional, is always available for indexed files.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+// An error is returned if the file has no index. Before returning,
+// PeekBounds restores the stream to its original position.
+func PeekBounds(rs io.ReadSeeker) (b packedrtree.Box, err error) {
+	// Save the starting position and ensure it is restored on return.
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return packedrtree.Box{}, wrapErr("failed to query start offset", err)
+	}
+	defer func() {
+		if _, seekErr := rs.Seek(start, io.SeekStart); seekErr != nil && err == nil {
+			b, err = packedrtree.Box{}, wrapErr("failed to restore start offset", seekErr)
+		}
+	}()
+
+	// Read the header, leaving the stream positioned at the start of
+	// the index.
+	r := NewFileReader(rs)
+	if _, err = r.Header(); err != nil {
+		return packedrtree.Box{}, err
+	}
+	if r.nodeSize == 0 {
+		return packedrtree.Box{}, textErr("can't peek bounds: file has no index")
+	}
+
+	// Read the bounds from the root node.
+	if b, err = packedrtree.BoundsFromReader(rs); err != nil {
+		return packedrtree.Box{}, wrapErr("failed to peek index bounds", err)
+	}
+	return b, nil
+}
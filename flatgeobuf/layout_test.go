@@ -0,0 +1,139 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/packedrtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	t.Run("Countries", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		rs := bytes.NewReader(file)
+
+		layout, err := Describe(rs)
+
+		require.NoError(t, err)
+		indexSize, err := packedrtree.Size(179, 16)
+		require.NoError(t, err)
+		assert.Equal(t, &FileLayout{
+			Version:      SpecVersion{Major: 3, Patch: 0},
+			HeaderOffset: 8,
+			IndexOffset:  8 + 4 + 604,
+			DataOffset:   8 + 4 + 604 + int64(indexSize),
+			NumFeatures:  179,
+			NodeSize:     16,
+			HasIndex:     true,
+		}, layout)
+		pos, err := rs.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), pos)
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+		require.NoError(t, SplitFile(bytes.NewReader(file), &headerBuf, &indexBuf, &dataBuf))
+		assert.Equal(t, layout.DataOffset-layout.IndexOffset, int64(indexBuf.Len()))
+		assert.Equal(t, int64(len(file))-layout.DataOffset, int64(dataBuf.Len()))
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		file := readTestFile(t, "heterogeneous.fgb")
+
+		layout, err := Describe(bytes.NewReader(file))
+
+		require.NoError(t, err)
+		assert.False(t, layout.HasIndex)
+		assert.Equal(t, uint16(0), layout.NodeSize)
+		assert.Equal(t, 3, layout.NumFeatures)
+		assert.Equal(t, layout.IndexOffset, layout.DataOffset)
+		assert.Less(t, layout.DataOffset, int64(len(file)))
+	})
+
+	t.Run("UnknownFeatureCount", func(t *testing.T) {
+		file := readTestFile(t, "unknown_feature_count.fgb")
+
+		layout, err := Describe(bytes.NewReader(file))
+
+		require.NoError(t, err)
+		assert.Equal(t, 0, layout.NumFeatures)
+		assert.False(t, layout.HasIndex)
+		assert.Equal(t, layout.IndexOffset, layout.DataOffset)
+	})
+
+	t.Run("IndexWithUnknownFeatureCount", func(t *testing.T) {
+		hdr := headerSpec{nodeSize: 16}.build()
+		file := append(append([]byte{}, magic[:]...), hdr.Table().Bytes...)
+
+		layout, err := Describe(bytes.NewReader(file))
+
+		assert.EqualError(t, err, "flatgeobuf: can't describe layout: header feature count is unknown")
+		assert.Nil(t, layout)
+	})
+
+	t.Run("InvalidMagic", func(t *testing.T) {
+		layout, err := Describe(bytes.NewReader([]byte("not a flatgeobuf file")))
+
+		assert.EqualError(t, err, "flatgeobuf: failed to read magic number: flatgeobuf: invalid magic number")
+		assert.Nil(t, layout)
+	})
+}
+
+func TestPeekBounds(t *testing.T) {
+	testCases := []struct {
+		name string
+		file string
+	}{
+		{"Countries", "countries.fgb"},
+		{"USCounties", "UScounties.fgb"},
+		{"Poly01", "poly01.fgb"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			file := readTestFile(t, testCase.file)
+			r := NewFileReader(bytes.NewReader(file))
+			_, err := r.Header()
+			require.NoError(t, err)
+			index, err := r.Index()
+			require.NoError(t, err)
+			rs := bytes.NewReader(append([]byte("junk"), file...))
+			_, err = rs.Seek(4, io.SeekStart)
+			require.NoError(t, err)
+
+			b, err := PeekBounds(rs)
+
+			require.NoError(t, err)
+			assert.Equal(t, index.Bounds(), b)
+			pos, err := rs.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(4), pos)
+		})
+	}
+
+	t.Run("NoIndex", func(t *testing.T) {
+		rs := bytes.NewReader(readTestFile(t, "heterogeneous.fgb"))
+
+		_, err := PeekBounds(rs)
+
+		assert.EqualError(t, err, "flatgeobuf: can't peek bounds: file has no index")
+		pos, err := rs.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), pos)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		layout, err := Describe(bytes.NewReader(file))
+		require.NoError(t, err)
+
+		_, err = PeekBounds(bytes.NewReader(file[:layout.IndexOffset+10]))
+
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
@@ -5,6 +5,7 @@
 package flatgeobuf
 
 import (
+	"encoding/binary"
 	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
 	"io"
 	"math"
@@ -64,7 +65,7 @@ func (r *PropReader) ReadShort() (int16, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int16(b[0]) | int16(b[1]<<8), nil
+	return int16(b[0]) | int16(b[1])<<8, nil
 }
 
 func (r *PropReader) ReadUShort() (uint16, error) {
@@ -73,7 +74,7 @@ func (r *PropReader) ReadUShort() (uint16, error) {
 	if err != nil {
 		return 0, err
 	}
-	return uint16(b[0]) | uint16(b[1]<<8), nil
+	return uint16(b[0]) | uint16(b[1])<<8, nil
 }
 
 func (r *PropReader) ReadInt() (int32, error) {
@@ -82,7 +83,7 @@ func (r *PropReader) ReadInt() (int32, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int32(b[0]) | int32(b[1]<<8) | int32(b[2]<<16) | int32(b[3]<<24), nil
+	return int32(b[0]) | int32(b[1])<<8 | int32(b[2])<<16 | int32(b[3])<<24, nil
 }
 
 func (r *PropReader) ReadUInt() (uint32, error) {
@@ -91,7 +92,7 @@ func (r *PropReader) ReadUInt() (uint32, error) {
 	if err != nil {
 		return 0, err
 	}
-	return uint32(b[0]) | uint32(b[1]<<8) | uint32(b[2]<<16) | uint32(b[3]<<24), nil
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24, nil
 }
 
 func (r *PropReader) ReadLong() (int64, error) {
@@ -100,19 +101,48 @@ func (r *PropReader) ReadLong() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	v := int64(b[0]<<000) | int64(b[1]<<010) | int64(b[2]<<020) | int64(b[3]<<030) |
-		int64(b[4]<<040) | int64(b[5]<<050) | int64(b[6]<<060) | int64(b[7]<<070)
+	v := int64(b[0])<<000 | int64(b[1])<<010 | int64(b[2])<<020 | int64(b[3])<<030 |
+		int64(b[4])<<040 | int64(b[5])<<050 | int64(b[6])<<060 | int64(b[7])<<070
 	return v, nil
 }
 
+// ReadDeltaLong reads a Long property value written by
+// PropWriter.WriteDeltaLong, given the same previous value prev that
+// was used when writing it. An error is returned if the encoded
+// difference is not a valid variable length integer.
+func (r *PropReader) ReadDeltaLong(prev int64) (int64, error) {
+	var ux uint64
+	b := make([]byte, 1)
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		if _, err := io.ReadFull(r.r, b); err == io.EOF && i > 0 {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		if b[0] < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b[0] > 1 {
+				break
+			}
+			ux |= uint64(b[0]) << (7 * i)
+			delta := int64(ux >> 1)
+			if ux&1 != 0 {
+				delta = ^delta
+			}
+			return prev + delta, nil
+		}
+		ux |= uint64(b[0]&0x7f) << (7 * i)
+	}
+	return 0, textErr("delta long overflows 64 bits")
+}
+
 func (r *PropReader) ReadULong() (uint64, error) {
 	b := make([]byte, 8)
 	_, err := io.ReadFull(r.r, b)
 	if err != nil {
 		return 0, err
 	}
-	v := uint64(b[0]<<000) | uint64(b[1]<<010) | uint64(b[2]<<020) | uint64(b[3]<<030) |
-		uint64(b[4]<<040) | uint64(b[5]<<050) | uint64(b[6]<<060) | uint64(b[7]<<070)
+	v := uint64(b[0])<<000 | uint64(b[1])<<010 | uint64(b[2])<<020 | uint64(b[3])<<030 |
+		uint64(b[4])<<040 | uint64(b[5])<<050 | uint64(b[6])<<060 | uint64(b[7])<<070
 	return v, nil
 }
 
@@ -0,0 +1,116 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropReader_Integers(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPropWriter(&buf)
+	_, err := w.WriteShort(-12345)
+	require.NoError(t, err)
+	_, err = w.WriteUShort(0xbeef)
+	require.NoError(t, err)
+	_, err = w.WriteInt(-123456789)
+	require.NoError(t, err)
+	_, err = w.WriteUInt(0xdeadbeef)
+	require.NoError(t, err)
+	_, err = w.WriteLong(math.MinInt64 + 12345)
+	require.NoError(t, err)
+	_, err = w.WriteULong(0xfeedfacecafebeef)
+	require.NoError(t, err)
+
+	r := NewPropReader(&buf)
+
+	s, err := r.ReadShort()
+	assert.NoError(t, err)
+	assert.Equal(t, int16(-12345), s)
+	us, err := r.ReadUShort()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0xbeef), us)
+	i, err := r.ReadInt()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(-123456789), i)
+	ui, err := r.ReadUInt()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0xdeadbeef), ui)
+	l, err := r.ReadLong()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MinInt64+12345), l)
+	ul, err := r.ReadULong()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xfeedfacecafebeef), ul)
+}
+
+func TestPropReader_ReadDeltaLong(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		values := []int64{
+			0, 0, 1, 2, 2, 3, 1000, 999, -5, -5, 1 << 40, -(1 << 40),
+			math.MaxInt64, math.MinInt64, math.MaxInt64, 0,
+		}
+		var buf bytes.Buffer
+		w := NewPropWriter(&buf)
+		var prev int64
+		for _, v := range values {
+			_, err := w.WriteDeltaLong(prev, v)
+			require.NoError(t, err)
+			prev = v
+		}
+
+		r := NewPropReader(&buf)
+		prev = 0
+		for i, expected := range values {
+			actual, err := r.ReadDeltaLong(prev)
+
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual, "value %d", i)
+			prev = actual
+		}
+		assert.Equal(t, 0, buf.Len())
+	})
+
+	t.Run("SlowlyChanging", func(t *testing.T) {
+		var delta, fixed bytes.Buffer
+		dw, fw := NewPropWriter(&delta), NewPropWriter(&fixed)
+		var prev int64 = 1_000_000
+		for i := 0; i < 100; i++ {
+			v := prev + int64(i%5) - 2
+			_, err := dw.WriteDeltaLong(prev, v)
+			require.NoError(t, err)
+			_, err = fw.WriteLong(v)
+			require.NoError(t, err)
+			prev = v
+		}
+
+		assert.Equal(t, 100, delta.Len())
+		assert.Equal(t, 800, fixed.Len())
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		r := NewPropReader(bytes.NewReader([]byte{0x80, 0x80}))
+
+		_, err := r.ReadDeltaLong(0)
+
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		b := bytes.Repeat([]byte{0xff}, 9)
+		b = append(b, 0x02)
+		r := NewPropReader(bytes.NewReader(b))
+
+		_, err := r.ReadDeltaLong(0)
+
+		assert.EqualError(t, err, "flatgeobuf: delta long overflows 64 bits")
+	})
+}
@@ -5,6 +5,7 @@
 package flatgeobuf
 
 import (
+	"encoding/binary"
 	"io"
 	"math"
 	"unsafe"
@@ -80,6 +81,37 @@ func (w *PropWriter) WriteLong(v int64) (n int, err error) {
 	return w.w.Write(b)
 }
 
+// DeltaLongMetadata is the column metadata value which marks a Long
+// column as delta-encoded, meaning its values are written with
+// PropWriter.WriteDeltaLong and must be read with
+// PropReader.ReadDeltaLong.
+//
+// Delta encoding is an extension to the FlatGeobuf format, intended for
+// private pipelines where both the writer and the reader understand it.
+// Other FlatGeobuf implementations will misread delta-encoded columns,
+// so files containing them should not be shared. To mark a column, set
+// the metadata field of its column table in the header to exactly this
+// value.
+const DeltaLongMetadata = `{"encoding":"delta"}`
+
+// WriteDeltaLong writes a Long property value v, which must be read
+// with PropReader.ReadDeltaLong, as the difference from a previous
+// value prev. The difference is written as a zig-zag encoded variable
+// length integer, occupying between 1 and 10 bytes, so sequences of
+// repeated or slowly-changing values take much less space than with
+// WriteLong. The difference is calculated with wrapping arithmetic, so
+// any pair of values can be encoded.
+//
+// The choice of prev is up to the caller, but must be repeated exactly
+// when reading. Typically it is the value of the same column in the
+// previous feature, or zero for the first feature. See
+// DeltaLongMetadata for how to mark a column as delta-encoded.
+func (w *PropWriter) WriteDeltaLong(prev, v int64) (n int, err error) {
+	b := make([]byte, binary.MaxVarintLen64)
+	m := binary.PutVarint(b, v-prev)
+	return w.w.Write(b[:m])
+}
+
 // TODO: Docs
 func (w *PropWriter) WriteULong(v uint64) (n int, err error) {
 	b := []byte{
@@ -0,0 +1,355 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+)
+
+// propTag is the struct tag key used to map struct fields to property
+// columns.
+const propTag = "fgb"
+
+// DecodeProperties decodes the properties of a feature into the fields
+// of the struct pointed to by out, in the manner of json.Unmarshal. The
+// schema s is used to interpret the feature properties and will
+// typically be the file header.
+//
+// Each property is stored in the exported struct field whose "fgb" tag
+// matches the property's column name, for example:
+//
+//	type Country struct {
+//		ID   string `fgb:"id"`
+//		Name string `fgb:"name"`
+//	}
+//
+// Fields without a tag, or tagged "-", are ignored, as are properties
+// with no matching field. Fields whose property is absent from the
+// feature are left unchanged.
+//
+// Property values are converted to the field type as follows. Integer
+// values may be stored in any integer or floating-point field, and
+// floating-point values in any floating-point field, provided the value
+// fits. Bool values may only be stored in bool fields. String and
+// DateTime values may be stored in string or byte slice fields, as may
+// Binary and Json values. Any value may be stored in a field of type
+// interface{}. A pointer field is allocated if nil and the value is
+// stored in the element it points to. Any other combination is an
+// error.
+func DecodeProperties(f *flat.Feature, s Schema, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmtErr("can't decode properties into %T (must be a non-nil pointer to a struct)", out)
+	}
+	v = v.Elem()
+	fields := propFields(v.Type())
+
+	var vals []PropValue
+	if err := safeFlatBuffersInteraction(func() (err error) {
+		vals, err = NewPropReader(bytes.NewReader(f.PropertiesBytes())).ReadSchema(s)
+		return
+	}); err != nil {
+		return wrapErr("failed to read properties", err)
+	}
+
+	for i := range vals {
+		name := string(vals[i].Col.Name())
+		j, ok := fields[name]
+		if !ok {
+			continue
+		}
+		field := v.FieldByIndex(j)
+		if reason := decodeProp(field, vals[i].Value); reason != "" {
+			return fmtErr("can't decode column %q (%s) into field %s: %s", name, vals[i].Type, v.Type().FieldByIndex(j).Name, reason)
+		}
+	}
+	return nil
+}
+
+// propFields maps the "fgb" tag names of the exported fields of a
+// struct type to their field indices.
+func propFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, ok := sf.Tag.Lookup(propTag)
+		if !ok || name == "" || name == "-" {
+			continue
+		}
+		fields[name] = sf.Index
+	}
+	return fields
+}
+
+// isBytes reports whether a type is a byte slice.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// decodeProp stores a property value, as returned by
+// PropReader.ReadSchema, into a settable field. If the value can't be
+// stored, the field is not modified and the reason is returned.
+func decodeProp(field reflect.Value, x interface{}) string {
+	if field.Kind() == reflect.Pointer {
+		if !field.IsNil() {
+			return decodeProp(field.Elem(), x)
+		}
+		p := reflect.New(field.Type().Elem())
+		if reason := decodeProp(p.Elem(), x); reason != "" {
+			return reason
+		}
+		field.Set(p)
+		return ""
+	}
+
+	val := reflect.ValueOf(x)
+	switch field.Kind() {
+	case reflect.Interface:
+		if val.Type().AssignableTo(field.Type()) {
+			field.Set(val)
+			return ""
+		}
+	case reflect.Bool:
+		if val.Kind() == reflect.Bool {
+			field.SetBool(val.Bool())
+			return ""
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch {
+		case val.CanInt():
+			if field.OverflowInt(val.Int()) {
+				return fmt.Sprintf("value %d overflows %s", val.Int(), field.Type())
+			}
+			field.SetInt(val.Int())
+			return ""
+		case val.CanUint():
+			if val.Uint() > math.MaxInt64 || field.OverflowInt(int64(val.Uint())) {
+				return fmt.Sprintf("value %d overflows %s", val.Uint(), field.Type())
+			}
+			field.SetInt(int64(val.Uint()))
+			return ""
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch {
+		case val.CanInt():
+			if val.Int() < 0 || field.OverflowUint(uint64(val.Int())) {
+				return fmt.Sprintf("value %d overflows %s", val.Int(), field.Type())
+			}
+			field.SetUint(uint64(val.Int()))
+			return ""
+		case val.CanUint():
+			if field.OverflowUint(val.Uint()) {
+				return fmt.Sprintf("value %d overflows %s", val.Uint(), field.Type())
+			}
+			field.SetUint(val.Uint())
+			return ""
+		}
+	case reflect.Float32, reflect.Float64:
+		var y float64
+		switch {
+		case val.CanInt():
+			y = float64(val.Int())
+		case val.CanUint():
+			y = float64(val.Uint())
+		case val.CanFloat():
+			y = val.Float()
+		default:
+			return fmt.Sprintf("%T not convertible to %s", x, field.Type())
+		}
+		if field.OverflowFloat(y) {
+			return fmt.Sprintf("value %g overflows %s", y, field.Type())
+		}
+		field.SetFloat(y)
+		return ""
+	case reflect.String:
+		if val.Kind() == reflect.String {
+			field.SetString(val.String())
+			return ""
+		} else if isBytes(val.Type()) {
+			field.SetString(string(val.Bytes()))
+			return ""
+		}
+	case reflect.Slice:
+		if !isBytes(field.Type()) {
+			break
+		} else if val.Kind() == reflect.String {
+			field.SetBytes([]byte(val.String()))
+			return ""
+		} else if isBytes(val.Type()) {
+			field.SetBytes(val.Bytes())
+			return ""
+		}
+	}
+	return fmt.Sprintf("%T not convertible to %s", x, field.Type())
+}
+
+// EncodeProperties writes the fields of a struct, or pointer to struct,
+// as feature properties in FlatGeobuf property format. It is the
+// inverse of DecodeProperties, and uses the same "fgb" struct tags to
+// map fields to the columns of the schema s, which will typically be
+// the header of the file being written. The number of bytes written is
+// returned.
+//
+// Properties are written in schema column order. A column is skipped if
+// no field is tagged with its name, or if the field is a nil pointer or
+// nil interface, so that the property is absent from the feature. Field
+// values are converted to the column type using the same rules as
+// DecodeProperties, so for example an int field may be written to a
+// Short column, provided its value fits. Tagged fields with no matching
+// column are an error, as are columns of unknown type and malformed
+// schemas.
+//
+// The properties written can be stored in a feature using the
+// flat.FeatureAddProperties function.
+func EncodeProperties(w *PropWriter, s Schema, in interface{}) (int, error) {
+	v := reflect.ValueOf(in)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, fmtErr("can't encode properties from %T (must be a struct or non-nil pointer to a struct)", in)
+	}
+	fields := propFields(v.Type())
+
+	// Read the column names and types up front, since the schema may
+	// come from a malformed file.
+	var names []string
+	var types []flat.ColumnType
+	if err := safeFlatBuffersInteraction(func() error {
+		var col flat.Column
+		for i := 0; i < s.ColumnsLength(); i++ {
+			if !s.Columns(&col, i) {
+				return fmt.Errorf("schema failed to locate column %d", i)
+			}
+			names = append(names, string(col.Name()))
+			types = append(types, col.Type())
+		}
+		return nil
+	}); err != nil {
+		return 0, wrapErr("failed to read schema", err)
+	}
+
+	var n int
+	for i, name := range names {
+		j, ok := fields[name]
+		if !ok {
+			continue
+		}
+		delete(fields, name)
+		field := v.FieldByIndex(j)
+		for (field.Kind() == reflect.Pointer || field.Kind() == reflect.Interface) && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Pointer || field.Kind() == reflect.Interface {
+			continue
+		}
+		typ := types[i]
+		goType := columnGoType(typ)
+		if goType == nil {
+			return n, fmtErr("column %q has unknown type %s", name, typ)
+		}
+		x := reflect.New(goType).Elem()
+		if reason := decodeProp(x, field.Interface()); reason != "" {
+			return n, fmtErr("can't encode field %s into column %q (%s): %s", v.Type().FieldByIndex(j).Name, name, typ, reason)
+		}
+		m, err := writeProp(w, uint16(i), x.Interface())
+		n += m
+		if err != nil {
+			return n, wrapErr("failed to write column %q", err, name)
+		}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if name := sf.Tag.Get(propTag); fields[name] != nil {
+			return n, fmtErr("field %s has no matching column %q in schema", sf.Name, name)
+		}
+	}
+	return n, nil
+}
+
+// columnGoType returns the Go type of the values PropReader.ReadSchema
+// returns for a column type, or nil if the column type is unknown.
+func columnGoType(typ flat.ColumnType) reflect.Type {
+	switch typ {
+	case flat.ColumnTypeByte:
+		return reflect.TypeOf(int8(0))
+	case flat.ColumnTypeUByte:
+		return reflect.TypeOf(uint8(0))
+	case flat.ColumnTypeBool:
+		return reflect.TypeOf(false)
+	case flat.ColumnTypeShort:
+		return reflect.TypeOf(int16(0))
+	case flat.ColumnTypeUShort:
+		return reflect.TypeOf(uint16(0))
+	case flat.ColumnTypeInt:
+		return reflect.TypeOf(int32(0))
+	case flat.ColumnTypeUInt:
+		return reflect.TypeOf(uint32(0))
+	case flat.ColumnTypeLong:
+		return reflect.TypeOf(int64(0))
+	case flat.ColumnTypeULong:
+		return reflect.TypeOf(uint64(0))
+	case flat.ColumnTypeFloat:
+		return reflect.TypeOf(float32(0))
+	case flat.ColumnTypeDouble:
+		return reflect.TypeOf(float64(0))
+	case flat.ColumnTypeString, flat.ColumnTypeDateTime:
+		return reflect.TypeOf("")
+	case flat.ColumnTypeJson, flat.ColumnTypeBinary:
+		return reflect.TypeOf([]byte(nil))
+	default:
+		return nil
+	}
+}
+
+// writeProp writes a column index followed by a property value of one
+// of the Go types returned by columnGoType.
+func writeProp(w *PropWriter, col uint16, x interface{}) (n int, err error) {
+	if n, err = w.WriteUShort(col); err != nil {
+		return
+	}
+	var m int
+	switch y := x.(type) {
+	case int8:
+		m, err = w.WriteByte(y)
+	case uint8:
+		m, err = w.WriteUByte(y)
+	case bool:
+		m, err = w.WriteBool(y)
+	case int16:
+		m, err = w.WriteShort(y)
+	case uint16:
+		m, err = w.WriteUShort(y)
+	case int32:
+		m, err = w.WriteInt(y)
+	case uint32:
+		m, err = w.WriteUInt(y)
+	case int64:
+		m, err = w.WriteLong(y)
+	case uint64:
+		m, err = w.WriteULong(y)
+	case float32:
+		m, err = w.WriteFloat(y)
+	case float64:
+		m, err = w.WriteDouble(y)
+	case string:
+		m, err = w.WriteString(y)
+	case []byte:
+		m, err = w.WriteBinary(y)
+	default:
+		fmtPanic("logic error: unexpected property type %T", x)
+	}
+	n += m
+	return
+}
@@ -0,0 +1,312 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/flatgeobuf/flat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeProperties(t *testing.T) {
+	t.Run("Country", func(t *testing.T) {
+		r := NewFileReader(bytes.NewReader(readTestFile(t, "countries.fgb")))
+		hdr, err := r.Header()
+		require.NoError(t, err)
+		p := make([]flat.Feature, 1)
+		_, err = r.Data(p)
+		require.NoError(t, err)
+		var country struct {
+			ID      string `fgb:"id"`
+			Name    string `fgb:"name"`
+			Ignored string
+		}
+
+		err = DecodeProperties(&p[0], hdr, &country)
+
+		require.NoError(t, err)
+		assert.Equal(t, "ATA", country.ID)
+		assert.Equal(t, "Antarctica", country.Name)
+		assert.Empty(t, country.Ignored)
+	})
+
+	schema := headerSpec{columns: []columnSpec{
+		{name: "int", typ: flat.ColumnTypeInt},
+		{name: "double", typ: flat.ColumnTypeDouble},
+		{name: "bool", typ: flat.ColumnTypeBool},
+		{name: "string", typ: flat.ColumnTypeString},
+		{name: "binary", typ: flat.ColumnTypeBinary},
+		{name: "ulong", typ: flat.ColumnTypeULong},
+		{name: "short", typ: flat.ColumnTypeShort},
+	}}.build()
+	var buf bytes.Buffer
+	w := NewPropWriter(&buf)
+	for _, write := range []func() (int, error){
+		func() (int, error) { return w.WriteUShort(0) },
+		func() (int, error) { return w.WriteInt(-300) },
+		func() (int, error) { return w.WriteUShort(1) },
+		func() (int, error) { return w.WriteDouble(2.5) },
+		func() (int, error) { return w.WriteUShort(2) },
+		func() (int, error) { return w.WriteBool(true) },
+		func() (int, error) { return w.WriteUShort(3) },
+		func() (int, error) { return w.WriteString("foo") },
+		func() (int, error) { return w.WriteUShort(4) },
+		func() (int, error) { return w.WriteBinary([]byte{1, 2, 3}) },
+		func() (int, error) { return w.WriteUShort(5) },
+		func() (int, error) { return w.WriteULong(1 << 40) },
+		func() (int, error) { return w.WriteUShort(6) },
+		func() (int, error) { return w.WriteShort(-12) },
+	} {
+		_, err := write()
+		require.NoError(t, err)
+	}
+	f := featureSpec{properties: buf.Bytes()}.build()
+
+	t.Run("Conversions", func(t *testing.T) {
+		type target struct {
+			Int         int64       `fgb:"int"`
+			Short       float32     `fgb:"short"`
+			Double      float64     `fgb:"double"`
+			Bool        *bool       `fgb:"bool"`
+			String      []byte      `fgb:"string"`
+			Binary      string      `fgb:"binary"`
+			ULong       interface{} `fgb:"ulong"`
+			Missing     int         `fgb:"missing"`
+			Skipped     int         `fgb:"-"`
+			notExported int         `fgb:"int"`
+			Untagged    int
+		}
+		var out target
+		out.Missing = 7
+
+		err := DecodeProperties(f, schema, &out)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(-300), out.Int)
+		assert.Equal(t, float32(-12), out.Short)
+		assert.Equal(t, 2.5, out.Double)
+		require.NotNil(t, out.Bool)
+		assert.True(t, *out.Bool)
+		assert.Equal(t, []byte("foo"), out.String)
+		assert.Equal(t, "\x01\x02\x03", out.Binary)
+		assert.Equal(t, uint64(1<<40), out.ULong)
+		assert.Equal(t, 7, out.Missing)
+		assert.Zero(t, out.Skipped)
+		assert.Zero(t, out.notExported)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			out      interface{}
+			expected string
+		}{
+			{"NotPointer", struct{}{}, "flatgeobuf: can't decode properties into struct {} (must be a non-nil pointer to a struct)"},
+			{"NilPointer", (*struct{})(nil), "flatgeobuf: can't decode properties into *struct {} (must be a non-nil pointer to a struct)"},
+			{"NotStruct", new(int), "flatgeobuf: can't decode properties into *int (must be a non-nil pointer to a struct)"},
+			{"IntOverflow", &struct {
+				X int8 `fgb:"int"`
+			}{}, `flatgeobuf: can't decode column "int" (Int) into field X: value -300 overflows int8`},
+			{"NegativeUint", &struct {
+				X uint `fgb:"int"`
+			}{}, `flatgeobuf: can't decode column "int" (Int) into field X: value -300 overflows uint`},
+			{"ULongOverflow", &struct {
+				X int32 `fgb:"ulong"`
+			}{}, `flatgeobuf: can't decode column "ulong" (ULong) into field X: value 1099511627776 overflows int32`},
+			{"FloatToInt", &struct {
+				X int `fgb:"double"`
+			}{}, `flatgeobuf: can't decode column "double" (Double) into field X: float64 not convertible to int`},
+			{"BoolToString", &struct {
+				X string `fgb:"bool"`
+			}{}, `flatgeobuf: can't decode column "bool" (Bool) into field X: bool not convertible to string`},
+			{"StringToBool", &struct {
+				X *bool `fgb:"string"`
+			}{}, `flatgeobuf: can't decode column "string" (String) into field X: string not convertible to bool`},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				err := DecodeProperties(f, schema, testCase.out)
+
+				assert.EqualError(t, err, testCase.expected)
+			})
+		}
+	})
+
+	t.Run("PointerNotAllocatedOnError", func(t *testing.T) {
+		var out struct {
+			X *int8 `fgb:"int"`
+		}
+
+		err := DecodeProperties(f, schema, &out)
+
+		assert.Error(t, err)
+		assert.Nil(t, out.X)
+	})
+}
+
+func TestEncodeProperties(t *testing.T) {
+	schema := headerSpec{columns: []columnSpec{
+		{name: "byte", typ: flat.ColumnTypeByte},
+		{name: "ubyte", typ: flat.ColumnTypeUByte},
+		{name: "bool", typ: flat.ColumnTypeBool},
+		{name: "short", typ: flat.ColumnTypeShort},
+		{name: "ushort", typ: flat.ColumnTypeUShort},
+		{name: "int", typ: flat.ColumnTypeInt},
+		{name: "uint", typ: flat.ColumnTypeUInt},
+		{name: "long", typ: flat.ColumnTypeLong},
+		{name: "ulong", typ: flat.ColumnTypeULong},
+		{name: "float", typ: flat.ColumnTypeFloat},
+		{name: "double", typ: flat.ColumnTypeDouble},
+		{name: "string", typ: flat.ColumnTypeString},
+		{name: "json", typ: flat.ColumnTypeJson},
+		{name: "datetime", typ: flat.ColumnTypeDateTime},
+		{name: "binary", typ: flat.ColumnTypeBinary},
+		{name: "absent", typ: flat.ColumnTypeInt},
+	}}.build()
+
+	type record struct {
+		Byte     int      `fgb:"byte"`
+		UByte    uint8    `fgb:"ubyte"`
+		Bool     bool     `fgb:"bool"`
+		Short    int16    `fgb:"short"`
+		UShort   uint     `fgb:"ushort"`
+		Int      int32    `fgb:"int"`
+		UInt     uint32   `fgb:"uint"`
+		Long     int64    `fgb:"long"`
+		ULong    uint64   `fgb:"ulong"`
+		Float    float32  `fgb:"float"`
+		Double   float64  `fgb:"double"`
+		String   string   `fgb:"string"`
+		JSON     []byte   `fgb:"json"`
+		DateTime string   `fgb:"datetime"`
+		Binary   []byte   `fgb:"binary"`
+		Absent   *int     `fgb:"absent"`
+		Ignored  string   `fgb:"-"`
+		Untagged struct{} // Not convertible, but ignored.
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		in := record{
+			Byte:     -100,
+			UByte:    200,
+			Bool:     true,
+			Short:    -30000,
+			UShort:   60000,
+			Int:      -2000000000,
+			UInt:     4000000000,
+			Long:     -1 << 60,
+			ULong:    1 << 63,
+			Float:    1.5,
+			Double:   -2.25,
+			String:   "foo",
+			JSON:     []byte(`{"bar":1}`),
+			DateTime: "2023-06-01T00:00:00Z",
+			Binary:   []byte{0, 1, 2},
+			Ignored:  "ignored",
+		}
+		var buf bytes.Buffer
+
+		n, err := EncodeProperties(NewPropWriter(&buf), schema, &in)
+
+		require.NoError(t, err)
+		assert.Equal(t, buf.Len(), n)
+		vals, err := NewPropReader(bytes.NewReader(buf.Bytes())).ReadSchema(schema)
+		require.NoError(t, err)
+		require.Len(t, vals, 15)
+		for i := range vals {
+			assert.Equal(t, uint16(i), vals[i].ColIndex)
+		}
+		f := featureSpec{properties: buf.Bytes()}.build()
+		var out record
+		err = DecodeProperties(f, schema, &out)
+		require.NoError(t, err)
+		in.Ignored = ""
+		assert.Equal(t, in, out)
+	})
+
+	t.Run("Pointers", func(t *testing.T) {
+		x := 7
+		in := struct {
+			Absent *int        `fgb:"absent"`
+			Int    interface{} `fgb:"int"`
+			Long   interface{} `fgb:"long"`
+		}{Absent: &x, Int: int16(-5)}
+		var buf bytes.Buffer
+
+		n, err := EncodeProperties(NewPropWriter(&buf), schema, in)
+
+		require.NoError(t, err)
+		assert.Equal(t, buf.Len(), n)
+		vals, err := NewPropReader(bytes.NewReader(buf.Bytes())).ReadSchema(schema)
+		require.NoError(t, err)
+		require.Len(t, vals, 2)
+		assert.Equal(t, int32(-5), vals[0].Value)
+		assert.Equal(t, int32(7), vals[1].Value)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			in       interface{}
+			expected string
+		}{
+			{"NotStruct", 1, "flatgeobuf: can't encode properties from int (must be a struct or non-nil pointer to a struct)"},
+			{"NilPointer", (*record)(nil), "flatgeobuf: can't encode properties from *flatgeobuf.record (must be a struct or non-nil pointer to a struct)"},
+			{"Overflow", struct {
+				X int `fgb:"byte"`
+			}{300}, `flatgeobuf: can't encode field X into column "byte" (Byte): value 300 overflows int8`},
+			{"Negative", struct {
+				X int `fgb:"uint"`
+			}{-1}, `flatgeobuf: can't encode field X into column "uint" (UInt): value -1 overflows uint32`},
+			{"FloatToInt", struct {
+				X float64 `fgb:"int"`
+			}{1.5}, `flatgeobuf: can't encode field X into column "int" (Int): float64 not convertible to int32`},
+			{"StringToBool", struct {
+				X string `fgb:"bool"`
+			}{"true"}, `flatgeobuf: can't encode field X into column "bool" (Bool): string not convertible to bool`},
+			{"NoColumn", struct {
+				X int `fgb:"missing"`
+			}{}, `flatgeobuf: field X has no matching column "missing" in schema`},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				_, err := EncodeProperties(NewPropWriter(&bytes.Buffer{}), schema, testCase.in)
+
+				assert.EqualError(t, err, testCase.expected)
+			})
+		}
+	})
+
+	t.Run("UnknownColumnType", func(t *testing.T) {
+		unknown := headerSpec{columns: []columnSpec{
+			{name: "int", typ: flat.ColumnTypeInt},
+			{name: "unknown", typ: flat.ColumnType(99)},
+		}}.build()
+		in := struct {
+			Int     int `fgb:"int"`
+			Unknown int `fgb:"unknown"`
+		}{1, 2}
+
+		_, err := EncodeProperties(NewPropWriter(&bytes.Buffer{}), unknown, in)
+
+		assert.EqualError(t, err, `flatgeobuf: column "unknown" has unknown type ColumnType(99)`)
+	})
+
+	t.Run("MalformedSchema", func(t *testing.T) {
+		malformed := flat.GetRootAsHeader([]byte{0xff, 0xff, 0xff, 0x7f}, 0)
+		in := struct {
+			Int int `fgb:"int"`
+		}{1}
+
+		_, err := EncodeProperties(NewPropWriter(&bytes.Buffer{}), malformed, in)
+
+		assert.ErrorContains(t, err, "flatgeobuf: failed to read schema: panic: flatbuffers: ")
+	})
+}
@@ -6,6 +6,9 @@ package flatgeobuf
 
 import (
 	"io"
+	"math"
+
+	flatbuffers "github.com/google/flatbuffers/go"
 )
 
 const (
@@ -17,12 +20,19 @@ const (
 	// MaxSpecMajorVersion is the maximum major version of the
 	// FlatGeobuf specification that this package can read.
 	MaxSpecMajorVersion = 0x03
-	// headerMaxLen is an artificial limit, not imposed by the
-	// FlatGeobuf specification, on the maximum size of a FlatGeobuf
-	// file header this package will read. The purpose of this value
-	// is to impose some limitation, to prevent corrupted or malicious
-	// file headers from causing huge and pointless memory allocations.
+	// headerMaxLen is the default value of an artificial limit, not
+	// imposed by the FlatGeobuf specification, on the maximum size of
+	// a FlatGeobuf file header this package will read. The purpose of
+	// this value is to impose some limitation, to prevent corrupted or
+	// malicious file headers from causing huge and pointless memory
+	// allocations. It can be overridden using FileReader.MaxHeaderLen.
 	headerMaxLen = 32 * 1024 * 1024
+	// headerFeaturesCountSlot is the FlatBuffers vtable offset of the
+	// feature count field in the FlatGeobuf header table.
+	headerFeaturesCountSlot = 20
+	// defaultNodeSize is the index node size used by default by the
+	// reference FlatGeobuf implementations.
+	defaultNodeSize = 16
 )
 
 // magic contains the FlatGeobuf magic number.
@@ -32,6 +42,11 @@ const (
 // version of data written by this package.
 var magic = [magicLen]byte{0x66, 0x67, 0x62, 0x03, 0x66, 0x67, 0x62, 0x01}
 
+// maxFeatureCount is the largest header feature count this package
+// accepts, since feature counts are handled as int values. It is a
+// variable so that tests can simulate a 32-bit platform.
+var maxFeatureCount uint64 = math.MaxInt
+
 // SpecVersion is a version of the FlatGeobuf specification.
 type SpecVersion struct {
 	// Major is the major version of the FlatGeobuf specification.
@@ -64,3 +79,53 @@ func Magic(r io.Reader) (SpecVersion, error) {
 	}
 	return SpecVersion{}, textErr("invalid magic number")
 }
+
+// QuickCheck reads the FlatGeobuf magic number and header length from
+// a seekable stream and verifies that the stream is long enough to
+// contain the complete header. It returns an error if the magic number
+// is invalid or the header is truncated.
+//
+// QuickCheck detects truncated files early, before any attempt is made
+// to read the full header. It does not validate the header contents,
+// nor does it check the index or data sections.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+// Before returning, QuickCheck restores the stream to its original
+// position.
+func QuickCheck(rs io.ReadSeeker) (err error) {
+	// Save the starting position and ensure it is restored on return.
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query start offset", err)
+	}
+	defer func() {
+		if _, seekErr := rs.Seek(start, io.SeekStart); seekErr != nil && err == nil {
+			err = wrapErr("failed to restore start offset", seekErr)
+		}
+	}()
+
+	// Verify the magic number.
+	if _, err = Magic(rs); err != nil {
+		return wrapErr("failed to read magic number", err)
+	}
+
+	// Read the header length, which is a little-endian 4-byte unsigned
+	// integer.
+	b := make([]byte, flatbuffers.SizeUint32)
+	if _, err = io.ReadFull(rs, b); err != nil {
+		return wrapErr("header length read error", err)
+	}
+	headerLen := flatbuffers.GetUint32(b)
+
+	// Compare the header length to the number of bytes remaining.
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return wrapErr("failed to query end offset", err)
+	}
+	rem := end - start - magicLen - flatbuffers.SizeUint32
+	if int64(headerLen) > rem {
+		return fmtErr("truncated header: header length %d exceeds remaining %d bytes", headerLen, rem)
+	}
+
+	return nil
+}
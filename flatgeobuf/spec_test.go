@@ -0,0 +1,49 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickCheck(t *testing.T) {
+	countries := readTestFile(t, "countries.fgb")
+
+	testCases := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"Valid", countries, ""},
+		{"HeaderOnly", countries[0:616], ""},
+		{"EmptyFile", []byte{}, "flatgeobuf: failed to read magic number: EOF"},
+		{"TruncatedMagic", countries[0:5], "flatgeobuf: failed to read magic number: unexpected EOF"},
+		{"InvalidMagic", []byte("not a flatgeobuf file"), "flatgeobuf: failed to read magic number: flatgeobuf: invalid magic number"},
+		{"TruncatedHeaderLength", countries[0:10], "flatgeobuf: header length read error: unexpected EOF"},
+		{"TruncatedHeader", countries[0:100], "flatgeobuf: truncated header: header length 604 exceeds remaining 88 bytes"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rs := bytes.NewReader(testCase.input)
+
+			err := QuickCheck(rs)
+
+			if testCase.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testCase.expected)
+			}
+			offset, err := rs.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), offset, "QuickCheck must restore the stream position")
+		})
+	}
+}
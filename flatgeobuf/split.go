@@ -0,0 +1,111 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import "io"
+
+// SplitFile copies the three sections of a FlatGeobuf file to separate
+// writers: the header section, comprising the magic number and header
+// table, to headerW; the spatial index section to indexW; and the data
+// section to dataW.
+//
+// SplitFile supports storage schemes which keep the index separately
+// from the rest of the file, for example to version it independently.
+// Each section is copied unchanged, so the header, index, and data
+// parts written back to back reproduce the original file exactly. The
+// index part can be read with packedrtree.Unmarshal, given the feature
+// count and node size of the original file, which Describe reports. If
+// the file has no index, nothing is written to indexW. To produce a
+// header and data part which can be read without the index, use
+// SplitFileForExternalIndex.
+//
+// The stream should be positioned at the start of the FlatGeobuf file.
+// An error is returned if the file has an index but its header does not
+// record the feature count, since the index size can't be determined.
+func SplitFile(rs io.ReadSeeker, headerW, indexW, dataW io.Writer) error {
+	return splitFile(rs, headerW, indexW, dataW, false)
+}
+
+// SplitFileForExternalIndex is like SplitFile, except that if the file
+// has an index, the header written to headerW is rewritten with an
+// index node size of zero. The header and data parts written back to
+// back then form a valid FlatGeobuf file without an index, which can be
+// read together with the index part using NewFileReaderWithIndex, given
+// the feature count and node size of the original file. Since the
+// rewritten header doesn't record the node size, the three parts
+// written back to back do not form a valid FlatGeobuf file.
+func SplitFileForExternalIndex(rs io.ReadSeeker, headerW, indexW, dataW io.Writer) error {
+	return splitFile(rs, headerW, indexW, dataW, true)
+}
+
+// splitFile implements SplitFile and SplitFileForExternalIndex. If
+// unindexed is true and the file has an index, the header is rewritten
+// with an index node size of zero.
+func splitFile(rs io.ReadSeeker, headerW, indexW, dataW io.Writer, unindexed bool) error {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query start offset", err)
+	}
+
+	// Find the size of each section.
+	layout, err := Describe(rs)
+	if err != nil {
+		return err
+	}
+
+	// Copy the header section, rewriting the header table with an index
+	// node size of zero if requested.
+	if !unindexed || !layout.HasIndex {
+		if _, err = io.CopyN(headerW, rs, layout.IndexOffset); err != nil {
+			return wrapErr("failed to copy header section", err)
+		}
+	} else if err = copyUnindexedHeader(rs, headerW); err != nil {
+		return err
+	}
+
+	// Copy the index and data sections.
+	if _, err = rs.Seek(start+layout.IndexOffset, io.SeekStart); err != nil {
+		return wrapErr("failed to seek to index offset", err)
+	}
+	if _, err = io.CopyN(indexW, rs, layout.DataOffset-layout.IndexOffset); err != nil {
+		return wrapErr("failed to copy index section", err)
+	}
+	if _, err = io.Copy(dataW, rs); err != nil {
+		return wrapErr("failed to copy data section", err)
+	}
+	return nil
+}
+
+// copyUnindexedHeader reads the magic number and header of the
+// FlatGeobuf file at the current position of rs, and writes them to w
+// with the header rewritten to have an index node size of zero.
+func copyUnindexedHeader(rs io.ReadSeeker, w io.Writer) error {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return wrapErr("failed to query start offset", err)
+	}
+	r := NewFileReader(rs)
+	hdr, err := r.Header()
+	if err != nil {
+		return err
+	}
+	newHdr, err := cloneHeader(hdr, 0, nil, nil)
+	if err != nil {
+		return wrapErr("failed to rewrite header", err)
+	}
+
+	// Copy the original magic number, so the file's version is
+	// preserved, followed by the new header.
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return wrapErr("failed to seek to start offset", err)
+	}
+	if _, err = io.CopyN(w, rs, magicLen); err != nil {
+		return wrapErr("failed to copy magic number", err)
+	}
+	if _, err = writeSizePrefixedTable(w, newHdr.Table()); err != nil {
+		return wrapErr("failed to write header", err)
+	}
+	return nil
+}
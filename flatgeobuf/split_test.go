@@ -0,0 +1,157 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package flatgeobuf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogama/flatgeobuf/packedrtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFile(t *testing.T) {
+	t.Run("Countries", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		layout, err := Describe(bytes.NewReader(file))
+		require.NoError(t, err)
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err = SplitFile(bytes.NewReader(file), &headerBuf, &indexBuf, &dataBuf)
+
+		require.NoError(t, err)
+		assert.Equal(t, file[0:layout.IndexOffset], headerBuf.Bytes())
+		assert.Equal(t, file[layout.IndexOffset:layout.DataOffset], indexBuf.Bytes())
+		assert.Equal(t, file[layout.DataOffset:], dataBuf.Bytes())
+		index, err := packedrtree.Unmarshal(bytes.NewReader(indexBuf.Bytes()), 179, 16)
+		require.NoError(t, err)
+		assert.Equal(t, 179, index.NumRefs())
+
+		t.Run("Reassemble", func(t *testing.T) {
+			joined := append(append(append([]byte{}, headerBuf.Bytes()...), indexBuf.Bytes()...), dataBuf.Bytes()...)
+			require.Equal(t, file, joined)
+			r := NewFileReader(bytes.NewReader(joined))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+			assert.Equal(t, uint16(16), hdr.IndexNodeSize())
+
+			fs, err := r.IndexSearch(packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60}) // Europe
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, fs)
+		})
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		file := readTestFile(t, "heterogeneous.fgb")
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err := SplitFile(bytes.NewReader(file), &headerBuf, &indexBuf, &dataBuf)
+
+		require.NoError(t, err)
+		assert.Equal(t, 0, indexBuf.Len())
+		assert.Equal(t, file, append(append([]byte{}, headerBuf.Bytes()...), dataBuf.Bytes()...))
+	})
+
+	t.Run("NotAtStart", func(t *testing.T) {
+		file := readTestFile(t, "poly00.fgb")
+		rs := bytes.NewReader(append([]byte("junk"), file...))
+		_, err := rs.Seek(4, 0)
+		require.NoError(t, err)
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err = SplitFile(rs, &headerBuf, &indexBuf, &dataBuf)
+
+		require.NoError(t, err)
+		layout, err := Describe(bytes.NewReader(file))
+		require.NoError(t, err)
+		assert.Equal(t, file[0:layout.IndexOffset], headerBuf.Bytes())
+		assert.Equal(t, file[layout.IndexOffset:layout.DataOffset], indexBuf.Bytes())
+		assert.Equal(t, file[layout.DataOffset:], dataBuf.Bytes())
+	})
+
+	t.Run("TruncatedIndex", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err := SplitFile(bytes.NewReader(file[0:1000]), &headerBuf, &indexBuf, &dataBuf)
+
+		assert.EqualError(t, err, "flatgeobuf: failed to copy index section: EOF")
+	})
+
+	t.Run("InvalidMagic", func(t *testing.T) {
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err := SplitFile(bytes.NewReader([]byte("not a flatgeobuf file")), &headerBuf, &indexBuf, &dataBuf)
+
+		assert.EqualError(t, err, "flatgeobuf: failed to read magic number: flatgeobuf: invalid magic number")
+	})
+}
+
+func TestSplitFileForExternalIndex(t *testing.T) {
+	t.Run("Countries", func(t *testing.T) {
+		file := readTestFile(t, "countries.fgb")
+		layout, err := Describe(bytes.NewReader(file))
+		require.NoError(t, err)
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err = SplitFileForExternalIndex(bytes.NewReader(file), &headerBuf, &indexBuf, &dataBuf)
+
+		require.NoError(t, err)
+		assert.Equal(t, file[layout.IndexOffset:layout.DataOffset], indexBuf.Bytes())
+		assert.Equal(t, file[layout.DataOffset:], dataBuf.Bytes())
+		assert.Equal(t, file[0:magicLen], headerBuf.Bytes()[0:magicLen])
+
+		t.Run("Header", func(t *testing.T) {
+			r := NewFileReader(bytes.NewReader(headerBuf.Bytes()))
+			hdr, err := r.Header()
+			require.NoError(t, err)
+			orig := NewFileReader(bytes.NewReader(file))
+			origHdr, err := orig.Header()
+			require.NoError(t, err)
+
+			assert.Equal(t, uint16(0), hdr.IndexNodeSize())
+			assert.Equal(t, origHdr.FeaturesCount(), hdr.FeaturesCount())
+			assert.Equal(t, origHdr.GeometryType(), hdr.GeometryType())
+			assert.Equal(t, string(origHdr.Name()), string(hdr.Name()))
+			assert.Equal(t, origHdr.ColumnsLength(), hdr.ColumnsLength())
+		})
+
+		t.Run("WithIndex", func(t *testing.T) {
+			unindexed := append(append([]byte{}, headerBuf.Bytes()...), dataBuf.Bytes()...)
+			r, err := NewFileReaderWithIndex(bytes.NewReader(unindexed), bytes.NewReader(indexBuf.Bytes()), layout.NumFeatures, layout.NodeSize)
+			require.NoError(t, err)
+			_, err = r.Header()
+			require.NoError(t, err)
+			orig := NewFileReader(bytes.NewReader(file))
+			_, err = orig.Header()
+			require.NoError(t, err)
+			box := packedrtree.Box{XMin: -10, YMin: 35, XMax: 30, YMax: 60} // Europe
+			expected, err := orig.IndexSearch(box)
+			require.NoError(t, err)
+			require.NotEmpty(t, expected)
+
+			actual, err := r.IndexSearch(box)
+
+			require.NoError(t, err)
+			require.Len(t, actual, len(expected))
+			for i := range actual {
+				assert.Equal(t, featureString(t, &expected[i]), featureString(t, &actual[i]), "feature %d", i)
+			}
+		})
+	})
+
+	t.Run("NoIndex", func(t *testing.T) {
+		file := readTestFile(t, "heterogeneous.fgb")
+		var headerBuf, indexBuf, dataBuf bytes.Buffer
+
+		err := SplitFileForExternalIndex(bytes.NewReader(file), &headerBuf, &indexBuf, &dataBuf)
+
+		require.NoError(t, err)
+		assert.Equal(t, 0, indexBuf.Len())
+		assert.Equal(t, file, append(append([]byte{}, headerBuf.Bytes()...), dataBuf.Bytes()...))
+	})
+}
@@ -159,8 +159,10 @@ func stringGeom(f *flat.Feature, b *strings.Builder) error {
 			b.WriteString("{Type:")
 			b.WriteString(g.Type().String())
 			b.WriteString(",Bounds:")
-			bounds := packedrtree.EmptyBox
-			geomBounds(&g, &bounds)
+			bounds, err := FeatureBounds(f)
+			if err != nil {
+				return err
+			}
 			if bounds == packedrtree.EmptyBox {
 				b.WriteString("<nil>")
 			} else {
@@ -213,17 +215,3 @@ func stringProps(f *flat.Feature, b *strings.Builder, s []Schema) error {
 		return nil
 	})
 }
-
-func geomBounds(g *flat.Geometry, b *packedrtree.Box) {
-	n := g.XyLength()
-	for i := 0; i < n; i += 2 {
-		b.ExpandXY(g.Xy(i+0), g.Xy(i+1))
-	}
-	n = g.PartsLength()
-	for i := 0; i < n; i++ {
-		var h flat.Geometry
-		if g.Parts(&h, i) {
-			geomBounds(&h, b)
-		}
-	}
-}
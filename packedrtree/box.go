@@ -87,6 +87,40 @@ func (b *Box) ExpandXY(x, y float64) {
 	}
 }
 
+// Corners returns the four corner coordinates of the Box as (x, y)
+// pairs in counter-clockwise order, starting from the minimum corner:
+// (XMin, YMin), (XMax, YMin), (XMax, YMax), (XMin, YMax). This order
+// is suitable for rendering the Box as a polygon ring.
+//
+// If the Box is empty, for example EmptyBox, all corner coordinates are
+// NaN.
+func (b Box) Corners() [4][2]float64 {
+	if b.XMin > b.XMax || b.YMin > b.YMax {
+		nan := math.NaN()
+		return [4][2]float64{{nan, nan}, {nan, nan}, {nan, nan}, {nan, nan}}
+	}
+	return [4][2]float64{
+		{b.XMin, b.YMin},
+		{b.XMax, b.YMin},
+		{b.XMax, b.YMax},
+		{b.XMin, b.YMax},
+	}
+}
+
+// IntersectsAny returns true if the Box intersects at least one of the
+// other boxes, using the same test as a PackedRTree search, so boxes
+// which merely touch along an edge or at a corner intersect. It stops
+// at the first intersecting box. If others is empty, the result is
+// false.
+func (b Box) IntersectsAny(others []Box) bool {
+	for i := range others {
+		if b.intersects(&others[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // intersects returns true iff the given box intersects the receiver.
 func (b *Box) intersects(c *Box) bool {
 	if b.XMax < c.XMin {
@@ -187,6 +187,64 @@ func TestBox_ExpandXY(t *testing.T) {
 	}
 }
 
+func TestBox_Corners(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    Box
+		expected [4][2]float64
+	}{
+		{"Zero", Box{}, [4][2]float64{{0, 0}, {0, 0}, {0, 0}, {0, 0}}},
+		{"UnitSquare", Box{0, 0, 1, 1}, [4][2]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}}},
+		{"Rectangle", Box{-1, -2, 3, 4}, [4][2]float64{{-1, -2}, {3, -2}, {3, 4}, {-1, 4}}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := testCase.input.Corners()
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		actual := EmptyBox.Corners()
+
+		for i := range actual {
+			assert.True(t, math.IsNaN(actual[i][0]), "corner %d x", i)
+			assert.True(t, math.IsNaN(actual[i][1]), "corner %d y", i)
+		}
+	})
+}
+
+func TestBox_IntersectsAny(t *testing.T) {
+	b := Box{-2, -2, 2, 2}
+	testCases := []struct {
+		name     string
+		others   []Box
+		expected bool
+	}{
+		{"Nil", nil, false},
+		{"Empty", []Box{}, false},
+		{"EmptyBox", []Box{EmptyBox}, false},
+		{"Disjoint", []Box{{-100, -2, -50, 0}, {50, -2, 100, 1}, {1, 50, 2, 100}}, false},
+		{"OneOverlapping", []Box{{-100, -2, -50, 0}, {-1, -1, 1, 1}, {1, 50, 2, 100}}, true},
+		{"AllOverlapping", []Box{{-3, -1, -2, 1}, {2, -1, 3, 1}, {1, 2, -1, 3}}, true},
+		{"LastTouching", []Box{{-100, -2, -50, 0}, EmptyBox, {2, 2, 3, 3}}, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := b.IntersectsAny(testCase.others)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+
+	t.Run("EmptyReceiver", func(t *testing.T) {
+		assert.False(t, EmptyBox.IntersectsAny([]Box{{}, b}))
+	})
+}
+
 func TestBox_intersects(t *testing.T) {
 	testCases := []struct {
 		name     string
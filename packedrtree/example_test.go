@@ -97,6 +97,18 @@ func ExampleSeek() {
 	fmt.Printf("Seek 4: %+v %v\n", rs4, err4)
 	// Output: Seek 1: [] <nil>
 	// Seek 2: [] <nil>
-	// Seek 3: [{Offset:3 RefIndex:0} {Offset:1 RefIndex:1} {Offset:2 RefIndex:2} {Offset:0 RefIndex:3}] <nil>
+	// Seek 3: [{Offset:0 RefIndex:3} {Offset:1 RefIndex:1} {Offset:2 RefIndex:2} {Offset:3 RefIndex:0}] <nil>
 	// Seek 4: [{Offset:3 RefIndex:0}] <nil>
 }
+
+func ExampleResult() {
+	packedrtree.HilbertSort(refs, refsBounds(refs)) // Refs must be Hilbert-sorted for New.
+	index, _ := packedrtree.New(refs, 10)           // Ignore error ONLY to keep example simple.
+
+	for _, r := range index.Search(packedrtree.Box{XMin: 0, YMin: 0, XMax: 3, YMax: 3}) {
+		var offset int64 = r.Offset   // Byte offset of the feature in the FlatGeobuf data section.
+		var refIndex int = r.RefIndex // Index of the matched Ref in the slice passed to New.
+		fmt.Println("Offset:", offset, "RefIndex:", refIndex, "Ref:", refs[refIndex])
+	}
+	// Output: Offset: 1 RefIndex: 1 Ref: Ref{[1,1,2,2],Offset:1}
+}
@@ -21,31 +21,6 @@ const (
 	hilbertMax = (1 << HilbertOrder) - 1
 )
 
-// hilbertSortable is an implementation of sort.Interface which allows
-// us to use the reflection-free, hence slightly more performant,
-// sort.Sort function instead of sort.Slice.
-type hilbertSortable struct {
-	refs       []Ref
-	x, y, w, h float64
-}
-
-func (hs *hilbertSortable) Len() int {
-	return len(hs.refs)
-}
-
-func (hs *hilbertSortable) Less(i, j int) bool {
-	a := hilbertOfCenter(&hs.refs[i].Box, hs.x, hs.y, hs.w, hs.h)
-	b := hilbertOfCenter(&hs.refs[j].Box, hs.x, hs.y, hs.w, hs.h)
-	// All reference implementations of FlatGeobuf use '>' to sort in
-	// descending order of Hilbert number.
-	//     https://github.com/flatgeobuf/flatgeobuf/discussions/271
-	return a > b
-}
-
-func (hs *hilbertSortable) Swap(i, j int) {
-	hs.refs[i], hs.refs[j] = hs.refs[j], hs.refs[i]
-}
-
 // HilbertSort sorts a list of feature references, whose overall
 // bounding box is given by bounds, in descending order of position on
 // a Hilbert curve of order HilbertOrder.
@@ -60,15 +35,60 @@ func (hs *hilbertSortable) Swap(i, j int) {
 // on the sort order. Both ascending and descending sorts can be used to
 // create a valid PackedRTree, and any FlatGeobuf implementation will
 // work equally well with an index sorted either way.
+//
+// The Hilbert curve index of each reference is computed once, before
+// sorting, using O(n) extra memory. To reuse that memory across many
+// sorts, use HilbertSortWithKeys.
 func HilbertSort(refs []Ref, bounds Box) {
-	hs := hilbertSortable{
-		refs: refs,
-		x:    bounds.XMin,
-		y:    bounds.YMin,
-		w:    bounds.Width(),
-		h:    bounds.Height(),
+	HilbertSortWithKeys(refs, bounds, nil)
+}
+
+// hilbertKeySortable is an implementation of sort.Interface which sorts
+// feature references by precomputed Hilbert curve indices. It allows us
+// to use the reflection-free, hence slightly more performant, sort.Sort
+// function instead of sort.Slice, while only computing each Hilbert
+// index once.
+type hilbertKeySortable struct {
+	refs []Ref
+	keys []uint32
+}
+
+func (hks *hilbertKeySortable) Len() int {
+	return len(hks.refs)
+}
+
+func (hks *hilbertKeySortable) Less(i, j int) bool {
+	return hks.keys[i] > hks.keys[j]
+}
+
+func (hks *hilbertKeySortable) Swap(i, j int) {
+	hks.refs[i], hks.refs[j] = hks.refs[j], hks.refs[i]
+	hks.keys[i], hks.keys[j] = hks.keys[j], hks.keys[i]
+}
+
+// HilbertSortWithKeys sorts a list of feature references in exactly the
+// same way as HilbertSort, producing identical output, but lets the
+// caller supply the scratch space used to hold the Hilbert curve index
+// of each reference.
+//
+// The keys parameter is scratch space for the Hilbert indices. If its
+// capacity is at least len(refs), it is used without allocating;
+// otherwise a new buffer is allocated. The buffer used is returned so
+// it can be passed to later calls, for example when building many
+// indices in a loop. Its contents on return are the Hilbert indices of
+// the sorted references, but should not otherwise be relied on.
+func HilbertSortWithKeys(refs []Ref, bounds Box, keys []uint32) []uint32 {
+	if cap(keys) < len(refs) {
+		keys = make([]uint32, len(refs))
+	}
+	keys = keys[:len(refs)]
+	x, y, w, h := bounds.XMin, bounds.YMin, bounds.Width(), bounds.Height()
+	for i := range refs {
+		keys[i] = hilbertOfCenter(&refs[i].Box, x, y, w, h)
 	}
-	sort.Sort(&hs)
+	hks := hilbertKeySortable{refs: refs, keys: keys}
+	sort.Sort(&hks)
+	return keys
 }
 
 // hilbertOfCenter calculates the Hilbert curve index of the center
@@ -80,17 +100,39 @@ func HilbertSort(refs []Ref, bounds Box) {
 //     required and the smaller data size may theoretically result in
 //     memory/bandwidth/cache benefits at the CPU levelRange, maybe.
 func hilbertOfCenter(b *Box, ex, ey, ew, eh float64) uint32 {
-	var hx uint32 // Hilbert X-coordinate between 0 and hilbertMax
+	return hilbertOfXY(scaleCenter(b, ex, ey, ew, eh))
+}
+
+// scaleCenter scales the center coordinate of a Box, in the context of
+// a set of boxes bounded by the rectangle (ex, ey, ex+ew, ey+eh), to
+// integer X- and Y-coordinates between 0 and hilbertMax, suitable for
+// input to a space-filling curve function.
+func scaleCenter(b *Box, ex, ey, ew, eh float64) (x, y uint32) {
 	if ew != 0.0 {
-		rx := (b.midX() - ex) / ew
-		hx = uint32(math.Floor(hilbertMax * rx))
+		rx := clampUnit((b.midX() - ex) / ew)
+		x = uint32(math.Floor(hilbertMax * rx))
 	}
-	var hy uint32 // Hilbert Y-coordinate between 0 and hilbertMax
 	if eh != 0.0 {
-		ry := (b.midY() - ey) / eh
-		hy = uint32(math.Floor(hilbertMax * ry))
+		ry := clampUnit((b.midY() - ey) / eh)
+		y = uint32(math.Floor(hilbertMax * ry))
+	}
+	return
+}
+
+// clampUnit clamps a ratio to the closed interval [0, 1].
+//
+// A Box's center should always lie within the enclosing rectangle, but
+// floating point error, or a caller passing bounds that don't fully
+// enclose every Box, can produce a ratio slightly outside the unit
+// interval. Without clamping, the subsequent conversion to uint32 would
+// be out of range.
+func clampUnit(r float64) float64 {
+	if r < 0.0 {
+		return 0.0
+	} else if r > 1.0 {
+		return 1.0
 	}
-	return hilbertOfXY(hx, hy)
+	return r
 }
 
 // hilbertOfXY calculates the Hilbert curve index of a given
@@ -7,6 +7,7 @@ package packedrtree
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"sort"
 	"testing"
 
@@ -53,6 +54,32 @@ func init() {
 	}
 }
 
+// hilbertSortable is a comparison-based implementation of
+// sort.Interface which computes the Hilbert curve indices of the two
+// references on every comparison. It is the reference definition of the
+// sort order which HilbertSort must reproduce.
+type hilbertSortable struct {
+	refs       []Ref
+	x, y, w, h float64
+}
+
+func (hs *hilbertSortable) Len() int {
+	return len(hs.refs)
+}
+
+func (hs *hilbertSortable) Less(i, j int) bool {
+	a := hilbertOfCenter(&hs.refs[i].Box, hs.x, hs.y, hs.w, hs.h)
+	b := hilbertOfCenter(&hs.refs[j].Box, hs.x, hs.y, hs.w, hs.h)
+	// All reference implementations of FlatGeobuf use '>' to sort in
+	// descending order of Hilbert number.
+	//     https://github.com/flatgeobuf/flatgeobuf/discussions/271
+	return a > b
+}
+
+func (hs *hilbertSortable) Swap(i, j int) {
+	hs.refs[i], hs.refs[j] = hs.refs[j], hs.refs[i]
+}
+
 func TestHilbertSortable_Len(t *testing.T) {
 	t.Run("Zero", func(t *testing.T) {
 		var zero hilbertSortable
@@ -196,6 +223,96 @@ func TestHilbertSort(t *testing.T) {
 	})
 }
 
+func TestHilbertSortWithKeys(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		keys := HilbertSortWithKeys(nil, EmptyBox, nil)
+
+		assert.Empty(t, keys)
+	})
+
+	for _, n := range []int{1, 2, 10, 100, 5000} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			refs, bounds := randomRefs(n, 1)
+			// Duplicate some boxes to ensure ties are ordered the same.
+			for i := 0; i+1 < n; i += 7 {
+				refs[i+1].Box = refs[i].Box
+			}
+			expected := make([]Ref, n)
+			copy(expected, refs)
+			sort.Sort(&hilbertSortable{refs: expected, x: bounds.XMin, y: bounds.YMin, w: bounds.Width(), h: bounds.Height()})
+			actual := make([]Ref, n)
+			copy(actual, refs)
+			HilbertSort(actual, bounds)
+
+			keys := HilbertSortWithKeys(refs, bounds, nil)
+
+			assert.Equal(t, expected, refs)
+			assert.Equal(t, expected, actual)
+			assert.Len(t, keys, n)
+		})
+	}
+
+	t.Run("ReuseKeys", func(t *testing.T) {
+		refs, bounds := randomRefs(50, 2)
+		expected := make([]Ref, len(refs))
+		copy(expected, refs)
+		HilbertSort(expected, bounds)
+		buf := make([]uint32, 10, 100)
+
+		keys := HilbertSortWithKeys(refs, bounds, buf)
+
+		assert.Equal(t, expected, refs)
+		assert.Len(t, keys, 50)
+		assert.Same(t, &buf[0], &keys[0])
+	})
+}
+
+// randomRefs returns n feature references with random boxes, together
+// with their overall bounds.
+func randomRefs(n int, seed int64) ([]Ref, Box) {
+	rnd := rand.New(rand.NewSource(seed))
+	refs := make([]Ref, n)
+	bounds := EmptyBox
+	for i := range refs {
+		x, y := rnd.Float64()*360-180, rnd.Float64()*180-90
+		refs[i] = Ref{
+			Box:    Box{XMin: x, YMin: y, XMax: x + rnd.Float64(), YMax: y + rnd.Float64()},
+			Offset: int64(i),
+		}
+		bounds.Expand(&refs[i].Box)
+	}
+	return refs, bounds
+}
+
+func BenchmarkHilbertSort(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		refs, bounds := randomRefs(n, 3)
+		scratch := make([]Ref, n)
+
+		b.Run(fmt.Sprintf("Comparison/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(scratch, refs)
+				sort.Sort(&hilbertSortable{refs: scratch, x: bounds.XMin, y: bounds.YMin, w: bounds.Width(), h: bounds.Height()})
+			}
+		})
+
+		b.Run(fmt.Sprintf("HilbertSort/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(scratch, refs)
+				HilbertSort(scratch, bounds)
+			}
+		})
+
+		b.Run(fmt.Sprintf("HilbertSortWithKeys/n=%d", n), func(b *testing.B) {
+			var keys []uint32
+			for i := 0; i < b.N; i++ {
+				copy(scratch, refs)
+				keys = HilbertSortWithKeys(scratch, bounds, keys)
+			}
+		})
+	}
+}
+
 func TestHilbertOfCenter(t *testing.T) {
 	t.Run("ZeroWidth", func(t *testing.T) {
 		actual := hilbertOfCenter(&Box{0, 0, 0, 0}, 0, 0, 0, 10)
@@ -217,6 +334,27 @@ func TestHilbertOfCenter(t *testing.T) {
 			hi = hj
 		}
 	})
+
+	t.Run("CenterOutsideBounds", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			b        Box
+			expected uint32
+		}{
+			{"MarginallyBelowMin", Box{-1e-9, -1e-9, -1e-9, -1e-9}, hilbertOfXY(0, 0)},
+			{"MarginallyBelowMinX", Box{-1e-9, 5, -1e-9, 5}, hilbertOfXY(0, hilbertMax/2)},
+			{"MarginallyAboveMax", Box{10 + 1e-9, 10 + 1e-9, 10 + 1e-9, 10 + 1e-9}, hilbertOfXY(hilbertMax, hilbertMax)},
+			{"FarAboveMaxY", Box{0, 15, 0, 15}, hilbertOfXY(0, hilbertMax)},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				actual := hilbertOfCenter(&testCase.b, 0, 0, 10, 10)
+
+				assert.Equal(t, testCase.expected, actual)
+			})
+		}
+	})
 }
 
 func TestHilbertOfXY(t *testing.T) {
@@ -0,0 +1,76 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package packedrtree
+
+import "sort"
+
+// mortonKeySortable is an implementation of sort.Interface which sorts
+// feature references by precomputed Morton codes, so that each code is
+// only computed once.
+type mortonKeySortable struct {
+	refs []Ref
+	keys []uint32
+}
+
+func (mks *mortonKeySortable) Len() int {
+	return len(mks.refs)
+}
+
+func (mks *mortonKeySortable) Less(i, j int) bool {
+	return mks.keys[i] < mks.keys[j]
+}
+
+func (mks *mortonKeySortable) Swap(i, j int) {
+	mks.refs[i], mks.refs[j] = mks.refs[j], mks.refs[i]
+	mks.keys[i], mks.keys[j] = mks.keys[j], mks.keys[i]
+}
+
+// MortonSort sorts a list of feature references, whose overall bounding
+// box is given by bounds, in ascending order of position on a Morton
+// (Z-order) curve with the same resolution as the Hilbert curve used by
+// HilbertSort.
+//
+// A Morton curve has worse locality than a Hilbert curve, so a
+// PackedRTree built from Morton-sorted references generally has more
+// overlap between nodes. However, it is simpler to compute and can be
+// competitive for queries using small, axis-aligned windows.
+//
+// The Morton code of each reference is computed once, before sorting,
+// using O(n) extra memory. The sort algorithm is not guaranteed to be
+// stable.
+func MortonSort(refs []Ref, bounds Box) {
+	keys := make([]uint32, len(refs))
+	x, y, w, h := bounds.XMin, bounds.YMin, bounds.Width(), bounds.Height()
+	for i := range refs {
+		keys[i] = mortonOfCenter(&refs[i].Box, x, y, w, h)
+	}
+	mks := mortonKeySortable{refs: refs, keys: keys}
+	sort.Sort(&mks)
+}
+
+// mortonOfCenter calculates the Morton code of the center coordinate of
+// a Box in the context of a set of boxes bounded by the rectangle
+// (ex, ey, ex+ew, ey+eh).
+func mortonOfCenter(b *Box, ex, ey, ew, eh float64) uint32 {
+	return mortonOfXY(scaleCenter(b, ex, ey, ew, eh))
+}
+
+// mortonOfXY calculates the Morton code of a given two-dimensional
+// coordinate by interleaving the low 16 bits of x and y, with the bits
+// of x in the even positions.
+func mortonOfXY(x, y uint32) uint32 {
+	return spreadBits(x) | spreadBits(y)<<1
+}
+
+// spreadBits spreads the low 16 bits of v out so that they occupy the
+// even bit positions of the result.
+func spreadBits(v uint32) uint32 {
+	v &= 0x0000FFFF
+	v = (v | (v << 8)) & 0x00FF00FF
+	v = (v | (v << 4)) & 0x0F0F0F0F
+	v = (v | (v << 2)) & 0x33333333
+	v = (v | (v << 1)) & 0x55555555
+	return v
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package packedrtree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMortonSort(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		var refs []Ref
+		var bounds Box
+
+		MortonSort(refs, bounds)
+	})
+
+	t.Run("Quadrants", func(t *testing.T) {
+		refs := []Ref{
+			{Box: Box{8, 8, 10, 10}, Offset: 3},     // Top right.
+			{Box: Box{-10, 8, -8, 10}, Offset: 2},   // Top left.
+			{Box: Box{8, -10, 10, -8}, Offset: 1},   // Bottom right.
+			{Box: Box{-10, -10, -8, -8}, Offset: 0}, // Bottom left.
+		}
+		bounds := EmptyBox
+		for i := range refs {
+			bounds.Expand(&refs[i].Box)
+		}
+
+		MortonSort(refs, bounds)
+
+		isSorted := sort.SliceIsSorted(refs, func(i, j int) bool {
+			return refs[i].Offset < refs[j].Offset
+		})
+		assert.True(t, isSorted, "Slice should be sorted in Z-order, but is not: %v", refs)
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		r := rand.New(rand.NewSource(0))
+		refs := make([]Ref, 1000)
+		bounds := EmptyBox
+		for i := range refs {
+			x, y := r.Float64()*100, r.Float64()*100
+			refs[i] = Ref{Box: Box{x, y, x + r.Float64(), y + r.Float64()}, Offset: int64(i)}
+			bounds.Expand(&refs[i].Box)
+		}
+		w, h := bounds.Width(), bounds.Height()
+
+		MortonSort(refs, bounds)
+
+		isSorted := sort.SliceIsSorted(refs, func(i, j int) bool {
+			return mortonOfCenter(&refs[i].Box, bounds.XMin, bounds.YMin, w, h) < mortonOfCenter(&refs[j].Box, bounds.XMin, bounds.YMin, w, h)
+		})
+		assert.True(t, isSorted, "Slice should be sorted by Morton code, but is not")
+	})
+}
+
+func TestMortonOfXY(t *testing.T) {
+	testCases := []struct {
+		name     string
+		x, y     uint32
+		expected uint32
+	}{
+		{name: "Zero"},
+		{name: "OneX", x: 1, y: 0, expected: 1},
+		{name: "OneY", x: 0, y: 1, expected: 2},
+		{name: "OneXY", x: 1, y: 1, expected: 3},
+		{name: "TwoX", x: 2, y: 0, expected: 4},
+		{name: "MaxX", x: hilbertMax, y: 0, expected: 0x55555555},
+		{name: "MaxY", x: 0, y: hilbertMax, expected: 0xaaaaaaaa},
+		{name: "MaxXY", x: hilbertMax, y: hilbertMax, expected: 0xffffffff},
+		{name: "HighBitsIgnored", x: 0xffff0000, y: 0xffff0000, expected: 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := mortonOfXY(testCase.x, testCase.y)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestPackStrategy(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		assert.Equal(t, "Hilbert", Hilbert.String())
+		assert.Equal(t, "Morton", Morton.String())
+		assert.Equal(t, "PackStrategy(99)", PackStrategy(99).String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.PanicsWithValue(t, "packedrtree: invalid pack strategy -1", func() {
+			PackStrategy(-1).Sort(nil, EmptyBox)
+		})
+	})
+
+	for _, ps := range []PackStrategy{Hilbert, Morton} {
+		t.Run(ps.String(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(7))
+			refs := make([]Ref, 500)
+			bounds := EmptyBox
+			for i := range refs {
+				x, y := rnd.Float64()*1000, rnd.Float64()*1000
+				refs[i] = Ref{
+					Box:    Box{XMin: x, YMin: y, XMax: x + rnd.Float64()*20, YMax: y + rnd.Float64()*20},
+					Offset: int64(i),
+				}
+				bounds.Expand(&refs[i].Box)
+			}
+			sorted := make([]Ref, len(refs))
+			copy(sorted, refs)
+
+			ps.Sort(sorted, bounds)
+			prt, err := New(sorted, 8)
+
+			require.NoError(t, err)
+			for k := 0; k < 50; k++ {
+				x, y := rnd.Float64()*1000, rnd.Float64()*1000
+				q := Box{XMin: x, YMin: y, XMax: x + rnd.Float64()*100, YMax: y + rnd.Float64()*100}
+				t.Run(fmt.Sprintf("query=%d", k), func(t *testing.T) {
+					var expected []int64
+					for i := range refs {
+						if refs[i].intersects(&q) {
+							expected = append(expected, refs[i].Offset)
+						}
+					}
+					var actual []int64
+					for _, r := range prt.Search(q) {
+						actual = append(actual, r.Offset)
+					}
+
+					assert.ElementsMatch(t, expected, actual)
+				})
+			}
+		})
+	}
+}
@@ -7,8 +7,10 @@ package packedrtree
 import (
 	"container/heap"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math"
+	"sort"
 	"unsafe"
 )
 
@@ -318,13 +320,120 @@ func (rs Results) Swap(i, j int) {
 	rs[i], rs[j] = rs[j], rs[i]
 }
 
+// Intersect returns the results in rs whose Offset also appears in
+// other. It can be used to combine the results of two searches with a
+// logical AND, for example to find the features matching two query
+// boxes.
+//
+// Both rs and other must be sorted in ascending order of Offset, as
+// they are when returned from Seek or after sorting with sort.Sort.
+// The returned Results are also sorted by Offset. Results are taken
+// from rs, so if the two sets came from different indices, the
+// RefIndex values are those of rs.
+func (rs Results) Intersect(other Results) Results {
+	r := make(Results, 0)
+	var i, j int
+	for i < len(rs) && j < len(other) {
+		if rs[i].Offset < other[j].Offset {
+			i++
+		} else if rs[i].Offset > other[j].Offset {
+			j++
+		} else {
+			r = append(r, rs[i])
+			i++
+			j++
+		}
+	}
+	return r
+}
+
+// MergeSorted merges rs and other into a single Results slice sorted
+// in ascending order of Offset, containing each distinct Offset only
+// once. It can be used to combine the results of two searches with a
+// logical OR, or to merge the results of searches against several
+// sub-indices whose offsets have been rebased into a common range.
+//
+// Both rs and other must be sorted in ascending order of Offset. Where
+// the same Offset appears more than once, the first Result having that
+// Offset is kept, with results from rs taking precedence over results
+// from other. Neither input slice is modified.
+func (rs Results) MergeSorted(other Results) Results {
+	r := make(Results, 0, len(rs)+len(other))
+	add := func(x Result) {
+		if len(r) == 0 || r[len(r)-1].Offset != x.Offset {
+			r = append(r, x)
+		}
+	}
+	var i, j int
+	for i < len(rs) && j < len(other) {
+		if rs[i].Offset <= other[j].Offset {
+			add(rs[i])
+			i++
+		} else {
+			add(other[j])
+			j++
+		}
+	}
+	for ; i < len(rs); i++ {
+		add(rs[i])
+	}
+	for ; j < len(other); j++ {
+		add(other[j])
+	}
+	return r
+}
+
+// RefIndexRanges returns the RefIndex values of rs as a list of
+// contiguous half-open ranges [start, end), in ascending order. Each
+// range covers a run of consecutive RefIndex values present in rs, and
+// duplicate RefIndex values are counted once.
+//
+// If working with FlatGeobuf, and the data section was written in index
+// order, each range identifies a run of consecutive features which can
+// be read with a single batched read. rs need not be sorted, and is not
+// modified.
+func (rs Results) RefIndexRanges() [][2]int {
+	if len(rs) == 0 {
+		return nil
+	}
+	indices := make([]int, len(rs))
+	for i := range rs {
+		indices[i] = rs[i].RefIndex
+	}
+	sort.Ints(indices)
+	ranges := [][2]int{{indices[0], indices[0] + 1}}
+	for _, i := range indices[1:] {
+		last := &ranges[len(ranges)-1]
+		if i == last[1] {
+			last[1]++
+		} else if i > last[1] {
+			ranges = append(ranges, [2]int{i, i + 1})
+		}
+	}
+	return ranges
+}
+
 // search implements a generic Hilbert R-Tree search function which is
 // capable of streaming search depending on the callback functions
 // configured in prt.
 func (prt *packedRTree) search(b Box) (Results, error) {
+	r := make(Results, 0)
+	err := prt.visit(b, func(res Result) bool {
+		r = append(r, res)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// visit traverses the Hilbert R-Tree, calling f for each qualified
+// match whose bounding rectangle intersects the query box. The
+// traversal stops early if f returns false.
+func (prt *packedRTree) visit(b Box, f func(Result) bool) error {
 	q := make(ticketBag, 1, 32)
 	q[0] = ticket{nodeIndex: 0, level: len(prt.levels) - 1}
-	r := make(Results, 0)
 
 	for {
 		// Pop the next work ticket from the front of queue.
@@ -340,7 +449,7 @@ func (prt *packedRTree) search(b Box) (Results, error) {
 		if prt.fetch != nil {
 			err := prt.fetch(t.nodeIndex, end, prt.nodes)
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 		// Search the nodes.
@@ -349,14 +458,16 @@ func (prt *packedRTree) search(b Box) (Results, error) {
 			if !b.intersects(&n.Box) {
 				continue
 			} else if isLeafLevel {
-				r = append(r, Result{Offset: n.Offset, RefIndex: pos - prt.levels[0].start})
+				if !f(Result{Offset: n.Offset, RefIndex: pos - prt.levels[0].start}) {
+					return nil
+				}
 			} else {
 				prt.push(&q, ticket{nodeIndex: int(n.Offset), level: t.level - 1})
 			}
 		}
 		// Stop and return if there is no remaining work.
 		if len(q) == 0 {
-			return r, nil
+			return nil
 		}
 	}
 }
@@ -374,12 +485,58 @@ type PackedRTree struct {
 // Use HilbertSort to sort the feature references. If the input slice is
 // not Hilbert-sorted, the behavior of the new PackedRTree is undefined.
 func New(refs []Ref, nodeSize uint16) (*PackedRTree, error) {
+	prt := &PackedRTree{}
+	if err := prt.Rebuild(refs, nodeSize); err != nil {
+		return nil, err
+	}
+	return prt, nil
+}
+
+// Reset empties the packed Hilbert R-Tree so that its memory can be
+// reused by a future build, reducing garbage collection pressure when
+// many transient trees are built. The capacity of the node storage is
+// retained.
+//
+// After Reset, the tree contains no nodes and must not be searched,
+// marshalled, or otherwise used until it has been rebuilt with Rebuild.
+func (prt *PackedRTree) Reset() {
+	prt.numRefs = 0
+	prt.nodeSize = 0
+	prt.levels = nil
+	prt.nodes = prt.nodes[:0]
+}
+
+// Rebuild builds the packed Hilbert R-Tree from a non-empty,
+// Hilbert-sorted list of feature references and a given R-Tree node
+// size, replacing its previous contents. The existing node storage is
+// reused if it has enough capacity, so a tree which is Reset and then
+// rebuilt avoids allocating new storage. Like New, panics if the
+// reference list is empty or node size is less than 2.
+//
+// If Rebuild returns an error, the tree's previous contents are left
+// unchanged.
+func (prt *PackedRTree) Rebuild(refs []Ref, nodeSize uint16) error {
 	// Validate parameters.
 	if _, err := Size(len(refs), nodeSize); err != nil {
-		return nil, err
+		return err
+	}
+	// Initialize the private, non-exported data structure, reusing the
+	// existing node storage if possible.
+	levels := levelify(uint(len(refs)), uint(nodeSize))
+	nodes := prt.nodes[:0]
+	if cap(nodes) >= levels[0].end {
+		nodes = nodes[:levels[0].end]
+	} else {
+		nodes = make([]node, levels[0].end)
+	}
+	prt.packedRTree = packedRTree{
+		numRefs:  len(refs),
+		nodeSize: int(nodeSize),
+		levels:   levels,
+		nodes:    nodes,
+		push:     stackPush,
+		pop:      stackPop,
 	}
-	// Create the private, non-exported data structure.
-	prt := noo(len(refs), nodeSize, stackPush, stackPop, nil)
 	// Save copies of the leaf nodes.
 	i := prt.levels[0].start
 	for j := range refs {
@@ -410,8 +567,7 @@ func New(refs []Ref, nodeSize uint16) (*PackedRTree, error) {
 			}
 		}
 	}
-	// Return the exported data structure.
-	return &PackedRTree{prt}, nil
+	return nil
 }
 
 // Bounds returns the bounding box around all features referenced by the
@@ -431,6 +587,59 @@ func (prt *PackedRTree) NodeSize() uint16 {
 	return uint16(prt.nodeSize)
 }
 
+// NumLevels returns the number of levels in the packed Hilbert R-Tree.
+// Level 0 is the leaf level, containing one node for each feature
+// reference, and level NumLevels()-1 is the root level, containing
+// exactly one node.
+func (prt *PackedRTree) NumLevels() int {
+	return len(prt.levels)
+}
+
+// LevelLen returns the number of nodes in a level of the packed Hilbert
+// R-Tree. It panics if the level is out of range.
+func (prt *PackedRTree) LevelLen(level int) int {
+	prt.validateLevel(level)
+	return prt.levels[level].end - prt.levels[level].start
+}
+
+// Node returns the node at index i within a level of the packed Hilbert
+// R-Tree, allowing custom traversals of the tree structure. Levels are
+// numbered as described in NumLevels, and i must be in the range
+// [0, LevelLen(level)). Node panics if either argument is out of range.
+//
+// The box return value is the node's bounding box. If the node is a
+// leaf, isLeaf is true and childOrOffset is the Offset of the feature
+// Ref stored in the leaf. Otherwise, isLeaf is false and childOrOffset
+// is the index, within level-1, of the node's first child. A node's
+// children are contiguous, and there are at most NodeSize() of them.
+//
+// For example, the following code visits the children of the root:
+//
+//	root := prt.NumLevels() - 1
+//	_, first, _ := prt.Node(root, 0)
+//	for i := int(first); i < prt.LevelLen(root-1) && i < int(first)+int(prt.NodeSize()); i++ {
+//		box, _, _ := prt.Node(root-1, i)
+//		// Use box.
+//	}
+func (prt *PackedRTree) Node(level, i int) (box Box, childOrOffset int64, isLeaf bool) {
+	prt.validateLevel(level)
+	r := prt.levels[level]
+	if i < 0 || i >= r.end-r.start {
+		fmtPanic("node index %d out of range for level %d (%d nodes)", i, level, r.end-r.start)
+	}
+	n := &prt.nodes[r.start+i]
+	if level == 0 {
+		return n.Box, n.Offset, true
+	}
+	return n.Box, n.Offset - int64(prt.levels[level-1].start), false
+}
+
+func (prt *PackedRTree) validateLevel(level int) {
+	if level < 0 || level >= len(prt.levels) {
+		fmtPanic("level %d out of range (%d levels)", level, len(prt.levels))
+	}
+}
+
 // String returns a summary description of the packed Hilbert R-Tree.
 func (prt *PackedRTree) String() string {
 	return fmt.Sprintf("PackedRTree{Bounds:%s,NumRefs:%d,NodeSize:%d}", prt.Bounds(), prt.numRefs, prt.nodeSize)
@@ -450,6 +659,164 @@ func (prt *PackedRTree) Search(b Box) Results {
 	return r
 }
 
+// SearchMask searches the packed Hilbert R-Tree in the same way as
+// Search, but returns the matches as a bitset over the feature
+// reference indices instead of a list of results. Bit i of the mask,
+// which is bit i%64 of element i/64, is set if and only if the Ref at
+// RefIndex i is a match. The mask has exactly enough elements to hold
+// one bit per Ref, and the unused high bits of the last element are
+// always zero.
+//
+// Since masks returned from the same PackedRTree all have the same
+// length, compound queries can be evaluated by combining masks with
+// bitwise operators, for example using AND to find the references
+// matching every one of several query boxes.
+func (prt *PackedRTree) SearchMask(b Box) []uint64 {
+	mask := make([]uint64, (prt.numRefs+63)/64)
+	for _, r := range prt.Search(b) {
+		mask[r.RefIndex/64] |= 1 << (uint(r.RefIndex) % 64)
+	}
+	return mask
+}
+
+// ContainsOffset reports whether the packed Hilbert R-Tree contains a
+// feature reference with the given offset whose bounding rectangle
+// intersects the query box. It is equivalent to searching for the box
+// and checking whether any result has the offset, except that the search
+// stops as soon as a matching reference is found and no result list is
+// allocated.
+//
+// If working with FlatGeobuf, ContainsOffset can be used to check
+// whether a specific feature, identified by its byte offset in the data
+// section, matches a query.
+func (prt *PackedRTree) ContainsOffset(b Box, offset int64) bool {
+	var found bool
+	err := prt.visit(b, func(r Result) bool {
+		found = r.Offset == offset
+		return !found
+	})
+	if err != nil {
+		panic(err) // prt.visit should never return error in this case.
+	}
+	return found
+}
+
+// SubTree builds a new packed Hilbert R-Tree over just the feature
+// references whose bounding rectangles intersect the query box. The
+// matching references keep their bounding boxes and offsets, are
+// Hilbert-sorted within their own bounds, and are packed using the
+// same node size as the receiver. It can be used, for example, to
+// derive a small per-tile index from a master index.
+//
+// Searching the subtree for a box returns a subset of the results of
+// searching the receiver for the same box, with identical offsets, but
+// the RefIndex values refer to positions within the subtree. If no
+// reference intersects the query box, the returned tree is nil.
+func (prt *PackedRTree) SubTree(b Box) (*PackedRTree, error) {
+	var refs []Ref
+	bounds := EmptyBox
+	err := prt.visit(b, func(r Result) bool {
+		ref := Ref{Box: prt.nodes[prt.levels[0].start+r.RefIndex].Box, Offset: r.Offset}
+		refs = append(refs, ref)
+		bounds.Expand(&ref.Box)
+		return true
+	})
+	if err != nil {
+		panic(err) // prt.visit should never return error in this case.
+	} else if len(refs) == 0 {
+		return nil, nil
+	}
+	HilbertSort(refs, bounds)
+	return New(refs, prt.NodeSize())
+}
+
+// estimateDepth is the number of levels below the root that
+// EstimateMatches descends before extrapolating.
+const estimateDepth = 2
+
+// EstimateMatches returns an approximate count of the feature references
+// whose bounding boxes intersect the query box, without running a full
+// search. It is intended for query planning, where a cheap estimate of
+// a query's selectivity is more useful than an exact answer.
+//
+// The estimate is computed by descending only the top few levels of the
+// tree. For each internal node at the lowest level visited that
+// intersects the query box, the number of feature references below the
+// node is scaled by the fraction of the node's area covered by the query
+// box, on the assumption that the references are evenly distributed
+// within the node. The query box is first grown slightly to allow for
+// the size of the feature bounding boxes themselves. The result is an
+// estimate only, and may be higher or lower than the number of results
+// Search would return. It is exact when the query box contains the
+// bounds of the whole tree.
+func (prt *PackedRTree) EstimateMatches(b Box) int {
+	root := len(prt.levels) - 1
+	stop := root - estimateDepth
+	if stop < 1 {
+		stop = 1
+	}
+	if root < stop {
+		stop = root
+	}
+	return int(math.Round(prt.estimate(b, root, 0, stop)))
+}
+
+// estimate is a recursive helper for EstimateMatches which estimates
+// the number of matches below the node at index i within a level.
+func (prt *PackedRTree) estimate(b Box, level, i, stop int) float64 {
+	n := &prt.nodes[prt.levels[level].start+i]
+	if !b.intersects(&n.Box) {
+		return 0
+	}
+	if level > stop {
+		first := int(n.Offset) - prt.levels[level-1].start
+		last := first + prt.nodeSize
+		if m := prt.levels[level-1].end - prt.levels[level-1].start; last > m {
+			last = m
+		}
+		var sum float64
+		for j := first; j < last; j++ {
+			sum += prt.estimate(b, level-1, j, stop)
+		}
+		return sum
+	}
+	// Number of leaves below this node. Since the tree is packed, each
+	// node at this level covers nodeSize^level leaves, except possibly
+	// the last node.
+	span := 1
+	for k := 0; k < level; k++ {
+		span *= prt.nodeSize
+	}
+	lo := i * span
+	hi := lo + span
+	if hi > prt.numRefs {
+		hi = prt.numRefs
+	}
+	// Features are not points: a feature matches if its box intersects
+	// the query box, not only if its box is inside it. To account for
+	// this, grow the query box by half the typical size of a feature
+	// box, assuming the feature boxes tile the node's box.
+	k := float64(hi - lo)
+	gx := n.Width() / math.Sqrt(k) / 2
+	gy := n.Height() / math.Sqrt(k) / 2
+	g := Box{XMin: b.XMin - gx, YMin: b.YMin - gy, XMax: b.XMax + gx, YMax: b.YMax + gy}
+	return overlapFraction(&n.Box, &g) * k
+}
+
+// overlapFraction returns the fraction of the area of box a which is
+// covered by box b, assuming the two boxes intersect. A dimension in
+// which a has zero extent counts as fully covered.
+func overlapFraction(a, b *Box) float64 {
+	f := 1.0
+	if w := a.Width(); w > 0 {
+		f *= math.Max(0, math.Min(a.XMax, b.XMax)-math.Max(a.XMin, b.XMin)) / w
+	}
+	if h := a.Height(); h > 0 {
+		f *= math.Max(0, math.Min(a.YMax, b.YMax)-math.Max(a.YMin, b.YMin)) / h
+	}
+	return f
+}
+
 // Marshal serializes the packed Hilbert R-Tree as a FlatGeobuf index
 // section. It returns the number of bytes written.
 //
@@ -467,6 +834,41 @@ func (prt *PackedRTree) Marshal(w io.Writer) (n int, err error) {
 	return
 }
 
+// MarshalLeaves serializes only the leaf nodes of the packed Hilbert
+// R-Tree, which are the feature references in index order, using the
+// same little-endian node format as Marshal. It returns the number of
+// bytes written, which is always 40 times NumRefs.
+//
+// The output is the same as the final 40*NumRefs bytes written by
+// Marshal, so external tools can read the feature references without
+// having to compute the size of the non-leaf levels of the tree. Each
+// node consists of the XMin, YMin, XMax, and YMax coordinates of the
+// bounding box, as float64 values, followed by the offset, as an int64.
+func (prt *PackedRTree) MarshalLeaves(w io.Writer) (n int, err error) {
+	if w == nil {
+		textPanic("nil writer")
+	}
+	leaves := prt.nodes[len(prt.nodes)-prt.numRefs:]
+	ptr := (*byte)(unsafe.Pointer(&leaves[0]))
+	src := unsafe.Slice(ptr, numNodeBytes*len(leaves))
+	n, err = writeLittleEndianOctets(w, src)
+	return
+}
+
+// Checksum returns a 64-bit FNV-1a hash of the packed Hilbert R-Tree's
+// serialized form, as written by Marshal. Since the serialized form is
+// always little-endian, the checksum is the same on every platform, and
+// it equals the FNV-1a hash of the index section of a FlatGeobuf file
+// containing the tree. It can be stored alongside an index to detect
+// later corruption.
+func (prt *PackedRTree) Checksum() uint64 {
+	h := fnv.New64a()
+	if _, err := prt.Marshal(h); err != nil {
+		panic(err) // Hash writes never return an error.
+	}
+	return h.Sum64()
+}
+
 // Unmarshal deserializes a stream from the FlatGeobuf index section
 // format, returning the in-memory search tree built from the stream.
 //
@@ -509,6 +911,28 @@ func Unmarshal(r io.Reader, numRefs int, nodeSize uint16) (*PackedRTree, error)
 	return &PackedRTree{packedRTree: prt}, nil
 }
 
+// BoundsFromReader reads the root node from a stream in the FlatGeobuf
+// index section format and returns its bounding box. Since the root
+// node covers every other node, this is the bounding box of the whole
+// index, and is the same as the result of Bounds for the unmarshalled
+// index, but reading it is far cheaper than unmarshalling the index.
+//
+// The root node is the first node in the serialized index, so if you
+// are reading from a FlatGeobuf file, the reader should be positioned
+// ready to read the first byte of the index section. BoundsFromReader
+// consumes exactly one serialized node, which is 40 bytes, from the
+// reader.
+func BoundsFromReader(r io.Reader) (Box, error) {
+	if r == nil {
+		textPanic("nil reader")
+	}
+	nodes := make([]node, 1)
+	if err := readLittleEndianNodes(r, 0, 1, nodes); err != nil {
+		return Box{}, wrapErr("failed to read root node", err)
+	}
+	return nodes[0].Box, nil
+}
+
 // Seek searches the serialized representation of a packed Hilbert
 // R-Tree index directly, from a seekable stream, without needing to
 // Unmarshal the index into an in-memory data structure.
@@ -533,18 +957,131 @@ func Seek(rs io.ReadSeeker, numRefs int, nodeSize uint16, b Box) (Results, error
 		return nil, wrapErr("failed to cache index start offset", err)
 	}
 
-	// Calculate the end offset of the index and check for integer
-	// overflow.
+	// Calculate the size of the index.
 	sz, err := Size(numRefs, nodeSize)
 	if err != nil {
 		return nil, err
-	} else if int64(sz) > math.MaxInt64-startOffset {
+	}
+
+	// Search the index.
+	return seek(rs, startOffset, numRefs, nodeSize, int64(sz), b)
+}
+
+// SeekWithSize is like Seek, but uses a caller-supplied index size,
+// typically obtained from an earlier call to Size, instead of computing
+// it. This avoids redundant work when the same serialized index is
+// searched repeatedly.
+//
+// The index size is trusted to be correct for numRefs and nodeSize. It
+// is only used to position the seekable reader at the end of the index
+// after the search, so if it is wrong, the search results are still
+// correct but the reader will be left in the wrong position. Panics if
+// indexSize is less than 1, and returns an error if the end offset of
+// the index overflows int64.
+func SeekWithSize(rs io.ReadSeeker, numRefs int, nodeSize uint16, indexSize int64, b Box) (Results, error) {
+	// Validate parameters.
+	if rs == nil {
+		textPanic("nil read seeker")
+	}
+	validateParams(numRefs, nodeSize)
+	if indexSize < 1 {
+		textPanic("index size must be at least 1")
+	}
+
+	// Cache the start offset of the index.
+	startOffset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, wrapErr("failed to cache index start offset", err)
+	}
+
+	// Search the index.
+	return seek(rs, startOffset, numRefs, nodeSize, indexSize, b)
+}
+
+// EstimateSeekCost returns an approximate number of index bytes which
+// Seek would read to search a serialized index with a given feature
+// reference count and node size for the query box b, where bounds is
+// the bounding box of the whole tree, for example as returned by
+// BoundsFromReader. It is intended for estimating the cost of a search
+// against a remote index before committing to it. Panics if numRefs is
+// less than 1 or nodeSize is less than 2.
+//
+// The estimate is a heuristic based only on the shape of the tree,
+// since none of the index is read. The nodes at each level are assumed
+// to be evenly sized square cells tiling bounds, so the number of nodes
+// at each level which intersect the query box is estimated from the
+// fraction of bounds the query box covers, grown by the size of one
+// cell. Each intersecting internal node causes all of its children to
+// be read. The actual cost may be higher or lower depending on how the
+// features are distributed. The root node is always read, so the
+// estimate is never less than the size of one node, and it never
+// exceeds the size of the whole index.
+func EstimateSeekCost(numRefs int, nodeSize uint16, b Box, bounds Box) int64 {
+	validateParams(numRefs, nodeSize)
+	levels := levelify(uint(numRefs), uint(nodeSize))
+
+	// The root node is always read.
+	fetched := 1
+	if b.intersects(&bounds) {
+		// Descend level by level, reading the children of each
+		// estimated intersecting node on the level above.
+		intersecting := 1
+		for level := len(levels) - 2; level >= 0; level-- {
+			m := levels[level].end - levels[level].start
+			n := intersecting * int(nodeSize)
+			if n > m {
+				n = m
+			}
+			fetched += n
+			cell := 1 / math.Sqrt(float64(m))
+			frac := coverFraction(b.XMin, b.XMax, bounds.XMin, bounds.XMax, cell) *
+				coverFraction(b.YMin, b.YMax, bounds.YMin, bounds.YMax, cell)
+			intersecting = int(math.Ceil(frac * float64(m)))
+			if intersecting < 1 {
+				intersecting = 1
+			} else if intersecting > n {
+				intersecting = n
+			}
+		}
+	}
+	return int64(fetched) * int64(numNodeBytes)
+}
+
+// coverFraction estimates the fraction of cells along one axis of the
+// range [lo, hi] which intersect the query range [qlo, qhi], where cell
+// is the length of each cell as a fraction of the range. If the range
+// is degenerate, every cell intersects.
+func coverFraction(qlo, qhi, lo, hi, cell float64) float64 {
+	if !(hi > lo) {
+		return 1
+	}
+	if qlo < lo {
+		qlo = lo
+	}
+	if qhi > hi {
+		qhi = hi
+	}
+	frac := (qhi-qlo)/(hi-lo) + cell
+	if frac > 1 {
+		frac = 1
+	}
+	return frac
+}
+
+// seek implements Seek and SeekWithSize given a validated read seeker,
+// the start offset of the index within it, feature reference count,
+// node size, and index size.
+func seek(rs io.ReadSeeker, startOffset int64, numRefs int, nodeSize uint16, sz int64, b Box) (Results, error) {
+	// Calculate the end offset of the index and check for integer
+	// overflow.
+	if sz > math.MaxInt64-startOffset {
 		return nil, textErr("index end offset overflows int64")
 	}
-	endOffset := startOffset + int64(sz)
+	endOffset := startOffset + sz
 
 	// Keep track of current offset.
 	offset := startOffset
+	var err error
 
 	// Define the fetch function for the search.
 	fetch := func(i, j int, nodes []node) error {
@@ -581,6 +1118,13 @@ func Seek(rs io.ReadSeeker, numRefs int, nodeSize uint16, b Box) (Results, error
 		return nil, err
 	}
 
+	// The results are in leaf order, which is only ascending order of
+	// offset if the data section was written in index order, so sort
+	// them if necessary.
+	if !sort.IsSorted(sr) {
+		sort.Sort(sr)
+	}
+
 	// Skip to the end of the index. This ensures that other code
 	// calling Seek, for e.g. flatgeobuf.Reader, can make reasonable
 	// assumptions about the read cursor after a successful search.
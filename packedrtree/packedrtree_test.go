@@ -6,7 +6,9 @@ package packedrtree
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math"
 	"math/rand"
@@ -406,6 +408,105 @@ func TestResults(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Intersect", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			a, b     Results
+			expected Results
+		}{
+			{"BothEmpty", Results{}, Results{}, Results{}},
+			{"LeftEmpty", Results{}, Results{{1, 0}}, Results{}},
+			{"RightEmpty", Results{{1, 0}}, Results{}, Results{}},
+			{"Disjoint", Results{{0, 0}, {2, 1}}, Results{{1, 5}, {3, 6}}, Results{}},
+			{"Identical", Results{{0, 0}, {10, 1}}, Results{{0, 0}, {10, 1}}, Results{{0, 0}, {10, 1}}},
+			{
+				name:     "Overlapping",
+				a:        Results{{0, 0}, {10, 3}, {20, 1}, {30, 2}, {50, 4}},
+				b:        Results{{10, 7}, {30, 8}, {40, 9}, {50, 6}, {60, 5}},
+				expected: Results{{10, 3}, {30, 2}, {50, 4}},
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				actual := testCase.a.Intersect(testCase.b)
+
+				assert.Equal(t, testCase.expected, actual)
+			})
+		}
+	})
+
+	t.Run("MergeSorted", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			a, b     Results
+			expected Results
+		}{
+			{"BothEmpty", Results{}, Results{}, Results{}},
+			{"LeftEmpty", Results{}, Results{{1, 0}}, Results{{1, 0}}},
+			{"RightEmpty", Results{{1, 0}}, Results{}, Results{{1, 0}}},
+			{
+				name:     "Disjoint",
+				a:        Results{{0, 0}, {2, 1}, {4, 2}},
+				b:        Results{{1, 5}, {3, 6}, {5, 7}, {6, 8}},
+				expected: Results{{0, 0}, {1, 5}, {2, 1}, {3, 6}, {4, 2}, {5, 7}, {6, 8}},
+			},
+			{
+				name:     "Overlapping",
+				a:        Results{{0, 0}, {10, 3}, {20, 1}, {30, 2}},
+				b:        Results{{10, 7}, {25, 8}, {30, 9}, {40, 6}},
+				expected: Results{{0, 0}, {10, 3}, {20, 1}, {25, 8}, {30, 2}, {40, 6}},
+			},
+			{
+				name:     "DuplicatesWithinInput",
+				a:        Results{{1, 0}, {1, 1}, {2, 2}},
+				b:        Results{{2, 3}, {2, 4}, {3, 5}},
+				expected: Results{{1, 0}, {2, 2}, {3, 5}},
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				a := append(Results{}, testCase.a...)
+				b := append(Results{}, testCase.b...)
+
+				actual := a.MergeSorted(b)
+
+				assert.Equal(t, testCase.expected, actual)
+				assert.Equal(t, testCase.a, a)
+				assert.Equal(t, testCase.b, b)
+			})
+		}
+	})
+
+	t.Run("RefIndexRanges", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			rs       Results
+			expected [][2]int
+		}{
+			{"Nil", nil, nil},
+			{"Empty", Results{}, nil},
+			{"One", Results{{100, 7}}, [][2]int{{7, 8}}},
+			{"OneRun", Results{{0, 0}, {10, 1}, {20, 2}}, [][2]int{{0, 3}}},
+			{"TwoRuns", Results{{0, 3}, {10, 4}, {20, 5}, {30, 9}, {40, 10}}, [][2]int{{3, 6}, {9, 11}}},
+			{"TwoRunsUnsorted", Results{{40, 10}, {10, 4}, {30, 9}, {0, 3}, {20, 5}}, [][2]int{{3, 6}, {9, 11}}},
+			{"Duplicates", Results{{0, 1}, {0, 1}, {10, 2}, {10, 2}, {30, 4}}, [][2]int{{1, 3}, {4, 5}}},
+			{"AllSingletons", Results{{0, 0}, {20, 2}, {40, 4}}, [][2]int{{0, 1}, {2, 3}, {4, 5}}},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				orig := append(Results{}, testCase.rs...)
+
+				actual := testCase.rs.RefIndexRanges()
+
+				assert.Equal(t, testCase.expected, actual)
+				assert.Equal(t, orig, append(Results{}, testCase.rs...), "input must not be modified")
+			})
+		}
+	})
 }
 
 func TestNew(t *testing.T) {
@@ -727,6 +828,425 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestPackedRTree_SearchMask(t *testing.T) {
+	for _, n := range []int{1, 63, 64, 65, 200} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			refs := make([]Ref, n)
+			for i := range refs {
+				x, y := float64(i%13), float64(i/13)
+				refs[i] = Ref{
+					Box:    Box{XMin: x, YMin: y, XMax: x + 0.5, YMax: y + 0.5},
+					Offset: int64(i),
+				}
+			}
+			prt, err := New(refs, 4)
+			require.NoError(t, err)
+			queries := []Box{
+				prt.Bounds(),
+				EmptyBox,
+				{XMin: 2, YMin: 0, XMax: 5, YMax: 3},
+				{XMin: 12.25, YMin: -1, XMax: 20, YMax: 20},
+				{XMin: 100, YMin: 100, XMax: 101, YMax: 101},
+			}
+
+			for _, q := range queries {
+				t.Run(q.String(), func(t *testing.T) {
+					mask := prt.SearchMask(q)
+
+					require.Len(t, mask, (n+63)/64)
+					expected := make([]bool, n)
+					for _, r := range prt.Search(q) {
+						expected[r.RefIndex] = true
+					}
+					for i := 0; i < 64*len(mask); i++ {
+						actual := mask[i/64]&(1<<(i%64)) != 0
+						if i < n {
+							assert.Equal(t, expected[i], actual, "bit %d", i)
+						} else {
+							assert.False(t, actual, "unused bit %d", i)
+						}
+					}
+				})
+			}
+		})
+	}
+
+	t.Run("Combine", func(t *testing.T) {
+		refs := []Ref{
+			{Box: Box{XMin: 0, YMin: 0, XMax: 1, YMax: 1}},
+			{Box: Box{XMin: 2, YMin: 2, XMax: 3, YMax: 3}},
+			{Box: Box{XMin: 4, YMin: 4, XMax: 5, YMax: 5}},
+		}
+		prt, err := New(refs, 2)
+		require.NoError(t, err)
+		a := prt.SearchMask(Box{XMin: 0, YMin: 0, XMax: 2.5, YMax: 2.5})
+		b := prt.SearchMask(Box{XMin: 2.5, YMin: 2.5, XMax: 5, YMax: 5})
+
+		require.Len(t, a, 1)
+		require.Len(t, b, 1)
+		assert.Equal(t, uint64(0b010), a[0]&b[0])
+		assert.Equal(t, uint64(0b111), a[0]|b[0])
+	})
+}
+
+func TestPackedRTree_ContainsOffset(t *testing.T) {
+	refs := make([]Ref, 100)
+	for i := range refs {
+		x, y := float64(i%10), float64(i/10)
+		refs[i] = Ref{
+			Box:    Box{XMin: x, YMin: y, XMax: x + 0.5, YMax: y + 0.5},
+			Offset: int64(1000 + i),
+		}
+	}
+	prt, err := New(refs, 4)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		b        Box
+		offset   int64
+		expected bool
+	}{
+		{"Present", Box{XMin: 2, YMin: 3, XMax: 2.1, YMax: 3.1}, 1032, true},
+		{"PresentInLargeBox", prt.Bounds(), 1099, true},
+		{"AbsentNotIntersecting", Box{XMin: 2, YMin: 3, XMax: 2.1, YMax: 3.1}, 1033, false},
+		{"AbsentOffset", prt.Bounds(), 5, false},
+		{"EmptyBox", EmptyBox, 1000, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := prt.ContainsOffset(testCase.b, testCase.offset)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestPackedRTree_SubTree(t *testing.T) {
+	refs := make([]Ref, 400)
+	for i := range refs {
+		x, y := float64(i%20), float64(i/20)
+		refs[i] = Ref{
+			Box:    Box{XMin: x, YMin: y, XMax: x + 0.5, YMax: y + 0.5},
+			Offset: int64(1000 + i),
+		}
+	}
+	bounds := Box{XMin: 0, YMin: 0, XMax: 19.5, YMax: 19.5}
+	HilbertSort(refs, bounds)
+	prt, err := New(refs, 8)
+	require.NoError(t, err)
+	offsets := func(rs Results) []int64 {
+		o := make([]int64, len(rs))
+		for i := range rs {
+			o[i] = rs[i].Offset
+		}
+		return o
+	}
+
+	t.Run("Region", func(t *testing.T) {
+		region := Box{XMin: 4, YMin: 4, XMax: 9.25, YMax: 7.75}
+
+		sub, err := prt.SubTree(region)
+
+		require.NoError(t, err)
+		require.NotNil(t, sub)
+		assert.Equal(t, len(prt.Search(region)), sub.NumRefs())
+		assert.Equal(t, prt.NodeSize(), sub.NodeSize())
+		assert.Equal(t, Box{XMin: 4, YMin: 4, XMax: 9.5, YMax: 7.5}, sub.Bounds())
+		queries := []Box{
+			sub.Bounds(),
+			region,
+			prt.Bounds(),
+			{XMin: 5, YMin: 5, XMax: 6, YMax: 6},
+			{XMin: 8.75, YMin: 0, XMax: 20, YMax: 4.25},
+			{XMin: 15, YMin: 15, XMax: 16, YMax: 16},
+		}
+		for _, q := range queries {
+			t.Run(q.String(), func(t *testing.T) {
+				parent := offsets(prt.Search(q))
+
+				actual := offsets(sub.Search(q))
+
+				assert.Subset(t, parent, actual)
+				expected := offsets(prt.Search(Box{
+					XMin: math.Max(q.XMin, region.XMin),
+					YMin: math.Max(q.YMin, region.YMin),
+					XMax: math.Min(q.XMax, region.XMax),
+					YMax: math.Min(q.YMax, region.YMax),
+				}))
+				assert.Subset(t, actual, expected)
+			})
+		}
+	})
+
+	t.Run("Whole", func(t *testing.T) {
+		sub, err := prt.SubTree(prt.Bounds())
+
+		require.NoError(t, err)
+		require.NotNil(t, sub)
+		var expected, actual bytes.Buffer
+		_, err = prt.Marshal(&expected)
+		require.NoError(t, err)
+		_, err = sub.Marshal(&actual)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Bytes(), actual.Bytes())
+	})
+
+	t.Run("NoMatches", func(t *testing.T) {
+		sub, err := prt.SubTree(Box{XMin: 100, YMin: 100, XMax: 101, YMax: 101})
+
+		assert.NoError(t, err)
+		assert.Nil(t, sub)
+	})
+}
+
+func TestPackedRTree_Node(t *testing.T) {
+	// Build a tree with 11 refs arranged diagonally, and a node size of
+	// 3, giving levels with 11, 4, 2, and 1 nodes.
+	n := 11
+	refs := make([]Ref, n)
+	for i := range refs {
+		refs[i] = Ref{
+			Box:    Box{XMin: float64(i), YMin: float64(i), XMax: float64(i) + 0.5, YMax: float64(i) + 0.5},
+			Offset: int64(100 * i),
+		}
+	}
+	prt, err := New(refs, 3)
+	require.NoError(t, err)
+
+	t.Run("Levels", func(t *testing.T) {
+		require.Equal(t, 4, prt.NumLevels())
+		assert.Equal(t, 11, prt.LevelLen(0))
+		assert.Equal(t, 4, prt.LevelLen(1))
+		assert.Equal(t, 2, prt.LevelLen(2))
+		assert.Equal(t, 1, prt.LevelLen(3))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		box, child, isLeaf := prt.Node(prt.NumLevels()-1, 0)
+
+		assert.Equal(t, prt.Bounds(), box)
+		assert.Equal(t, int64(0), child)
+		assert.False(t, isLeaf)
+	})
+
+	t.Run("WalkRootToLeaf", func(t *testing.T) {
+		for i := range refs {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				target := refs[i].Box
+				level, j := prt.NumLevels()-1, 0
+				for {
+					box, childOrOffset, isLeaf := prt.Node(level, j)
+					require.True(t, box.intersects(&target))
+					if isLeaf {
+						require.Equal(t, 0, level)
+						assert.Equal(t, target, box)
+						assert.Equal(t, refs[i].Offset, childOrOffset)
+						break
+					}
+					// Find the child whose box contains the target.
+					level--
+					found := false
+					for k := int(childOrOffset); k < prt.LevelLen(level) && k < int(childOrOffset)+int(prt.NodeSize()); k++ {
+						childBox, _, _ := prt.Node(level, k)
+						if childBox.XMin <= target.XMin && target.XMax <= childBox.XMax &&
+							childBox.YMin <= target.YMin && target.YMax <= childBox.YMax {
+							j = k
+							found = true
+							break
+						}
+					}
+					require.True(t, found, "no child at level %d contains ref %d", level, i)
+				}
+			})
+		}
+	})
+
+	t.Run("Panics", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			level, i int
+			expected string
+		}{
+			{"Level.Negative", -1, 0, "packedrtree: level -1 out of range (4 levels)"},
+			{"Level.TooBig", 4, 0, "packedrtree: level 4 out of range (4 levels)"},
+			{"Index.Negative", 0, -1, "packedrtree: node index -1 out of range for level 0 (11 nodes)"},
+			{"Index.TooBig", 2, 2, "packedrtree: node index 2 out of range for level 2 (2 nodes)"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				assert.PanicsWithValue(t, testCase.expected, func() {
+					prt.Node(testCase.level, testCase.i)
+				})
+			})
+		}
+
+		t.Run("LevelLen", func(t *testing.T) {
+			assert.PanicsWithValue(t, "packedrtree: level 5 out of range (4 levels)", func() {
+				prt.LevelLen(5)
+			})
+		})
+	})
+}
+
+func TestPackedRTree_Reset(t *testing.T) {
+	refs := make([]Ref, 20)
+	for i := range refs {
+		refs[i] = Ref{Box: Box{XMin: float64(i), YMin: 0, XMax: float64(i) + 1, YMax: 1}, Offset: int64(i)}
+	}
+	prt, err := New(refs, 4)
+	require.NoError(t, err)
+	capacity := cap(prt.nodes)
+	backing := &prt.nodes[:1][0]
+
+	prt.Reset()
+
+	assert.Equal(t, 0, prt.NumRefs())
+	assert.Nil(t, prt.levels)
+	assert.Len(t, prt.nodes, 0)
+	assert.Equal(t, capacity, cap(prt.nodes))
+
+	t.Run("RebuildSmaller", func(t *testing.T) {
+		err := prt.Rebuild(refs[0:10], 2)
+
+		require.NoError(t, err)
+		assert.Same(t, backing, &prt.nodes[0], "Rebuild must reuse the node storage")
+		expected, err := New(refs[0:10], 2)
+		require.NoError(t, err)
+		assert.Equal(t, expected.levels, prt.levels)
+		assert.Equal(t, expected.nodes, prt.nodes)
+		assert.Equal(t, expected.NumRefs(), prt.NumRefs())
+		assert.Equal(t, expected.NodeSize(), prt.NodeSize())
+		assert.Len(t, prt.Search(prt.Bounds()), 10)
+	})
+
+	t.Run("RebuildLarger", func(t *testing.T) {
+		prt.Reset()
+		more := make([]Ref, 2*capacity)
+		for i := range more {
+			more[i] = Ref{Box: Box{XMin: float64(i), YMin: 0, XMax: float64(i) + 1, YMax: 1}, Offset: int64(i)}
+		}
+
+		err := prt.Rebuild(more, 4)
+
+		require.NoError(t, err)
+		expected, err := New(more, 4)
+		require.NoError(t, err)
+		assert.Equal(t, expected.nodes, prt.nodes)
+		assert.Len(t, prt.Search(prt.Bounds()), len(more))
+	})
+}
+
+func TestPackedRTree_MarshalLeaves(t *testing.T) {
+	t.Run("Panic", func(t *testing.T) {
+		prt, err := New([]Ref{{}}, 2)
+		require.NoError(t, err)
+
+		assert.PanicsWithValue(t, "packedrtree: nil writer", func() {
+			_, _ = prt.MarshalLeaves(nil)
+		})
+	})
+
+	for _, numRefs := range []int{1, 2, 17, 300} {
+		for _, nodeSize := range []uint16{2, 4, 16} {
+			t.Run(fmt.Sprintf("numRefs=%d,nodeSize=%d", numRefs, nodeSize), func(t *testing.T) {
+				refs := make([]Ref, numRefs)
+				for i := range refs {
+					x, y := float64(i%13), float64(i/13)
+					refs[i] = Ref{
+						Box:    Box{XMin: x, YMin: y, XMax: x + 0.25, YMax: y + 0.75},
+						Offset: int64(1000 + i),
+					}
+				}
+				prt, err := New(refs, nodeSize)
+				require.NoError(t, err)
+				var full bytes.Buffer
+				_, err = prt.Marshal(&full)
+				require.NoError(t, err)
+				expected := full.Bytes()[full.Len()-numRefs*numNodeBytes:]
+
+				var leaves bytes.Buffer
+				n, err := prt.MarshalLeaves(&leaves)
+
+				require.NoError(t, err)
+				assert.Equal(t, numRefs*numNodeBytes, n)
+				assert.Equal(t, expected, leaves.Bytes())
+
+				// The leaves parse back into the refs, in index order.
+				b := leaves.Bytes()
+				actual := make([]Ref, numRefs)
+				for i := range actual {
+					actual[i].XMin = math.Float64frombits(binary.LittleEndian.Uint64(b[i*40+0:]))
+					actual[i].YMin = math.Float64frombits(binary.LittleEndian.Uint64(b[i*40+8:]))
+					actual[i].XMax = math.Float64frombits(binary.LittleEndian.Uint64(b[i*40+16:]))
+					actual[i].YMax = math.Float64frombits(binary.LittleEndian.Uint64(b[i*40+24:]))
+					actual[i].Offset = int64(binary.LittleEndian.Uint64(b[i*40+32:]))
+				}
+				assert.ElementsMatch(t, refs, actual)
+			})
+		}
+	}
+}
+
+func TestPackedRTree_Checksum(t *testing.T) {
+	newTree := func(t *testing.T) *PackedRTree {
+		refs := make([]Ref, 50)
+		for i := range refs {
+			x, y := float64(i%7), float64(i/7)
+			refs[i] = Ref{
+				Box:    Box{XMin: x, YMin: y, XMax: x + 0.5, YMax: y + 0.5},
+				Offset: int64(100 * i),
+			}
+		}
+		prt, err := New(refs, 4)
+		require.NoError(t, err)
+		return prt
+	}
+	prt := newTree(t)
+	checksum := prt.Checksum()
+
+	t.Run("Identical", func(t *testing.T) {
+		assert.Equal(t, checksum, newTree(t).Checksum())
+		assert.Equal(t, checksum, prt.Checksum())
+	})
+
+	t.Run("Marshalled", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := prt.Marshal(&buf)
+		require.NoError(t, err)
+		h := fnv.New64a()
+		_, _ = h.Write(buf.Bytes())
+
+		assert.Equal(t, h.Sum64(), checksum)
+	})
+
+	t.Run("Unmarshalled", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := prt.Marshal(&buf)
+		require.NoError(t, err)
+		unmarshalled, err := Unmarshal(&buf, prt.NumRefs(), prt.NodeSize())
+		require.NoError(t, err)
+
+		assert.Equal(t, checksum, unmarshalled.Checksum())
+	})
+
+	t.Run("MutatedBox", func(t *testing.T) {
+		mutated := newTree(t)
+		mutated.nodes[len(mutated.nodes)-1].XMax += 0.125
+
+		assert.NotEqual(t, checksum, mutated.Checksum())
+	})
+
+	t.Run("MutatedOffset", func(t *testing.T) {
+		mutated := newTree(t)
+		mutated.nodes[mutated.levels[0].start].Offset++
+
+		assert.NotEqual(t, checksum, mutated.Checksum())
+	})
+}
+
 func TestUnmarshal(t *testing.T) {
 	t.Run("Panic", func(t *testing.T) {
 		testCases := []struct {
@@ -1092,6 +1612,270 @@ func TestSeek(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("UnsortedOffsets", func(t *testing.T) {
+		// Give the leaves offsets in descending order, as when the data
+		// section is not written in index order.
+		refs, bounds := randomRefs(100, 4)
+		HilbertSort(refs, bounds)
+		for i := range refs {
+			refs[i].Offset = int64(len(refs)-i) * 10
+		}
+		prt, err := New(refs, 4)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = prt.Marshal(&buf)
+		require.NoError(t, err)
+		expected := prt.Search(bounds)
+		sort.Sort(expected)
+
+		actual, err := Seek(bytes.NewReader(buf.Bytes()), len(refs), 4, bounds)
+
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+		assert.True(t, sort.IsSorted(actual))
+	})
+}
+
+func TestBoundsFromReader(t *testing.T) {
+	t.Run("Panic", func(t *testing.T) {
+		assert.PanicsWithValue(t, "packedrtree: nil reader", func() {
+			_, _ = BoundsFromReader(nil)
+		})
+	})
+
+	testCases := []struct {
+		name     string
+		numRefs  int
+		nodeSize uint16
+	}{
+		{"OneRef", 1, 2},
+		{"OneLevel", 5, 16},
+		{"ManyLevels", 500, 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			refs := make([]Ref, testCase.numRefs)
+			for i := range refs {
+				x, y := float64(i%17)-3, float64(i/17)*2-11
+				refs[i] = Ref{Box: Box{XMin: x, YMin: y, XMax: x + 0.25, YMax: y + 1.5}, Offset: int64(i)}
+			}
+			prt, err := New(refs, testCase.nodeSize)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, err = prt.Marshal(&buf)
+			require.NoError(t, err)
+			n := buf.Len()
+
+			b, err := BoundsFromReader(&buf)
+
+			require.NoError(t, err)
+			assert.Equal(t, prt.Bounds(), b)
+			assert.Equal(t, n-numNodeBytes, buf.Len(), "must consume exactly one node")
+		})
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		b, err := BoundsFromReader(bytes.NewReader(make([]byte, numNodeBytes-1)))
+
+		assert.EqualError(t, err, "packedrtree: failed to read root node: unexpected EOF")
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, Box{}, b)
+	})
+}
+
+func TestSeekWithSize(t *testing.T) {
+	t.Run("Panic", func(t *testing.T) {
+		testCases := []struct {
+			name      string
+			r         io.ReadSeeker
+			numRefs   int
+			nodeSize  uint16
+			indexSize int64
+			expected  string
+		}{
+			{"r.nil", nil, 1, 2, 40, "packedrtree: nil read seeker"},
+			{"numRefs.Zero", strings.NewReader("foo"), 0, 2, 40, "packedrtree: empty tree not allowed (num refs must be > 0)"},
+			{"nodeSize.One", strings.NewReader("bar"), 1, 1, 40, "packedrtree: node size must be at least 2"},
+			{"indexSize.Zero", strings.NewReader("baz"), 1, 2, 0, "packedrtree: index size must be at least 1"},
+			{"indexSize.Negative", strings.NewReader("qux"), 1, 2, -40, "packedrtree: index size must be at least 1"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				assert.PanicsWithValue(t, testCase.expected, func() {
+					_, _ = SeekWithSize(testCase.r, testCase.numRefs, testCase.nodeSize, testCase.indexSize, Box{})
+				})
+			})
+		}
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		var r mockReader
+		r.Test(t)
+		r.
+			On("Seek", int64(0), io.SeekCurrent).
+			Return(int64(math.MaxInt64-numNodeBytes), nil).
+			Once()
+
+		rs, err := SeekWithSize(&r, 1, 2, int64(numNodeBytes+1), EmptyBox)
+
+		assert.EqualError(t, err, "packedrtree: index end offset overflows int64")
+		assert.Nil(t, rs)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("MatchesSeek", func(t *testing.T) {
+		refs := make([]Ref, 250)
+		for i := range refs {
+			x, y := float64(i%25), float64(i/25)
+			refs[i] = Ref{
+				Box:    Box{XMin: x, YMin: y, XMax: x + 1.5, YMax: y + 0.5},
+				Offset: int64(i),
+			}
+		}
+		prt, err := New(refs, 6)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		const prefix = "data before index"
+		buf.WriteString(prefix)
+		_, err = prt.Marshal(&buf)
+		require.NoError(t, err)
+		buf.WriteString("data after index")
+		sz, err := Size(prt.NumRefs(), prt.NodeSize())
+		require.NoError(t, err)
+		queries := []Box{
+			EmptyBox,
+			prt.Bounds(),
+			{XMin: 3, YMin: 2, XMax: 7, YMax: 4},
+			{XMin: 24.5, YMin: 9.25, XMax: 30, YMax: 30},
+			{XMin: -5, YMin: -5, XMax: -1, YMax: -1},
+		}
+
+		for _, q := range queries {
+			t.Run(q.String(), func(t *testing.T) {
+				r1 := bytes.NewReader(buf.Bytes())
+				_, err := r1.Seek(int64(len(prefix)), io.SeekStart)
+				require.NoError(t, err)
+				expected, err := Seek(r1, prt.NumRefs(), prt.NodeSize(), q)
+				require.NoError(t, err)
+				r2 := bytes.NewReader(buf.Bytes())
+				_, err = r2.Seek(int64(len(prefix)), io.SeekStart)
+				require.NoError(t, err)
+
+				actual, err := SeekWithSize(r2, prt.NumRefs(), prt.NodeSize(), int64(sz), q)
+
+				require.NoError(t, err)
+				assert.Equal(t, expected, actual)
+				assert.Equal(t, r1.Len(), r2.Len(), "reader must be positioned at end of index")
+			})
+		}
+	})
+}
+
+func TestEstimateSeekCost(t *testing.T) {
+	t.Run("Panic", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			numRefs  int
+			nodeSize uint16
+			expected string
+		}{
+			{"numRefs.Zero", 0, 2, "packedrtree: empty tree not allowed (num refs must be > 0)"},
+			{"nodeSize.One", 1, 1, "packedrtree: node size must be at least 2"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				assert.PanicsWithValue(t, testCase.expected, func() {
+					_ = EstimateSeekCost(testCase.numRefs, testCase.nodeSize, Box{}, Box{})
+				})
+			})
+		}
+	})
+
+	refs := make([]Ref, 10_000)
+	for i := range refs {
+		x, y := float64(i%100), float64(i/100)
+		refs[i] = Ref{Box: Box{XMin: x, YMin: y, XMax: x + 0.5, YMax: y + 0.5}}
+	}
+	bounds := EmptyBox
+	for i := range refs {
+		bounds.Expand(&refs[i].Box)
+	}
+	HilbertSort(refs, bounds)
+	for i := range refs {
+		refs[i].Offset = int64(i)
+	}
+	const nodeSize = 16
+	prt, err := New(refs, nodeSize)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = prt.Marshal(&buf)
+	require.NoError(t, err)
+	sz, err := Size(len(refs), nodeSize)
+	require.NoError(t, err)
+
+	t.Run("Shrinking", func(t *testing.T) {
+		var prev int64 = math.MaxInt64
+		for _, half := range []float64{60, 40, 20, 10, 5, 2, 1, 0} {
+			b := Box{XMin: 50 - half, YMin: 50 - half, XMax: 50 + half, YMax: 50 + half}
+
+			actual := EstimateSeekCost(len(refs), nodeSize, b, bounds)
+
+			assert.LessOrEqual(t, actual, prev, "half-width %g", half)
+			assert.GreaterOrEqual(t, actual, int64(numNodeBytes), "half-width %g", half)
+			prev = actual
+		}
+		assert.Less(t, EstimateSeekCost(len(refs), nodeSize, Box{XMin: 50, YMin: 50, XMax: 51, YMax: 51}, bounds),
+			EstimateSeekCost(len(refs), nodeSize, Box{XMin: 10, YMin: 10, XMax: 90, YMax: 90}, bounds))
+	})
+
+	t.Run("Everything", func(t *testing.T) {
+		actual := EstimateSeekCost(len(refs), nodeSize, bounds, bounds)
+
+		assert.Equal(t, int64(sz), actual)
+	})
+
+	t.Run("Disjoint", func(t *testing.T) {
+		actual := EstimateSeekCost(len(refs), nodeSize, Box{XMin: 200, YMin: 200, XMax: 300, YMax: 300}, bounds)
+
+		assert.Equal(t, int64(numNodeBytes), actual)
+	})
+
+	t.Run("Actual", func(t *testing.T) {
+		queries := []Box{
+			{XMin: 3, YMin: 2, XMax: 7, YMax: 4},
+			{XMin: 20, YMin: 20, XMax: 40, YMax: 30},
+			{XMin: 45, YMin: 45, XMax: 55, YMax: 55},
+			{XMin: 0, YMin: 0, XMax: 50, YMax: 50},
+		}
+
+		for _, q := range queries {
+			t.Run(q.String(), func(t *testing.T) {
+				r := &countingReadSeeker{ReadSeeker: bytes.NewReader(buf.Bytes())}
+				_, err := Seek(r, len(refs), nodeSize, q)
+				require.NoError(t, err)
+
+				actual := EstimateSeekCost(len(refs), nodeSize, q, bounds)
+
+				assert.InDelta(t, r.n, actual, float64(r.n), "estimate should be within a factor of two of actual")
+			})
+		}
+	})
+}
+
+// countingReadSeeker wraps an io.ReadSeeker, counting the bytes read.
+type countingReadSeeker struct {
+	io.ReadSeeker
+	n int64
+}
+
+func (c *countingReadSeeker) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 type mockReader struct {
@@ -0,0 +1,50 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package packedrtree
+
+import "fmt"
+
+// PackStrategy selects the space-filling curve used to order feature
+// references before they are packed into a PackedRTree.
+//
+// The FlatGeobuf format does not record which ordering was used to
+// build an index. Searching works correctly regardless of the ordering,
+// since the internal nodes are always built from the leaves in whatever
+// order they are given; only search efficiency is affected.
+type PackStrategy int
+
+const (
+	// Hilbert orders feature references using HilbertSort. This is the
+	// zero value, and matches the reference FlatGeobuf implementations.
+	Hilbert PackStrategy = iota
+	// Morton orders feature references using MortonSort.
+	Morton
+)
+
+// String returns the name of the pack strategy.
+func (ps PackStrategy) String() string {
+	switch ps {
+	case Hilbert:
+		return "Hilbert"
+	case Morton:
+		return "Morton"
+	default:
+		return fmt.Sprintf("PackStrategy(%d)", int(ps))
+	}
+}
+
+// Sort sorts a list of feature references, whose overall bounding box
+// is given by bounds, according to the pack strategy. It panics if the
+// pack strategy is not valid.
+func (ps PackStrategy) Sort(refs []Ref, bounds Box) {
+	switch ps {
+	case Hilbert:
+		HilbertSortWithKeys(refs, bounds, nil)
+	case Morton:
+		MortonSort(refs, bounds)
+	default:
+		fmtPanic("invalid pack strategy %d", int(ps))
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package packedrtree
+
+import "math"
+
+// MaxTileZoom is the maximum zoom level accepted by TileCounts.
+const MaxTileZoom = 30
+
+// TileCounts counts the feature references in the packed Hilbert R-Tree
+// falling within each tile of a square tile grid, for example to build
+// a heatmap of feature density. The result maps tile coordinates,
+// given as [2]int{x, y}, to the number of feature references in the
+// tile. Tiles containing no references are omitted.
+//
+// The tile grid follows the conventions of the Web Mercator "XYZ" tile
+// scheme, but without any projection: the rectangle bounds is divided
+// into 2^zoom columns and 2^zoom rows of equal size, with tile column x
+// increasing from the minimum X-coordinate, and tile row y increasing
+// from the maximum Y-coordinate, so that tile (0, 0) is at the top left.
+// To reproduce Web Mercator tiles, the references must use Web Mercator
+// coordinates and bounds must be the Web Mercator world extent.
+//
+// Each feature reference is counted in exactly one tile, the one
+// containing the center of its bounding box. Centers on the boundary
+// between two tiles are counted in the tile to the right or below,
+// except on the right and bottom edges of the grid, where they are
+// counted in the last column or row. References whose centers lie
+// outside bounds are not counted.
+//
+// Panics if zoom is negative or greater than MaxTileZoom.
+func (prt *PackedRTree) TileCounts(bounds Box, zoom int) map[[2]int]int {
+	if zoom < 0 || zoom > MaxTileZoom {
+		fmtPanic("zoom %d out of range (must be between 0 and %d)", zoom, MaxTileZoom)
+	}
+	counts := make(map[[2]int]int)
+	n := 1 << zoom
+	w, h := bounds.Width(), bounds.Height()
+	for pos := prt.levels[0].start; pos < prt.levels[0].end; pos++ {
+		b := &prt.nodes[pos].Box
+		x, y := b.midX(), b.midY()
+		if !(bounds.XMin <= x && x <= bounds.XMax && bounds.YMin <= y && y <= bounds.YMax) {
+			continue
+		}
+		counts[[2]int{tileIndex(x-bounds.XMin, w, n), tileIndex(bounds.YMax-y, h, n)}]++
+	}
+	return counts
+}
+
+// tileIndex returns the index of the tile containing distance d along
+// an axis of length l divided into n tiles.
+func tileIndex(d, l float64, n int) int {
+	if l <= 0 {
+		return 0
+	}
+	i := int(math.Floor(d / l * float64(n)))
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The flatgeobuf (Go) Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package packedrtree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackedRTree_TileCounts(t *testing.T) {
+	// Points and small boxes on a 0-100 grid. With zoom 1, the tiles are
+	// 50 units square, with tile (0, 0) at the top left.
+	refs := []Ref{
+		{Box: Box{XMin: 10, YMin: 90, XMax: 10, YMax: 90}},     // (0, 0)
+		{Box: Box{XMin: 20, YMin: 60, XMax: 30, YMax: 70}},     // (0, 0)
+		{Box: Box{XMin: 60, YMin: 60, XMax: 70, YMax: 70}},     // (1, 0)
+		{Box: Box{XMin: 10, YMin: 10, XMax: 20, YMax: 20}},     // (0, 1)
+		{Box: Box{XMin: 40, YMin: 40, XMax: 80, YMax: 45}},     // (1, 1), center (60, 42.5)
+		{Box: Box{XMin: 50, YMin: 50, XMax: 50, YMax: 50}},     // (1, 1), center on corner
+		{Box: Box{XMin: 100, YMin: 0, XMax: 100, YMax: 0}},     // (1, 1), bottom right edge
+		{Box: Box{XMin: 0, YMin: 100, XMax: 0, YMax: 100}},     // (0, 0), top left edge
+		{Box: Box{XMin: 150, YMin: 50, XMax: 160, YMax: 60}},   // Outside.
+		{Box: Box{XMin: -100, YMin: -100, XMax: 99, YMax: 99}}, // Center outside, box overlaps.
+	}
+	HilbertSort(refs, Box{XMin: -100, YMin: -100, XMax: 160, YMax: 100})
+	prt, err := New(refs, 3)
+	require.NoError(t, err)
+	bounds := Box{XMin: 0, YMin: 0, XMax: 100, YMax: 100}
+
+	t.Run("Zoom0", func(t *testing.T) {
+		counts := prt.TileCounts(bounds, 0)
+
+		assert.Equal(t, map[[2]int]int{{0, 0}: 8}, counts)
+	})
+
+	t.Run("Zoom1", func(t *testing.T) {
+		counts := prt.TileCounts(bounds, 1)
+
+		assert.Equal(t, map[[2]int]int{
+			{0, 0}: 3,
+			{1, 0}: 1,
+			{0, 1}: 1,
+			{1, 1}: 3,
+		}, counts)
+	})
+
+	t.Run("Zoom2", func(t *testing.T) {
+		counts := prt.TileCounts(bounds, 2)
+
+		assert.Equal(t, map[[2]int]int{
+			{0, 0}: 2, // (10, 90) and (0, 100).
+			{1, 1}: 1, // (25, 65), on a column boundary.
+			{2, 1}: 1, // (65, 65).
+			{0, 3}: 1, // (15, 15).
+			{2, 2}: 2, // (60, 42.5) and (50, 50).
+			{3, 3}: 1, // (100, 0).
+		}, counts)
+	})
+
+	t.Run("DisjointBounds", func(t *testing.T) {
+		counts := prt.TileCounts(Box{XMin: 1000, YMin: 1000, XMax: 2000, YMax: 2000}, 3)
+
+		assert.Empty(t, counts)
+	})
+
+	t.Run("InvalidZoom", func(t *testing.T) {
+		assert.PanicsWithValue(t, "packedrtree: zoom -1 out of range (must be between 0 and 30)", func() {
+			prt.TileCounts(bounds, -1)
+		})
+		assert.PanicsWithValue(t, "packedrtree: zoom 31 out of range (must be between 0 and 30)", func() {
+			prt.TileCounts(bounds, 31)
+		})
+	})
+}